@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	reg "github.com/rancher/ecm-distro-tools/registry"
+	"github.com/rancher/ecm-distro-tools/release/airgap"
+	"github.com/rancher/ecm-distro-tools/release/product"
+	"github.com/spf13/cobra"
+)
+
+var (
+	airgapPlatform         string
+	airgapFormat           string
+	airgapCompression      string
+	airgapRegistry         string
+	airgapOutputFile       string
+	airgapAssetsDir        string
+	airgapConcurrencyLimit int
+)
+
+var airgapGenerateSubCmd = &cobra.Command{
+	Use:   "airgap-bundle [product] [tag]",
+	Short: "Build the air-gap image bundle of a release",
+	Long: `Build the air-gap image bundle of a rke2 or k3s release for a platform. The images of the
+platform's image lists are pulled from --registry and written as a docker-archive or OCI
+layout tarball, compressed with zstd or gzip. Use a local registry with --registry to build
+bundles without pulling from the public registries. Windows bundles can be built for an
+OS build with --platform windows/amd64:10.0.17763.`,
+	Example: "release generate airgap-bundle rke2 v1.30.4+rke2r1 --platform linux/arm64 --compression gzip",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return errors.New("expected at least two arguments: [product] [tag]")
+		}
+		productName, tag := args[0], args[1]
+
+		p, ok := product.Products[productName]
+		if !ok {
+			return errors.New("unsupported product: " + productName)
+		}
+		platform, err := reg.ParsePlatform(airgapPlatform)
+		if err != nil {
+			return err
+		}
+		listPlatform := imageListPlatform(platform)
+		if err := p.CheckPlatform(listPlatform); err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+		filesystem, err := releaseAssetsFS(ctx, productName, tag, airgapAssetsDir)
+		if err != nil {
+			return err
+		}
+
+		images, err := p.Images(filesystem, listPlatform)
+		if err != nil {
+			return err
+		}
+
+		output := airgapOutputFile
+		if output == "" {
+			output = airgapBundleName(productName, airgapPlatform, airgap.Format(airgapFormat), airgap.Compression(airgapCompression))
+		}
+
+		if dryRun {
+			fmt.Println("would write " + output + " with:")
+			for _, image := range images {
+				fmt.Println("  " + image)
+			}
+			return nil
+		}
+
+		f, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+
+		err = airgap.Build(ctx, f, newRegistryClient(airgapRegistry), images, platform, airgap.Options{
+			Format:           airgap.Format(airgapFormat),
+			Compression:      airgap.Compression(airgapCompression),
+			ConcurrencyLimit: airgapConcurrencyLimit,
+		})
+		if err != nil {
+			f.Close()
+			os.Remove(output)
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+
+		fmt.Println("wrote " + output + " with " + strconv.Itoa(len(images)) + " images")
+
+		return nil
+	},
+}
+
+var airgapVerifySubCmd = &cobra.Command{
+	Use:     "airgap-bundle [product] [tag] [bundle]",
+	Short:   "Verify an air-gap image bundle holds the images of the release image lists",
+	Example: "release verify airgap-bundle rke2 v1.30.4+rke2r1 rke2-images.linux-amd64.tar.zst",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 3 {
+			return errors.New("expected at least three arguments: [product] [tag] [bundle]")
+		}
+		productName, tag, bundle := args[0], args[1], args[2]
+
+		p, ok := product.Products[productName]
+		if !ok {
+			return errors.New("unsupported product: " + productName)
+		}
+		platform, err := reg.ParsePlatform(airgapPlatform)
+		if err != nil {
+			return err
+		}
+		listPlatform := imageListPlatform(platform)
+		if err := p.CheckPlatform(listPlatform); err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+		filesystem, err := releaseAssetsFS(ctx, productName, tag, airgapAssetsDir)
+		if err != nil {
+			return err
+		}
+
+		images, err := p.Images(filesystem, listPlatform)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(bundle)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		verification, err := airgap.Verify(f, images)
+		if err != nil {
+			return err
+		}
+
+		switch verifyOutput {
+		case "json":
+			b, err := json.MarshalIndent(verification, "", " ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(b))
+		case "text":
+			for _, image := range verification.Missing {
+				fmt.Println("missing:    " + image)
+			}
+			for _, image := range verification.Unexpected {
+				fmt.Println("unexpected: " + image)
+			}
+			if verification.OK() {
+				fmt.Println(bundle + " holds the " + strconv.Itoa(len(images)) + " images of the " + airgapPlatform + " image lists")
+			}
+		default:
+			return errors.New("unrecognized output format: " + verifyOutput)
+		}
+
+		if !verification.OK() {
+			return errors.New(bundle + " doesn't match the image lists")
+		}
+
+		return nil
+	},
+}
+
+// imageListPlatform returns the platform of the image lists with the images of a platform,
+// the lists don't depend on the variant or the OS version
+func imageListPlatform(platform reg.Platform) product.Architecture {
+	return product.Architecture(platform.OS + "/" + platform.Architecture)
+}
+
+// airgapBundleName returns the default bundle file name, following the published rke2 bundles,
+// e.g. rke2-images.linux-amd64.tar.zst
+func airgapBundleName(product, platform string, format airgap.Format, compression airgap.Compression) string {
+	name := product + "-images." + strings.NewReplacer("/", "-", ":", "-").Replace(platform)
+	if format == airgap.FormatOCI {
+		name += ".oci"
+	}
+	name += ".tar"
+
+	switch compression {
+	case airgap.CompressionZstd, "":
+		name += ".zst"
+	case airgap.CompressionGzip:
+		name += ".gz"
+	}
+
+	return name
+}
+
+func init() {
+	generateCmd.AddCommand(airgapGenerateSubCmd)
+	verifyCmd.AddCommand(airgapVerifySubCmd)
+
+	for _, cmd := range []*cobra.Command{airgapGenerateSubCmd, airgapVerifySubCmd} {
+		cmd.Flags().StringVarP(&airgapPlatform, "platform", "p", string(product.LinuxAmd64), "Platform of the bundle, os/arch[:osversion] (linux/amd64|linux/arm64|windows/amd64:10.0.17763)")
+		cmd.Flags().StringVar(&airgapAssetsDir, "assets-dir", "", "Local directory with the release assets, instead of the published GitHub release")
+		cmd.Flags().StringVar(&releaseOwner, "owner", "", "Owner of the release repository, defaults to the product's owner")
+	}
+
+	airgapGenerateSubCmd.Flags().StringVar(&airgapFormat, "format", string(airgap.FormatDockerArchive), "Bundle format (docker-archive|oci)")
+	airgapGenerateSubCmd.Flags().StringVar(&airgapCompression, "compression", string(airgap.CompressionZstd), "Bundle compression (zstd|gzip|none)")
+	airgapGenerateSubCmd.Flags().StringVarP(&airgapRegistry, "registry", "r", ossRegistry, "Registry the images are pulled from")
+	airgapGenerateSubCmd.Flags().StringVarP(&airgapOutputFile, "output-file", "o", "", "Output file, defaults to <product>-images.<platform>.tar.<compression>")
+	airgapGenerateSubCmd.Flags().IntVarP(&airgapConcurrencyLimit, "concurrency-limit", "l", defaultConcurrencyLimit, "Maximum number of images resolved at a time")
+}
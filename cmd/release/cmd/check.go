@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rancher/ecm-distro-tools/cmd/release/config"
+	"github.com/rancher/ecm-distro-tools/release/rancher"
+	"github.com/rancher/ecm-distro-tools/repository"
+	"github.com/spf13/cobra"
+)
+
+var (
+	checkOutput           string
+	checkPrimeRegistry    string
+	checkImagesTag        string
+	checkAssetsDir        string
+	checkConcurrencyLimit int
+)
+
+// checkCmd represents the check command
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check if a release is ready",
+}
+
+var checkRancherSubCmd = &cobra.Command{
+	Use:   "rancher [version]",
+	Short: "Check if a Rancher GA release is ready to be tagged",
+	Long: `Check if a Rancher GA release is ready to be tagged:
+- the release branch has no rc or dev dependencies
+- the images in rancher-images.txt are in the Prime registry
+- the Dashboard and CLI references PRs to the dashboard_version and
+  cli_version of the rancher version in the config are merged
+- the KDM and charts branches aren't dev-v* branches`,
+	Example: "release check rancher v2.9.3\nrelease check rancher v2.9.3 --images-tag v2.9.3-rc4 -o json",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return errors.New("expected at least one argument: [version]")
+		}
+		version := args[0]
+
+		releaseBranch, err := rancher.ReleaseBranchFromTag(version)
+		if err != nil {
+			return errors.New("failed to generate release branch from tag: " + err.Error())
+		}
+		var rancherRelease config.RancherRelease
+		versionTrimmed, _, _ := strings.Cut(version, "-")
+		if rootConfig.Rancher != nil {
+			rancherRelease = rootConfig.Rancher.Versions[versionTrimmed]
+		}
+		releaseBranch = config.ValueOrDefault(rancherRelease.ReleaseBranch, releaseBranch)
+
+		if checkPrimeRegistry == "" {
+			checkPrimeRegistry = rootConfig.PrimeRegistry
+		}
+
+		opts := rancher.ReadinessOptions{
+			Owner:            config.ValueOrDefault(rootConfig.RancherGithubOrganization, config.RancherGithubOrganization),
+			Repo:             config.ValueOrDefault(rootConfig.RancherRepositoryName, config.RancherRepositoryName),
+			ReleaseBranch:    releaseBranch,
+			ImagesTag:        checkImagesTag,
+			PrimeRegistry:    checkPrimeRegistry,
+			DashboardVersion: rancherRelease.DashboardVersion,
+			CLIVersion:       rancherRelease.CLIVersion,
+			ConcurrencyLimit: checkConcurrencyLimit,
+			RegistryOptions:  registryOptions(),
+		}
+		if checkAssetsDir != "" {
+			opts.Assets = os.DirFS(checkAssetsDir)
+		}
+
+		ctx := context.Background()
+		client := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
+
+		report, err := rancher.CheckReleaseReadiness(ctx, client, version, opts)
+		if err != nil {
+			return err
+		}
+
+		switch checkOutput {
+		case "json":
+			b, err := json.MarshalIndent(report, "", " ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(b))
+		case "text":
+			readinessReportText(os.Stdout, report)
+		default:
+			return errors.New("unrecognized output format: " + checkOutput)
+		}
+
+		if !report.Passed() {
+			return errors.New("rancher " + version + " isn't ready to be released")
+		}
+
+		return nil
+	},
+}
+
+func readinessReportText(w io.Writer, report *rancher.ReadinessReport) {
+	fmt.Fprintf(w, "Rancher %s release readiness (%s)\n", report.Version, report.ReleaseBranch)
+	for _, check := range report.Checks {
+		mark := "✓"
+		if !check.Passed {
+			mark = "✗"
+		}
+		fmt.Fprintf(w, "%s %s: %s\n", mark, check.Name, check.Summary)
+		for _, detail := range check.Details {
+			fmt.Fprintln(w, "    - "+detail)
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(checkCmd)
+
+	checkCmd.AddCommand(checkRancherSubCmd)
+
+	checkCmd.PersistentFlags().StringVarP(&checkOutput, "output", "o", "text", "Output format (text|json)")
+
+	checkRancherSubCmd.Flags().StringVar(&checkPrimeRegistry, "prime-registry", "", "Prime registry the images are checked in, defaults to the prime_registry in the config")
+	checkRancherSubCmd.Flags().StringVar(&checkImagesTag, "images-tag", "", "Release whose rancher-images.txt is checked, defaults to the latest rc of the version")
+	checkRancherSubCmd.Flags().StringVar(&checkAssetsDir, "assets-dir", "", "Local directory with rancher-images.txt, instead of the published GitHub release")
+	checkRancherSubCmd.Flags().IntVarP(&checkConcurrencyLimit, "concurrency-limit", "l", defaultConcurrencyLimit, "Number of images checked at once")
+}
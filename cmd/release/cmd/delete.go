@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	ecmExec "github.com/rancher/ecm-distro-tools/exec"
+	"github.com/rancher/ecm-distro-tools/release"
+	"github.com/rancher/ecm-distro-tools/repository"
+	"github.com/spf13/cobra"
+)
+
+var (
+	deleteFilters   []string
+	deleteBackupDir string
+	deleteAuditLog  string
+	deleteYes       bool
+	deleteForce     bool
+)
+
+// deleteCmd represents the delete command
+var deleteCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "Delete release artifacts",
+}
+
+var deleteAssetsSubCmd = &cobra.Command{
+	Use:   "assets [product] [tag]",
+	Short: "Delete the assets of a release matching the given filters",
+	Long: `Delete the assets of a release whose names match any of the given glob filters.
+Matching assets are downloaded to a backup directory before being deleted, and an audit
+record of the deletion is appended to the audit log. Assets of GA releases, which aren't
+marked as prereleases, are only deleted with --force.`,
+	Example: "release delete assets rke2 v1.30.4-rc1+rke2r1 -f 'rke2-images*' -f 'sha256sum-*.txt'",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return errors.New("expected at least two arguments: [product] [tag]")
+		}
+		tag := args[1]
+
+		owner, repo, err := productRepository(args[0])
+		if err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+		client := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
+
+		filesystem, err := newReleaseFS(ctx, client, owner, repo, tag)
+		if err != nil {
+			return err
+		}
+		rel := filesystem.Release()
+
+		if !rel.GetPrerelease() && !deleteForce {
+			return errors.New("release " + tag + " is not a prerelease, use --force to delete assets from GA releases")
+		}
+
+		assets, err := release.MatchAssets(rel, deleteFilters)
+		if err != nil {
+			return err
+		}
+		if len(assets) == 0 {
+			fmt.Println("no assets match the given filters")
+			return nil
+		}
+
+		for _, asset := range assets {
+			fmt.Println(asset.GetName() + " (" + strconv.Itoa(asset.GetSize()) + " bytes)")
+		}
+		if dryRun {
+			fmt.Println("dry run: " + strconv.Itoa(len(assets)) + " assets would be deleted")
+			return nil
+		}
+
+		if !deleteYes && !ecmExec.UserInput("Delete "+strconv.Itoa(len(assets))+" assets from "+owner+"/"+repo+" "+tag+"?") {
+			return errors.New("deletion aborted")
+		}
+
+		backupDir := deleteBackupDir
+		if backupDir == "" {
+			backupDir = filepath.Join(".", repo+"-"+tag+"-assets-backup")
+		}
+		auditLog := deleteAuditLog
+		if auditLog == "" {
+			auditLog = filepath.Join(backupDir, "audit.jsonl")
+		}
+
+		backups, err := release.BackupAssets(filesystem, assets, backupDir)
+		if err != nil {
+			return err
+		}
+		fmt.Println("backed up " + strconv.Itoa(len(backups)) + " assets to " + backupDir)
+
+		deletion := release.AssetDeletion{
+			Owner:      owner,
+			Repo:       repo,
+			Tag:        tag,
+			Prerelease: rel.GetPrerelease(),
+			Filters:    deleteFilters,
+			Time:       time.Now().UTC(),
+			Assets:     backups,
+		}
+		if rootConfig.User != nil {
+			deletion.User = rootConfig.User.GithubUsername
+		}
+
+		deleteErr := release.DeleteAssets(ctx, client, owner, repo, deletion.Assets)
+		if deleteErr != nil {
+			deletion.Error = deleteErr.Error()
+		}
+
+		if err := release.WriteAudit(auditLog, &deletion); err != nil {
+			return err
+		}
+		fmt.Println("audit record written to " + auditLog)
+
+		if deleteErr != nil {
+			return deleteErr
+		}
+		fmt.Println("deleted " + strconv.Itoa(len(deletion.Assets)) + " assets")
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(deleteCmd)
+
+	deleteCmd.AddCommand(deleteAssetsSubCmd)
+
+	deleteAssetsSubCmd.Flags().StringSliceVarP(&deleteFilters, "filter", "f", nil, "Glob filter of the asset names to delete, use '*' to delete all assets")
+	deleteAssetsSubCmd.Flags().StringVarP(&deleteBackupDir, "backup-dir", "b", "", "Directory the assets are backed up to, defaults to ./<repo>-<tag>-assets-backup")
+	deleteAssetsSubCmd.Flags().StringVar(&deleteAuditLog, "audit-log", "", "File the audit record is appended to, defaults to audit.jsonl in the backup directory")
+	deleteAssetsSubCmd.Flags().BoolVarP(&deleteYes, "yes", "y", false, "Delete without asking for confirmation")
+	deleteAssetsSubCmd.Flags().BoolVar(&deleteForce, "force", false, "Allow deleting assets of GA releases")
+	deleteAssetsSubCmd.Flags().StringVar(&releaseOwner, "owner", "", "Owner of the release repository, defaults to the product's owner")
+	if err := deleteAssetsSubCmd.MarkFlagRequired("filter"); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rancher/ecm-distro-tools/release/product"
+	"github.com/rancher/ecm-distro-tools/release/rke2"
+	"github.com/spf13/cobra"
+)
+
+var (
+	diffImagesOutput       string
+	diffImagesOldAssetsDir string
+	diffImagesNewAssetsDir string
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Compare releases",
+}
+
+var diffImagesSubCmd = &cobra.Command{
+	Use:   "images [product] [old-tag] [new-tag]",
+	Short: "Compare the image lists of two releases",
+	Long: `Compare the image lists of two rke2 or k3s releases, listing the images added, removed or
+bumped in the new release. Images are paired by repository on each platform, and identical
+changes across platforms are listed once. The markdown output can be embedded in release notes.`,
+	Example: "release diff images rke2 v1.30.3+rke2r1 v1.30.4+rke2r1 -o markdown",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 3 {
+			return errors.New("expected at least three arguments: [product] [old-tag] [new-tag]")
+		}
+		productName, oldTag, newTag := args[0], args[1], args[2]
+
+		p, ok := product.Products[productName]
+		if !ok {
+			return errors.New("unsupported product: " + productName)
+		}
+		for _, tag := range []string{oldTag, newTag} {
+			if !p.Matches(tag) {
+				return errors.New("expected a " + p.Name + " release version, received " + tag)
+			}
+		}
+
+		ctx := context.Background()
+		oldFS, err := releaseAssetsFS(ctx, productName, oldTag, diffImagesOldAssetsDir)
+		if err != nil {
+			return err
+		}
+		newFS, err := releaseAssetsFS(ctx, productName, newTag, diffImagesNewAssetsDir)
+		if err != nil {
+			return err
+		}
+
+		changes, err := rke2.DiffImages(p, oldFS, newFS)
+		if err != nil {
+			return err
+		}
+
+		switch diffImagesOutput {
+		case "json":
+			b, err := json.MarshalIndent(changes, "", " ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(b))
+		case "markdown":
+			imageChangesMarkdown(os.Stdout, oldTag, newTag, changes)
+		case "table":
+			imageChangesTable(os.Stdout, changes)
+		default:
+			return errors.New("unrecognized output format: " + diffImagesOutput)
+		}
+
+		return nil
+	},
+}
+
+func platformNames(platforms []product.Architecture) string {
+	names := make([]string, len(platforms))
+	for i, platform := range platforms {
+		names[i] = string(platform)
+	}
+
+	return strings.Join(names, ", ")
+}
+
+func imageChangesTable(w io.Writer, changes []rke2.ImageChange) {
+	if len(changes) == 0 {
+		fmt.Fprintln(w, "no image changes")
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	defer tw.Flush()
+
+	fmt.Fprintln(tw, "image\tchange\told\tnew\tplatforms")
+	fmt.Fprintln(tw, "-----\t------\t---\t---\t---------")
+	for _, change := range changes {
+		fmt.Fprintln(tw, strings.Join([]string{
+			change.Repository,
+			string(change.Change),
+			dashIfEmpty(change.OldTag),
+			dashIfEmpty(change.NewTag),
+			platformNames(change.Platforms),
+		}, "\t"))
+	}
+}
+
+func imageChangesMarkdown(w io.Writer, oldTag, newTag string, changes []rke2.ImageChange) {
+	fmt.Fprintf(w, "### Image changes since %s\n\n", oldTag)
+	if len(changes) == 0 {
+		fmt.Fprintf(w, "%s ships the same images as %s.\n", newTag, oldTag)
+		return
+	}
+
+	for _, section := range []struct {
+		change rke2.Change
+		title  string
+	}{
+		{rke2.ChangeBumped, "Updated"},
+		{rke2.ChangeAdded, "Added"},
+		{rke2.ChangeRemoved, "Removed"},
+	} {
+		var rows []string
+		for _, change := range changes {
+			if change.Change != section.change {
+				continue
+			}
+			rows = append(rows, "| "+strings.Join([]string{
+				"`" + change.Repository + "`",
+				codeIfSet(change.OldTag),
+				codeIfSet(change.NewTag),
+				platformNames(change.Platforms),
+			}, " | ")+" |")
+		}
+		if len(rows) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(w, "#### %s\n\n", section.title)
+		fmt.Fprintln(w, "| Image | Old | New | Platforms |")
+		fmt.Fprintln(w, "| --- | --- | --- | --- |")
+		fmt.Fprintln(w, strings.Join(rows, "\n"))
+		fmt.Fprintln(w)
+	}
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func codeIfSet(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return "`" + s + "`"
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	diffCmd.AddCommand(diffImagesSubCmd)
+
+	diffImagesSubCmd.Flags().StringVarP(&diffImagesOutput, "output", "o", "table", "Output format (table|json|markdown)")
+	diffImagesSubCmd.Flags().StringVar(&diffImagesOldAssetsDir, "old-assets-dir", "", "Local directory with the assets of the old release, instead of the published GitHub release")
+	diffImagesSubCmd.Flags().StringVar(&diffImagesNewAssetsDir, "new-assets-dir", "", "Local directory with the assets of the new release, instead of the published GitHub release")
+	diffImagesSubCmd.Flags().StringVar(&releaseOwner, "owner", "", "Owner of the release repository, defaults to the product's owner")
+}
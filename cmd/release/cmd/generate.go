@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -17,7 +18,9 @@ import (
 	"github.com/rancher/ecm-distro-tools/release/kdm"
 	"github.com/rancher/ecm-distro-tools/release/metrics"
 	"github.com/rancher/ecm-distro-tools/release/prime"
+	"github.com/rancher/ecm-distro-tools/release/product"
 	"github.com/rancher/ecm-distro-tools/release/rancher"
+	"github.com/rancher/ecm-distro-tools/release/sbom"
 	"github.com/rancher/ecm-distro-tools/repository"
 	"github.com/spf13/cobra"
 	"sigs.k8s.io/yaml"
@@ -25,6 +28,11 @@ import (
 
 const defaultConcurrencyLimit = 3
 
+// artifactsIndexKnownOmissions contains versions that should always be omitted from the artifacts index for various reasons
+var artifactsIndexKnownOmissions = []string{
+	"v2.6.4", // test version of rancher
+}
+
 var (
 	k3sPrevMilestone string
 	k3sMilestone     string
@@ -52,14 +60,20 @@ var (
 	rancherImagesDigestsOutputFile        string
 	rancherImagesDigestsRegistry          string
 	rancherImagesDigestsImagesURL         string
+	rancherImagesDigestsConcurrencyLimit  int
+	rancherImagesDigestsVerifyFile        string
+	rancherImagesDigestsPlatforms         bool
 	rancherSyncImages                     []string
 	rancherSourceRegistry                 string
 	rancherTargetRegistry                 string
 	rancherSyncConfigOutputPath           string
+	rancherSyncConfigOptions              rancher.RegsyncOptions
 	rancherMetricsRancherReleasesFilePath string
 	rancherMetricsWorkflowsFilePath       string
 	rancherMetricsPrimeReleasesFilePath   string
 	releases                              []string
+	sbomFormat                            string
+	sbomOutputDir                         string
 )
 
 // generateCmd represents the generate command
@@ -162,11 +176,7 @@ var rancherGenerateArtifactsIndexSubCmd = &cobra.Command{
 			lister = prime.NewArtifactBucket(client)
 		}
 
-		// knownOmissions contains versions that should always be omitted for various reasons
-		knownOmissions := []string{
-			"v2.6.4", // test version of rancher
-		}
-		ignoreVersions := append(rancherArtifactsIndexIgnoreVersions, knownOmissions...)
+		ignoreVersions := append(rancherArtifactsIndexIgnoreVersions, artifactsIndexKnownOmissions...)
 
 		return prime.GenerateArtifactsIndex(ctx, rancherArtifactsIndexWriteToPath, ignoreVersions, lister)
 	},
@@ -189,7 +199,7 @@ var rancherGenerateImagesLocationsSubCmd = &cobra.Command{
 			checkImages = append(checkImages, rancherImages...)
 		}
 
-		imagesLocations, err := rancher.ImagesLocations(username, password, concurrencyLimit, checkImages, ignoreImages, registry, registries)
+		imagesLocations, err := rancher.ImagesLocations(username, password, concurrencyLimit, checkImages, ignoreImages, registry, registries, registryOptions()...)
 		if err != nil {
 			return err
 		}
@@ -219,7 +229,7 @@ var rancherGenerateMissingImagesListSubCmd = &cobra.Command{
 			checkImages = append(checkImages, rancherImages...)
 		}
 
-		missingImages, err := rancher.MissingImagesFromRegistry(username, password, registry, concurrencyLimit, checkImages, ignoreImages)
+		missingImages, err := rancher.MissingImagesFromRegistry(username, password, registry, concurrencyLimit, checkImages, ignoreImages, registryOptions()...)
 		if err != nil {
 			return err
 		}
@@ -244,7 +254,7 @@ var rancherGenerateDockerImagesDigestsSubCmd = &cobra.Command{
 	Use:   "docker-images-digests",
 	Short: "Generate a file with images digests from an images list",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return rancher.GenerateDockerImageDigests(rancherImagesDigestsOutputFile, rancherImagesDigestsImagesURL, rancherImagesDigestsRegistry, username, password, verbose)
+		return rancher.GenerateDockerImageDigests(rancherImagesDigestsOutputFile, rancherImagesDigestsImagesURL, rancherImagesDigestsRegistry, username, password, rancherImagesDigestsConcurrencyLimit, rancherImagesDigestsPlatforms, rancherImagesDigestsVerifyFile, verbose, registryOptions()...)
 	},
 }
 
@@ -252,7 +262,7 @@ var rancherGenerateImagesSyncConfigSubCmd = &cobra.Command{
 	Use:   "images-sync-config",
 	Short: "Generate a regsync config file for images sync",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return rancher.GenerateImagesSyncConfig(rancherSyncImages, rancherSourceRegistry, rancherTargetRegistry, rancherSyncConfigOutputPath)
+		return rancher.GenerateImagesSyncConfig(rancherSyncImages, rancherSourceRegistry, rancherTargetRegistry, rancherSyncConfigOutputPath, rancherSyncConfigOptions)
 	},
 }
 
@@ -416,6 +426,92 @@ var kdmGenerateRKE2SubCmd = &cobra.Command{
 	},
 }
 
+var sbomGenerateSubCmd = &cobra.Command{
+	Use:   "sbom [product] [tag]",
+	Short: "Generate SPDX and CycloneDX SBOMs for a release",
+	Long: `Generate the software bill of materials of a rke2, k3s or rancher release, in the
+SPDX and CycloneDX JSON formats. The SBOM lists the images of the release image lists with
+their digests per platform and, for rke2 and k3s, the versions of the bundled components
+and charts as collected for the release notes.`,
+	Example: "release generate sbom rke2 v1.30.4+rke2r1 --format spdx",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return errors.New("expected at least two arguments: [product] [tag]")
+		}
+		productName, tag := args[0], args[1]
+
+		p, ok := product.Products[productName]
+		if !ok {
+			return errors.New("unsupported product: " + productName)
+		}
+
+		if concurrencyLimit < 1 {
+			return errors.New("--concurrency-limit must be at least 1")
+		}
+
+		var formats []string
+		switch sbomFormat {
+		case "all":
+			formats = []string{"spdx", "cyclonedx"}
+		case "spdx", "cyclonedx":
+			formats = []string{sbomFormat}
+		default:
+			return errors.New("unrecognized sbom format: " + sbomFormat)
+		}
+
+		owner, repo, err := productRepository(productName)
+		if err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+		client := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
+
+		filesystem, err := newReleaseFS(ctx, client, owner, repo, tag)
+		if err != nil {
+			return err
+		}
+
+		var components []release.Component
+		if productName == "rke2" || productName == "k3s" {
+			components, err = release.Components(productName, tag)
+			if err != nil {
+				return err
+			}
+		}
+
+		bom, err := sbom.Generate(ctx, newRegistryClient(ossRegistry), filesystem, p, tag, components, concurrencyLimit)
+		if err != nil {
+			return err
+		}
+
+		for _, format := range formats {
+			path := filepath.Join(sbomOutputDir, productName+"-"+tag+"."+format+".json")
+			f, err := os.Create(path)
+			if err != nil {
+				return err
+			}
+
+			if format == "spdx" {
+				err = bom.SPDX(f)
+			} else {
+				err = bom.CycloneDX(f)
+			}
+			if err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+
+			fmt.Println("wrote " + path)
+		}
+
+		return nil
+	},
+}
+
 func init() {
 	rootCmd.AddCommand(generateCmd)
 
@@ -445,6 +541,13 @@ func init() {
 	generateCmd.AddCommand(dashboardGenerateSubCmd)
 	generateCmd.AddCommand(cliGenerateSubCmd)
 	generateCmd.AddCommand(kdmGenerateSubCmd)
+	generateCmd.AddCommand(sbomGenerateSubCmd)
+
+	// sbom
+	sbomGenerateSubCmd.Flags().StringVarP(&sbomFormat, "format", "f", "all", "SBOM format (spdx|cyclonedx|all)")
+	sbomGenerateSubCmd.Flags().StringVarP(&sbomOutputDir, "output-dir", "d", ".", "Output directory, defaults to current working directory")
+	sbomGenerateSubCmd.Flags().IntVarP(&concurrencyLimit, "concurrency-limit", "l", defaultConcurrencyLimit, "Maximum number of images resolved at a time")
+	sbomGenerateSubCmd.Flags().StringVar(&releaseOwner, "owner", "", "Owner of the release repository, defaults to the product's owner")
 
 	// k3s release notes
 	k3sGenerateReleaseNotesSubCmd.Flags().StringVarP(&k3sPrevMilestone, "prev-milestone", "p", "", "Previous Milestone")
@@ -545,6 +648,9 @@ func init() {
 		os.Exit(1)
 	}
 	rancherGenerateDockerImagesDigestsSubCmd.Flags().StringVarP(&rancherImagesDigestsRegistry, "registry", "r", "", "Docker Registry e.g: docker.io")
+	rancherGenerateDockerImagesDigestsSubCmd.Flags().IntVarP(&rancherImagesDigestsConcurrencyLimit, "concurrency-limit", "l", defaultConcurrencyLimit, "Number of images checked at once")
+	rancherGenerateDockerImagesDigestsSubCmd.Flags().StringVar(&rancherImagesDigestsVerifyFile, "verify", "", "Digests file of a previous run, fails if any digest changed for the same tag")
+	rancherGenerateDockerImagesDigestsSubCmd.Flags().BoolVar(&rancherImagesDigestsPlatforms, "platforms", false, "Also write the platform manifest digests of multi-platform images, as image@os/arch lines")
 	if err := rancherGenerateDockerImagesDigestsSubCmd.MarkFlagRequired("registry"); err != nil {
 		fmt.Println(err.Error())
 		os.Exit(1)
@@ -554,6 +660,11 @@ func init() {
 	rancherGenerateImagesSyncConfigSubCmd.Flags().StringVarP(&rancherSourceRegistry, "source-registry", "s", "", "Source registry, where the images are located")
 	rancherGenerateImagesSyncConfigSubCmd.Flags().StringVarP(&rancherTargetRegistry, "target-registry", "t", "", "Target registry, where the images should be synced to")
 	rancherGenerateImagesSyncConfigSubCmd.Flags().StringVarP(&rancherSyncConfigOutputPath, "output", "o", "./config.yaml", "Output path of the generated config file")
+	rancherGenerateImagesSyncConfigSubCmd.Flags().IntVarP(&rancherSyncConfigOptions.Parallel, "parallel", "p", 1, "Number of images regsync syncs at once")
+	rancherGenerateImagesSyncConfigSubCmd.Flags().StringSliceVar(&rancherSyncConfigOptions.MediaTypes, "media-types", nil, "Manifest media types to sync, defaults to the docker and OCI manifests and indexes")
+	rancherGenerateImagesSyncConfigSubCmd.Flags().StringSliceVar(&rancherSyncConfigOptions.AllowTags, "allow-tags", nil, "Tag regular expressions allowed for every repository, besides the image tags")
+	rancherGenerateImagesSyncConfigSubCmd.Flags().StringSliceVar(&rancherSyncConfigOptions.DenyTags, "deny-tags", nil, "Tag regular expressions never synced")
+	rancherGenerateImagesSyncConfigSubCmd.Flags().BoolVarP(&rancherSyncConfigOptions.Merge, "merge", "m", false, "Merge the entries into the existing output file instead of overwriting it")
 	if err := rancherGenerateImagesSyncConfigSubCmd.MarkFlagRequired("images"); err != nil {
 		fmt.Println(err.Error())
 		os.Exit(1)
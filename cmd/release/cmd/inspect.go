@@ -2,19 +2,20 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"text/tabwriter"
 
 	"github.com/google/go-containerregistry/pkg/name"
 	reg "github.com/rancher/ecm-distro-tools/registry"
-	"github.com/rancher/ecm-distro-tools/release"
+	"github.com/rancher/ecm-distro-tools/release/product"
 	"github.com/rancher/ecm-distro-tools/release/rke2"
-	"github.com/rancher/ecm-distro-tools/repository"
 	"github.com/spf13/cobra"
 )
 
@@ -22,26 +23,103 @@ const (
 	ossRegistry = "docker.io"
 )
 
-func archStatus(expected bool, ossInfo, primeInfo reg.Image, platform reg.Platform) string {
+var (
+	inspectAssetsDir string
+	inspectFailOn    []string
+
+	inspectPrimeRegistry string
+)
+
+// inspectFailurePolicies are the conditions inspect can fail on
+var inspectFailurePolicies = map[string]string{
+	"missing":  "images missing from the OSS registry",
+	"platform": "images missing expected platforms",
+	"prime":    "images missing from Prime or differing from the OSS copy",
+}
+
+var inspectConcurrencyLimit int
+
+// archStatus reports whether the image is published for the platform in the OSS
+// registry and, when it was checked, in Prime
+func archStatus(expected bool, result rke2.Image, platform reg.Platform) string {
 	if !expected {
 		return "-"
 	}
 
-	hasArch := ossInfo.Platforms[platform] && primeInfo.Platforms[platform]
+	hasArch := result.OSSImage.HasPlatform(platform) && (!result.PrimeChecked || result.PrimeImage.HasPlatform(platform))
 	if hasArch {
 		return "✓"
 	}
 	return "✗"
 }
 
-func windowsStatus(expected, exists bool) string {
-	if !expected {
+// windowsStatus reports whether the checked registries hold the image for every
+// supported Windows OS build
+func windowsStatus(result rke2.Image) string {
+	if !result.ExpectsWindows {
 		return "-"
 	}
-	if exists {
-		return "✓"
+	for _, platform := range result.RequiredPlatforms() {
+		if platform.OS != "windows" {
+			continue
+		}
+		if !result.OSSImage.HasPlatform(platform) || (result.PrimeChecked && !result.PrimeImage.HasPlatform(platform)) {
+			return "✗"
+		}
 	}
-	return "✗"
+	return "✓"
+}
+
+// inspectFailures returns the number of images failing each of the given policies.
+// Images that couldn't be inspected fail any policy and are counted under "error".
+func inspectFailures(results []rke2.Image, policies []string) map[string]int {
+	failures := make(map[string]int)
+	for _, result := range results {
+		if result.Err != nil {
+			if len(policies) > 0 {
+				failures["error"]++
+			}
+			continue
+		}
+
+		for _, policy := range policies {
+			var failed bool
+			switch policy {
+			case "missing":
+				failed = !result.OSSImage.Exists
+			case "platform":
+				failed = len(result.MissingPlatforms()) > 0
+			case "prime":
+				switch result.Status() {
+				case rke2.StatusOSSOnly, rke2.StatusMismatch, rke2.StatusStale, rke2.StatusMissing:
+					failed = true
+				}
+			}
+			if failed {
+				failures[policy]++
+			}
+		}
+	}
+
+	return failures
+}
+
+// incompleteImages returns the number of images that aren't OK, not counting images
+// that weren't checked against a Prime registry, and whether any image wasn't
+func incompleteImages(results []rke2.Image) (int, bool) {
+	incomplete := 0
+	primeNotChecked := false
+	for _, result := range results {
+		switch result.Status() {
+		case rke2.StatusOK:
+		case rke2.StatusPrimeNotChecked:
+			primeNotChecked = true
+		default:
+			incomplete++
+		}
+	}
+
+	return incomplete, primeNotChecked
 }
 
 func formatImageRef(ref name.Reference) string {
@@ -53,23 +131,21 @@ func table(w io.Writer, results []rke2.Image) {
 		return formatImageRef(results[i].Reference) < formatImageRef(results[j].Reference)
 	})
 
-	missingCount := 0
-	for _, result := range results {
-		if !result.OSSImage.Exists || !result.PrimeImage.Exists {
-			missingCount++
-		}
-	}
-	if missingCount > 0 {
-		fmt.Fprintln(w, missingCount, "incomplete images")
+	incompleteCount, primeNotChecked := incompleteImages(results)
+	if incompleteCount > 0 {
+		fmt.Fprintln(w, incompleteCount, "incomplete images")
 	} else {
 		fmt.Fprintln(w, "all images OK")
 	}
+	if primeNotChecked {
+		fmt.Fprintln(w, "prime registry not checked")
+	}
 
 	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
 	defer tw.Flush()
 
-	fmt.Fprintln(tw, "image\toss\tprime\tsig\tamd64\tarm64\twin")
-	fmt.Fprintln(tw, "-----\t---\t-----\t---\t-----\t-----\t-------")
+	fmt.Fprintln(tw, "image\toss\tprime\tamd64\tarm64\twin\tstatus")
+	fmt.Fprintln(tw, "-----\t---\t-----\t-----\t-----\t---\t------")
 
 	for _, result := range results {
 		ossStatus := "✗"
@@ -77,18 +153,19 @@ func table(w io.Writer, results []rke2.Image) {
 			ossStatus = "✓"
 		}
 		primeStatus := "✗"
-		if result.PrimeImage.Exists {
+		if !result.PrimeChecked {
+			primeStatus = "-"
+		} else if result.PrimeImage.Exists {
 			primeStatus = "✓"
 		}
 		tw.Write([]byte(strings.Join([]string{
 			formatImageRef(result.Reference),
 			ossStatus,
 			primeStatus,
-			"?", // sigstore not implemented
-			archStatus(result.ExpectsLinuxAmd64, result.OSSImage, result.PrimeImage, reg.Platform{OS: "linux", Architecture: "amd64"}),
-			archStatus(result.ExpectsLinuxArm64, result.OSSImage, result.PrimeImage, reg.Platform{OS: "linux", Architecture: "arm64"}),
-			windowsStatus(result.ExpectsWindows, result.OSSImage.Exists && result.PrimeImage.Exists),
-			"",
+			archStatus(result.ExpectsLinuxAmd64, result, reg.Platform{OS: "linux", Architecture: "amd64"}),
+			archStatus(result.ExpectsLinuxArm64, result, reg.Platform{OS: "linux", Architecture: "arm64"}),
+			windowsStatus(result),
+			string(result.Status()),
 		}, "\t") + "\n"))
 	}
 }
@@ -98,7 +175,7 @@ func csv(w io.Writer, results []rke2.Image) {
 		return formatImageRef(results[i].Reference) < formatImageRef(results[j].Reference)
 	})
 
-	fmt.Fprintln(w, "image,oss,prime,sig,amd64,arm64,win")
+	fmt.Fprintln(w, "image,oss,prime,amd64,arm64,win,status")
 
 	for _, result := range results {
 		ossStatus := "N"
@@ -106,14 +183,15 @@ func csv(w io.Writer, results []rke2.Image) {
 			ossStatus = "Y"
 		}
 		primeStatus := "N"
-		if result.PrimeImage.Exists {
+		if !result.PrimeChecked {
+			primeStatus = ""
+		} else if result.PrimeImage.Exists {
 			primeStatus = "Y"
 		}
 
 		amd64Status := ""
 		if result.ExpectsLinuxAmd64 {
-			if result.OSSImage.Platforms[reg.Platform{OS: "linux", Architecture: "amd64"}] &&
-				result.PrimeImage.Platforms[reg.Platform{OS: "linux", Architecture: "amd64"}] {
+			if archStatus(true, result, reg.Platform{OS: "linux", Architecture: "amd64"}) == "✓" {
 				amd64Status = "Y"
 			} else {
 				amd64Status = "N"
@@ -122,8 +200,7 @@ func csv(w io.Writer, results []rke2.Image) {
 
 		arm64Status := ""
 		if result.ExpectsLinuxArm64 {
-			if result.OSSImage.Platforms[reg.Platform{OS: "linux", Architecture: "arm64"}] &&
-				result.PrimeImage.Platforms[reg.Platform{OS: "linux", Architecture: "arm64"}] {
+			if archStatus(true, result, reg.Platform{OS: "linux", Architecture: "arm64"}) == "✓" {
 				arm64Status = "Y"
 			} else {
 				arm64Status = "N"
@@ -132,7 +209,7 @@ func csv(w io.Writer, results []rke2.Image) {
 
 		winStatus := ""
 		if result.ExpectsWindows {
-			if result.OSSImage.Exists && result.PrimeImage.Exists {
+			if windowsStatus(result) == "✓" {
 				winStatus = "Y"
 			} else {
 				winStatus = "N"
@@ -143,40 +220,188 @@ func csv(w io.Writer, results []rke2.Image) {
 			formatImageRef(result.Reference),
 			ossStatus,
 			primeStatus,
-			"?", // sigstore not implemented
 			amd64Status,
 			arm64Status,
 			winStatus,
+			string(result.Status()),
 		}
 		fmt.Fprintln(w, strings.Join(values, ","))
 	}
 }
 
+// inspectImage is the JSON representation of an inspected image
+type inspectImage struct {
+	Image             string          `json:"image"`
+	Status            rke2.Status     `json:"status"`
+	Error             string          `json:"error,omitempty"`
+	ExpectedPlatforms []string        `json:"expectedPlatforms"`
+	MissingPlatforms  []string        `json:"missingPlatforms"`
+	OSS               inspectRegistry `json:"oss"`
+	Prime             inspectRegistry `json:"prime"`
+}
+
+type inspectRegistry struct {
+	Exists  bool              `json:"exists"`
+	Digest  string            `json:"digest,omitempty"`
+	Digests map[string]string `json:"digests,omitempty"`
+}
+
+func newInspectRegistry(image reg.Image) inspectRegistry {
+	r := inspectRegistry{
+		Exists: image.Exists,
+		Digest: image.Digest,
+	}
+	if len(image.Digests) > 0 {
+		r.Digests = make(map[string]string, len(image.Digests))
+		for platform, digest := range image.Digests {
+			r.Digests[platform.String()] = digest
+		}
+	}
+
+	return r
+}
+
+func jsonOutput(w io.Writer, results []rke2.Image) error {
+	sort.Slice(results, func(i, j int) bool {
+		return formatImageRef(results[i].Reference) < formatImageRef(results[j].Reference)
+	})
+
+	images := make([]inspectImage, 0, len(results))
+	for _, result := range results {
+		required := result.RequiredPlatforms()
+		expected := make([]string, 0, len(required))
+		for _, platform := range required {
+			expected = append(expected, platform.String())
+		}
+
+		missing := make([]string, 0)
+		for _, platform := range result.MissingPlatforms() {
+			missing = append(missing, platform.String())
+		}
+
+		var errMsg string
+		if result.Err != nil {
+			errMsg = result.Err.Error()
+		}
+
+		images = append(images, inspectImage{
+			Image:             formatImageRef(result.Reference),
+			Status:            result.Status(),
+			Error:             errMsg,
+			ExpectedPlatforms: expected,
+			MissingPlatforms:  missing,
+			OSS:               newInspectRegistry(result.OSSImage),
+			Prime:             newInspectRegistry(result.PrimeImage),
+		})
+	}
+
+	b, err := json.MarshalIndent(images, "", " ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(b))
+
+	return err
+}
+
+func markdown(w io.Writer, results []rke2.Image) {
+	sort.Slice(results, func(i, j int) bool {
+		return formatImageRef(results[i].Reference) < formatImageRef(results[j].Reference)
+	})
+
+	mark := func(ok bool) string {
+		if ok {
+			return ":white_check_mark:"
+		}
+		return ":x:"
+	}
+	platformMark := func(status string) string {
+		switch status {
+		case "✓":
+			return mark(true)
+		case "✗":
+			return mark(false)
+		}
+		return status
+	}
+
+	incompleteCount, primeNotChecked := incompleteImages(results)
+	if incompleteCount > 0 {
+		fmt.Fprintf(w, "**%d incomplete images**\n\n", incompleteCount)
+	} else {
+		fmt.Fprint(w, "**all images OK**\n\n")
+	}
+	if primeNotChecked {
+		fmt.Fprint(w, "prime registry not checked\n\n")
+	}
+
+	fmt.Fprintln(w, "| image | oss | prime | amd64 | arm64 | win | status |")
+	fmt.Fprintln(w, "| --- | :---: | :---: | :---: | :---: | :---: | --- |")
+
+	for _, result := range results {
+		primeMark := "-"
+		if result.PrimeChecked {
+			primeMark = mark(result.PrimeImage.Exists)
+		}
+		fmt.Fprintln(w, "| `"+formatImageRef(result.Reference)+"` | "+strings.Join([]string{
+			mark(result.OSSImage.Exists),
+			primeMark,
+			platformMark(archStatus(result.ExpectsLinuxAmd64, result, reg.Platform{OS: "linux", Architecture: "amd64"})),
+			platformMark(archStatus(result.ExpectsLinuxArm64, result, reg.Platform{OS: "linux", Architecture: "arm64"})),
+			platformMark(windowsStatus(result)),
+			string(result.Status()),
+		}, " | ")+" |")
+	}
+}
+
 var inspectCmd = &cobra.Command{
 	Use:   "inspect [version]",
 	Short: "Inspect release artifacts",
 	Long: `Inspect release artifacts for a given version.
-Currently supports inspecting the image list for published rke2 releases.`,
+Supports inspecting the image lists of rke2, k3s and rancher releases, either
+published on GitHub or from a local directory containing the release assets.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) < 1 {
 			return errors.New("expected at least one argument: [version]")
 		}
 
+		if inspectPrimeRegistry == "" {
+			inspectPrimeRegistry = rootConfig.PrimeRegistry
+		}
+
+		for _, policy := range inspectFailOn {
+			if _, ok := inspectFailurePolicies[policy]; !ok {
+				return errors.New("invalid --fail-on policy: " + policy)
+			}
+			if policy == "prime" && inspectPrimeRegistry == "" {
+				return errors.New("--fail-on prime requires a prime registry")
+			}
+		}
+
+		p, err := product.ForVersion(args[0])
+		if err != nil {
+			return err
+		}
+
 		ctx := context.Background()
-		gh := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
-		filesystem, err := release.NewFS(ctx, gh, "rancher", "rke2", args[0])
+
+		// a local build output or an air-gapped copy of the release assets
+		// can be inspected before the release is published
+		filesystem, err := releaseAssetsFS(ctx, p.Name, args[0], inspectAssetsDir)
 		if err != nil {
 			return err
 		}
 
-		ossClient := reg.NewClient(ossRegistry, debug)
+		ossClient := newRegistryClient(ossRegistry)
 
-		var primeClient *reg.Client
-		if rootConfig.PrimeRegistry != "" {
-			primeClient = reg.NewClient(rootConfig.PrimeRegistry, debug)
+		var primeClient rke2.RegistryClient
+		if inspectPrimeRegistry != "" {
+			primeClient = newRegistryClient(inspectPrimeRegistry)
 		}
 
-		inspector := rke2.NewReleaseInspector(filesystem, ossClient, primeClient, debug)
+		inspector := rke2.NewProductReleaseInspector(p, filesystem, ossClient, primeClient, debug)
+		inspector.ConcurrencyLimit = inspectConcurrencyLimit
+		inspector.Progress = os.Stderr
 
 		results, err := inspector.InspectRelease(ctx, args[0])
 		if err != nil {
@@ -187,15 +412,49 @@ Currently supports inspecting the image list for published rke2 releases.`,
 		switch outputFormat {
 		case "csv":
 			csv(os.Stdout, results)
-		default:
+		case "json":
+			if err := jsonOutput(os.Stdout, results); err != nil {
+				return err
+			}
+		case "markdown":
+			markdown(os.Stdout, results)
+		case "table":
 			table(os.Stdout, results)
+		default:
+			return errors.New("unrecognized output format: " + outputFormat)
+		}
+
+		for _, result := range results {
+			if result.Err != nil {
+				fmt.Fprintln(os.Stderr, formatImageRef(result.Reference)+": "+result.Err.Error())
+			}
+		}
+
+		failures := inspectFailures(results, inspectFailOn)
+		if len(failures) == 0 {
+			return nil
+		}
+
+		var reasons []string
+		if count, ok := failures["error"]; ok {
+			reasons = append(reasons, strconv.Itoa(count)+" images that couldn't be inspected")
+		}
+		for _, policy := range inspectFailOn {
+			if count, ok := failures[policy]; ok {
+				reasons = append(reasons, strconv.Itoa(count)+" "+inspectFailurePolicies[policy])
+			}
 		}
 
-		return nil
+		return errors.New("inspection failed: " + strings.Join(reasons, ", "))
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(inspectCmd)
-	inspectCmd.Flags().StringP("output", "o", "table", "Output format (table|csv)")
+	inspectCmd.Flags().StringP("output", "o", "table", "Output format (table|csv|json|markdown)")
+	inspectCmd.Flags().StringVar(&inspectPrimeRegistry, "prime-registry", "", "Prime registry to inspect, defaults to the prime_registry in the config")
+	inspectCmd.Flags().IntVarP(&inspectConcurrencyLimit, "concurrency-limit", "l", rke2.DefaultConcurrencyLimit, "Number of images inspected at once")
+	inspectCmd.Flags().StringSliceVar(&inspectFailOn, "fail-on", nil, "Exit with an error if images fail any of the policies (missing|platform|prime)")
+	inspectCmd.Flags().StringVar(&inspectAssetsDir, "assets-dir", "", "Local directory with the release assets, instead of the published GitHub release")
+	inspectCmd.Flags().StringVar(&releaseOwner, "owner", "", "Owner of the release repository, defaults to the product's owner")
 }
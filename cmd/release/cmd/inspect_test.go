@@ -3,6 +3,7 @@ package cmd
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"io/fs"
 	"os"
 	"testing"
@@ -97,6 +98,162 @@ func TestInspectAndCSVOutput(t *testing.T) {
 	}
 }
 
+func TestInspectFailures(t *testing.T) {
+	amd64 := reg.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := reg.Platform{OS: "linux", Architecture: "arm64"}
+
+	complete := rke2.Image{
+		ReleaseImage: rke2.ReleaseImage{
+			Reference:         mustParseRef("rancher/rke2-runtime:v1.23.4-rke2r1"),
+			ExpectsLinuxAmd64: true,
+			ExpectsLinuxArm64: true,
+		},
+		OSSImage:     reg.Image{Exists: true, Digest: "sha256:a", Platforms: map[reg.Platform]bool{amd64: true, arm64: true}},
+		PrimeImage:   reg.Image{Exists: true, Digest: "sha256:a", Platforms: map[reg.Platform]bool{amd64: true, arm64: true}},
+		PrimeChecked: true,
+	}
+	ossOnly := rke2.Image{
+		ReleaseImage: rke2.ReleaseImage{
+			Reference:         mustParseRef("rancher/rke2-cloud-provider:v1.23.4-rke2r1"),
+			ExpectsLinuxAmd64: true,
+			ExpectsLinuxArm64: true,
+		},
+		OSSImage:     reg.Image{Exists: true, Digest: "sha256:b", Platforms: map[reg.Platform]bool{amd64: true}},
+		PrimeChecked: true,
+	}
+	missing := rke2.Image{
+		ReleaseImage: rke2.ReleaseImage{
+			Reference:      mustParseRef("rancher/rke2-runtime-windows:v1.23.4-rke2r1"),
+			ExpectsWindows: true,
+		},
+		PrimeChecked: true,
+	}
+
+	tests := []struct {
+		name     string
+		results  []rke2.Image
+		policies []string
+		want     map[string]int
+	}{
+		{
+			name:     "no policies",
+			results:  []rke2.Image{complete, ossOnly, missing},
+			policies: nil,
+			want:     map[string]int{},
+		},
+		{
+			name:     "complete release",
+			results:  []rke2.Image{complete},
+			policies: []string{"missing", "platform", "prime"},
+			want:     map[string]int{},
+		},
+		{
+			name:     "missing",
+			results:  []rke2.Image{complete, ossOnly, missing},
+			policies: []string{"missing"},
+			want:     map[string]int{"missing": 1},
+		},
+		{
+			name:     "platform",
+			results:  []rke2.Image{complete, ossOnly, missing},
+			policies: []string{"platform"},
+			want:     map[string]int{"platform": 2},
+		},
+		{
+			name:     "prime",
+			results:  []rke2.Image{complete, ossOnly, missing},
+			policies: []string{"prime"},
+			want:     map[string]int{"prime": 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := inspectFailures(tt.results, tt.policies)
+			if len(got) != len(tt.want) {
+				t.Fatalf("inspectFailures() = %v, want %v", got, tt.want)
+			}
+			for policy, count := range tt.want {
+				if got[policy] != count {
+					t.Errorf("inspectFailures()[%q] = %d, want %d", policy, got[policy], count)
+				}
+			}
+		})
+	}
+}
+
+func TestMarkdownAndJSONOutput(t *testing.T) {
+	results := []rke2.Image{
+		{
+			ReleaseImage: rke2.ReleaseImage{
+				Reference:         mustParseRef("rancher/rke2-cloud-provider:v1.23.4-rke2r1"),
+				ExpectsLinuxAmd64: true,
+			},
+			OSSImage: reg.Image{
+				Exists:    true,
+				Digest:    "sha256:b",
+				Platforms: map[reg.Platform]bool{{OS: "linux", Architecture: "amd64"}: true},
+			},
+			PrimeChecked: true,
+		},
+	}
+
+	var md bytes.Buffer
+	markdown(&md, results)
+	wantMarkdown := "**1 incomplete images**\n\n" +
+		"| image | oss | prime | amd64 | arm64 | win | status |\n" +
+		"| --- | :---: | :---: | :---: | :---: | :---: | --- |\n" +
+		"| `rancher/rke2-cloud-provider:v1.23.4-rke2r1` | :white_check_mark: | :x: | :x: | - | - | oss-only |\n"
+	if got := md.String(); got != wantMarkdown {
+		t.Errorf("markdown() output = %q, want %q", got, wantMarkdown)
+	}
+
+	var out bytes.Buffer
+	if err := jsonOutput(&out, results); err != nil {
+		t.Fatalf("jsonOutput() error = %v", err)
+	}
+	var images []inspectImage
+	if err := json.Unmarshal(out.Bytes(), &images); err != nil {
+		t.Fatalf("failed to decode json output: %v", err)
+	}
+	if len(images) != 1 {
+		t.Fatalf("jsonOutput() returned %d images, want 1", len(images))
+	}
+	if images[0].Status != rke2.StatusOSSOnly || !images[0].OSS.Exists || images[0].Prime.Exists {
+		t.Errorf("jsonOutput() image = %+v", images[0])
+	}
+	if len(images[0].MissingPlatforms) != 0 {
+		t.Errorf("jsonOutput() missing platforms = %v, want none", images[0].MissingPlatforms)
+	}
+}
+
+func TestTablePrimeNotChecked(t *testing.T) {
+	results := []rke2.Image{
+		{
+			ReleaseImage: rke2.ReleaseImage{
+				Reference:         mustParseRef("rancher/rke2-cloud-provider:v1.23.4-rke2r1"),
+				ExpectsLinuxAmd64: true,
+			},
+			OSSImage: reg.Image{
+				Exists:    true,
+				Digest:    "sha256:b",
+				Platforms: map[reg.Platform]bool{{OS: "linux", Architecture: "amd64"}: true},
+			},
+		},
+	}
+
+	var out bytes.Buffer
+	table(&out, results)
+	want := "all images OK\n" +
+		"prime registry not checked\n" +
+		"image                                       oss  prime  amd64  arm64  win  status\n" +
+		"-----                                       ---  -----  -----  -----  ---  ------\n" +
+		"rancher/rke2-cloud-provider:v1.23.4-rke2r1  ✓    -      ✓      -      -    prime-not-checked\n"
+	if got := out.String(); got != want {
+		t.Errorf("table() output = %q, want %q", got, want)
+	}
+}
+
 func mustParseRef(s string) name.Reference {
 	ref, err := name.ParseReference(s)
 	if err != nil {
@@ -2,12 +2,15 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"strconv"
 
 	"github.com/rancher/ecm-distro-tools/release/charts"
-	"github.com/rancher/ecm-distro-tools/release/rancher"
+	"github.com/rancher/ecm-distro-tools/release/rcdeps"
+	"github.com/rancher/ecm-distro-tools/repository"
 	"github.com/spf13/cobra"
 )
 
@@ -22,27 +25,81 @@ var rancherListSubCmd = &cobra.Command{
 	Short: "List Rancher Utilities",
 }
 
-var rancherListRCDepsSubCmd = &cobra.Command{
-	Use:   "rc-deps [git-ref]",
-	Short: "List Rancher RC Deps",
-	RunE: func(cmd *cobra.Command, args []string) error {
-		if len(args) < 1 {
-			return errors.New("expected at least one argument: [git-ref]")
-		}
-
-		rancherRCDeps, err := rancher.CheckRancherRCDeps(context.Background(), "rancher", args[0])
-		if err != nil {
-			return err
-		}
-
-		deps, err := rancherRCDeps.ToString()
-		if err != nil {
-			return err
-		}
-		fmt.Println(deps)
+var (
+	rcDepsRulesFile string
+	rcDepsLocalDir  string
+	rcDepsOutput    string
+)
 
-		return nil
-	},
+// newRCDepsSubCmd creates the rc-deps command listing the pre-release dependencies of a product
+func newRCDepsSubCmd(product rcdeps.Product) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rc-deps [git-ref]",
+		Short: "List " + product.Name + " RC and dev dependencies",
+		Long: `List the -rc and dev branch dependencies left in ` + product.Owner + "/" + product.Repo + `, failing if any
+blocking dependency remains. The files and patterns checked are read from the
+YAML rule file given with --rules, or the default ` + product.Name + ` rules.`,
+		Example: "release list " + product.Name + " rc-deps main\nrelease list " + product.Name + " rc-deps --local . --rules rc-deps.yaml -o json",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 && rcDepsLocalDir == "" {
+				return errors.New("expected at least one argument: [git-ref]")
+			}
+
+			rules, err := product.Rules()
+			if rcDepsRulesFile != "" {
+				rules, err = rcdeps.LoadRulesFile(rcDepsRulesFile)
+			}
+			if err != nil {
+				return err
+			}
+
+			var report *rcdeps.Report
+			if rcDepsLocalDir != "" {
+				report, err = rcdeps.ScanLocal(rcDepsLocalDir, rules)
+			} else {
+				ctx := context.Background()
+				owner := releaseOwner
+				if owner == "" {
+					owner = product.Owner
+				}
+				report, err = rcdeps.ScanRemote(ctx, repository.NewGithub(ctx, rootConfig.Auth.GithubToken), owner, product.Repo, args[0], rules)
+			}
+			if err != nil {
+				return err
+			}
+			report.Product = product.Name
+
+			switch rcDepsOutput {
+			case "json":
+				b, err := json.MarshalIndent(report, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(b))
+			case "text":
+				deps, err := report.ToString()
+				if err != nil {
+					return err
+				}
+				fmt.Println(deps)
+			default:
+				return errors.New("unrecognized output format: " + rcDepsOutput)
+			}
+
+			if blocking := report.Blocking(); blocking > 0 {
+				return errors.New("found " + strconv.Itoa(blocking) + " blocking rc dependencies")
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&rcDepsRulesFile, "rules", "", "YAML rule file with the files, patterns, categories and ignore rules, defaults to the "+product.Name+" rules")
+	cmd.Flags().StringVar(&rcDepsLocalDir, "local", "", "Local checkout to scan instead of a GitHub ref")
+	cmd.Flags().StringVarP(&rcDepsOutput, "output", "o", "text", "Output format (text|json)")
+	cmd.Flags().StringVar(&releaseOwner, "owner", "", "Owner of the repository, defaults to "+product.Owner)
+
+	return cmd
 }
 
 var chartsListSubCmd = &cobra.Command{
@@ -89,7 +146,15 @@ var chartsListSubCmd = &cobra.Command{
 }
 
 func init() {
-	rancherListSubCmd.AddCommand(rancherListRCDepsSubCmd)
+	rancherListSubCmd.AddCommand(newRCDepsSubCmd(rcdeps.Rancher))
+	for _, product := range []rcdeps.Product{rcdeps.K3s, rcdeps.RKE2, rcdeps.Dashboard} {
+		productListSubCmd := &cobra.Command{
+			Use:   product.Name,
+			Short: "List " + product.Name + " Utilities",
+		}
+		productListSubCmd.AddCommand(newRCDepsSubCmd(product))
+		listCmd.AddCommand(productListSubCmd)
+	}
 	listCmd.AddCommand(rancherListSubCmd)
 	listCmd.AddCommand(chartsListSubCmd)
 	rootCmd.AddCommand(listCmd)
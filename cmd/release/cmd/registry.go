@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	reg "github.com/rancher/ecm-distro-tools/registry"
+)
+
+// registryOptions returns the registry client options for the credentials and
+// insecure registries from the config
+func registryOptions() []reg.Option {
+	var options []reg.Option
+	if rootConfig.Auth != nil {
+		for host, credential := range rootConfig.Auth.Registries {
+			options = append(options, reg.WithCredentials(host, credential.Username, credential.Password))
+		}
+	}
+	if len(rootConfig.InsecureRegistries) > 0 {
+		options = append(options, reg.WithInsecureRegistries(rootConfig.InsecureRegistries...))
+	}
+
+	return options
+}
+
+// newRegistryClient creates a registry client using the credentials and
+// insecure registries from the config
+func newRegistryClient(registry string) *reg.Client {
+	return reg.NewClient(registry, debug, registryOptions()...)
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+
+	"github.com/google/go-github/v39/github"
+	"github.com/rancher/ecm-distro-tools/release"
+	"github.com/rancher/ecm-distro-tools/repository"
+)
+
+// productRepository returns the github owner and repository of a product.
+// The owner can be overridden with the --owner flag to work with forks.
+func productRepository(product string) (string, string, error) {
+	owner, ok := repoToOwner[product]
+	if !ok {
+		return "", "", errors.New("unsupported product: " + product)
+	}
+
+	if releaseOwner != "" {
+		owner = releaseOwner
+	}
+
+	return owner, product, nil
+}
+
+// newReleaseFS creates a filesystem for the assets of a GitHub release, caching the
+// small downloaded assets, like images lists and checksums, when --cache-dir is set.
+func newReleaseFS(ctx context.Context, client *github.Client, owner, repo, tag string) (*release.FS, error) {
+	if assetsCacheDir == "" {
+		return release.NewFS(ctx, client, owner, repo, tag)
+	}
+
+	return release.NewCachedFS(ctx, client, owner, repo, tag, assetsCacheDir, release.DefaultCacheMaxSize)
+}
+
+// releaseAssetsFS returns the assets of a release from a local directory when set, or from GitHub
+func releaseAssetsFS(ctx context.Context, product, tag, assetsDir string) (fs.FS, error) {
+	if assetsDir != "" {
+		return os.DirFS(assetsDir), nil
+	}
+
+	owner, repo, err := productRepository(product)
+	if err != nil {
+		return nil, err
+	}
+	client := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
+
+	return newReleaseFS(ctx, client, owner, repo, tag)
+}
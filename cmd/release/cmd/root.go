@@ -10,12 +10,14 @@ import (
 )
 
 var (
-	debug        bool
-	dryRun       bool
-	rootConfig   *config.Config
-	verbose      bool
-	configFile   string
-	stringConfig string
+	debug          bool
+	dryRun         bool
+	rootConfig     *config.Config
+	verbose        bool
+	configFile     string
+	stringConfig   string
+	assetsCacheDir string
+	releaseOwner   string
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -46,6 +48,7 @@ func init() {
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "V", false, "Verbose output")
 	rootCmd.PersistentFlags().StringVarP(&configFile, "config-file", "c", "$HOME/.ecm-distro-tools/config.json", "Path for the config.json file")
 	rootCmd.PersistentFlags().StringVarP(&stringConfig, "config", "C", "", "JSON config string")
+	rootCmd.PersistentFlags().StringVar(&assetsCacheDir, "cache-dir", "", "Directory to cache small downloaded release assets like images lists and checksums, caching is disabled when empty")
 }
 
 func initConfig() {
@@ -0,0 +1,255 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rancher/ecm-distro-tools/release/product"
+	"github.com/rancher/ecm-distro-tools/release/scan"
+	"github.com/rancher/ecm-distro-tools/repository"
+	"github.com/spf13/cobra"
+)
+
+var (
+	scanReportsDir         string
+	scanPreviousReportsDir string
+	scanAssetsDir          string
+	scanOutput             string
+	scanFailAbove          string
+)
+
+// scanResult is the JSON output of scan images
+type scanResult struct {
+	*scan.Summary
+	Unscanned []string         `json:"unscanned,omitempty"`
+	Diff      []scan.ImageDiff `json:"diff,omitempty"`
+}
+
+var scanCmd = &cobra.Command{
+	Use:   "scan",
+	Short: "Summarize vulnerability scans of releases",
+}
+
+var scanImagesSubCmd = &cobra.Command{
+	Use:   "images [product] [tag]",
+	Short: "Summarize the CVEs of the images of a release",
+	Long: `Summarize the vulnerabilities of the images of a rke2, k3s or rancher release, per image and
+per severity. The images are read from the release image lists, and matched to the Trivy or
+Grype JSON reports found in --reports-dir, which are produced offline, e.g. with
+"trivy image -f json -o rke2-runtime.json rancher/rke2-runtime:v1.30.4-rke2r1".
+
+With --previous-reports-dir the summary is compared with the reports of the previous release,
+listing the CVEs added and fixed in each image. With --fail-above the command fails if any
+image has vulnerabilities more severe than the given severity.`,
+	Example: "release scan images rke2 v1.30.4+rke2r1 --reports-dir ./reports --fail-above medium",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return errors.New("expected at least two arguments: [product] [tag]")
+		}
+		productName, tag := args[0], args[1]
+
+		p, ok := product.Products[productName]
+		if !ok {
+			return errors.New("unsupported product: " + productName)
+		}
+
+		var threshold scan.Severity
+		if scanFailAbove != "" {
+			var err error
+			if threshold, err = scan.ParseSeverity(scanFailAbove); err != nil {
+				return err
+			}
+		}
+
+		var filesystem fs.FS
+		if scanAssetsDir != "" {
+			filesystem = os.DirFS(scanAssetsDir)
+		} else {
+			owner, repo, err := productRepository(productName)
+			if err != nil {
+				return err
+			}
+
+			ctx := context.Background()
+			client := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
+
+			filesystem, err = newReleaseFS(ctx, client, owner, repo, tag)
+			if err != nil {
+				return err
+			}
+		}
+
+		images, err := p.Images(filesystem)
+		if err != nil {
+			return err
+		}
+		if len(images) == 0 {
+			return errors.New("no images found in the image lists of " + productName + " " + tag)
+		}
+
+		reports, err := scan.LoadReports(os.DirFS(scanReportsDir))
+		if err != nil {
+			return err
+		}
+
+		result := scanResult{Summary: scan.Summarize(productName, tag, images, reports)}
+		result.Unscanned = result.Summary.Unscanned()
+
+		if scanPreviousReportsDir != "" {
+			previousReports, err := scan.LoadReports(os.DirFS(scanPreviousReportsDir))
+			if err != nil {
+				return err
+			}
+			result.Diff = scan.Diff(scan.Summarize(productName, "", nil, previousReports), result.Summary)
+		}
+
+		switch scanOutput {
+		case "json":
+			b, err := json.MarshalIndent(result, "", " ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(b))
+		case "markdown":
+			scanMarkdown(os.Stdout, result)
+		default:
+			scanTable(os.Stdout, result)
+		}
+
+		if scanFailAbove == "" {
+			return nil
+		}
+		if failed := result.Summary.Above(threshold); len(failed) > 0 {
+			return errors.New(strconv.Itoa(len(failed)) + " images have vulnerabilities above " + threshold.String() + " severity")
+		}
+
+		return nil
+	},
+}
+
+// scanSeverities are the severities shown in the summary columns
+var scanSeverities = []scan.Severity{scan.SeverityCritical, scan.SeverityHigh, scan.SeverityMedium, scan.SeverityLow}
+
+// severityCounts formats the counts of the summary severities, folding
+// negligible and unknown vulnerabilities into the last column
+func severityCounts(counts map[scan.Severity]int) []string {
+	columns := make([]string, 0, len(scanSeverities)+1)
+	for _, severity := range scanSeverities {
+		columns = append(columns, strconv.Itoa(counts[severity]))
+	}
+
+	return append(columns, strconv.Itoa(counts[scan.SeverityNegligible]+counts[scan.SeverityUnknown]))
+}
+
+func scanTable(w io.Writer, result scanResult) {
+	fmt.Fprintln(w, result.Product, result.Version, "vulnerabilities:", strings.Join(severityTotals(result.Counts), ", "))
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "image\tcritical\thigh\tmedium\tlow\tother")
+	fmt.Fprintln(tw, "-----\t--------\t----\t------\t---\t-----")
+	for _, image := range result.Images {
+		if !image.Scanned {
+			continue
+		}
+		fmt.Fprintln(tw, image.Image+"\t"+strings.Join(severityCounts(image.Counts), "\t"))
+	}
+	tw.Flush()
+
+	if len(result.Unscanned) > 0 {
+		fmt.Fprintln(w, "\nnot scanned:")
+		for _, image := range result.Unscanned {
+			fmt.Fprintln(w, "  "+image)
+		}
+	}
+
+	if len(result.Diff) > 0 {
+		fmt.Fprintln(w, "\nchanges since the previous release:")
+		for _, diff := range result.Diff {
+			fmt.Fprintln(w, "  "+diff.Image)
+			for _, v := range diff.Added {
+				fmt.Fprintln(w, "    + "+v.ID+" ("+v.Severity.String()+") "+v.Package)
+			}
+			for _, v := range diff.Fixed {
+				fmt.Fprintln(w, "    - "+v.ID+" ("+v.Severity.String()+") "+v.Package)
+			}
+		}
+	}
+}
+
+func scanMarkdown(w io.Writer, result scanResult) {
+	fmt.Fprintf(w, "### %s %s vulnerabilities\n\n", result.Product, result.Version)
+	fmt.Fprintln(w, strings.Join(severityTotals(result.Counts), ", ")+"\n")
+
+	fmt.Fprintln(w, "| image | critical | high | medium | low | other |")
+	fmt.Fprintln(w, "| --- | ---: | ---: | ---: | ---: | ---: |")
+	for _, image := range result.Images {
+		if !image.Scanned {
+			continue
+		}
+		fmt.Fprintln(w, "| `"+image.Image+"` | "+strings.Join(severityCounts(image.Counts), " | ")+" |")
+	}
+
+	if len(result.Unscanned) > 0 {
+		fmt.Fprint(w, "\n**Not scanned**\n\n")
+		for _, image := range result.Unscanned {
+			fmt.Fprintln(w, "- `"+image+"`")
+		}
+	}
+
+	if len(result.Diff) > 0 {
+		fmt.Fprint(w, "\n**Changes since the previous release**\n\n")
+		fmt.Fprintln(w, "| image | added | fixed |")
+		fmt.Fprintln(w, "| --- | --- | --- |")
+		for _, diff := range result.Diff {
+			fmt.Fprintln(w, "| `"+diff.Image+"` | "+vulnerabilityIDs(diff.Added)+" | "+vulnerabilityIDs(diff.Fixed)+" |")
+		}
+	}
+}
+
+func severityTotals(counts map[scan.Severity]int) []string {
+	totals := make([]string, 0, len(scan.Severities))
+	for _, severity := range scan.Severities {
+		if counts[severity] > 0 {
+			totals = append(totals, strconv.Itoa(counts[severity])+" "+severity.String())
+		}
+	}
+	if len(totals) == 0 {
+		return []string{"none"}
+	}
+
+	return totals
+}
+
+func vulnerabilityIDs(vulnerabilities []scan.Vulnerability) string {
+	ids := make([]string, 0, len(vulnerabilities))
+	for _, v := range vulnerabilities {
+		ids = append(ids, v.ID+" ("+v.Severity.String()+")")
+	}
+
+	return strings.Join(ids, "<br>")
+}
+
+func init() {
+	rootCmd.AddCommand(scanCmd)
+
+	scanCmd.AddCommand(scanImagesSubCmd)
+
+	scanImagesSubCmd.Flags().StringVarP(&scanReportsDir, "reports-dir", "d", "", "Directory with the Trivy or Grype JSON reports of the release images")
+	if err := scanImagesSubCmd.MarkFlagRequired("reports-dir"); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	scanImagesSubCmd.Flags().StringVar(&scanPreviousReportsDir, "previous-reports-dir", "", "Directory with the reports of the previous release, to list added and fixed CVEs")
+	scanImagesSubCmd.Flags().StringVar(&scanAssetsDir, "assets-dir", "", "Local directory with the release assets, instead of the published GitHub release")
+	scanImagesSubCmd.Flags().StringVarP(&scanOutput, "output", "o", "table", "Output format (table|json|markdown)")
+	scanImagesSubCmd.Flags().StringVar(&scanFailAbove, "fail-above", "", "Exit with an error if any image has vulnerabilities above the severity (negligible|low|medium|high)")
+	scanImagesSubCmd.Flags().StringVar(&releaseOwner, "owner", "", "Owner of the release repository, defaults to the product's owner")
+}
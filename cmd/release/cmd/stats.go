@@ -23,9 +23,10 @@ var (
 )
 
 var repoToOwner = map[string]string{
-	"rke2":    "rancher",
-	"rancher": "rancher",
-	"k3s":     "k3s-io",
+	"rke2":           "rancher",
+	"rke2-packaging": "rancher",
+	"rancher":        "rancher",
+	"k3s":            "k3s-io",
 }
 
 // statsCmd represents the stats command
@@ -2,11 +2,20 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	reg "github.com/rancher/ecm-distro-tools/registry"
 	"github.com/rancher/ecm-distro-tools/release/imagebuild"
+	"github.com/rancher/ecm-distro-tools/release/prime"
 	"github.com/rancher/ecm-distro-tools/repository"
 	"github.com/spf13/cobra"
 )
@@ -17,6 +26,20 @@ var (
 	upstreamOwner     string
 	upstreamRepo      string
 	upstreamTagPrefix string
+
+	syncAssetsEndpoint         string
+	syncAssetsArtifactsDir     string
+	syncAssetsIndexWriteToPath string
+	syncAssetsConcurrencyLimit int
+	syncAssetsJSONOutput       bool
+
+	syncImagesSource           string
+	syncImagesTarget           string
+	syncImagesLocationsFile    string
+	syncImagesFile             string
+	syncImagesStateFile        string
+	syncImagesConcurrencyLimit int
+	syncImagesJSONOutput       bool
 )
 
 var syncCmd = &cobra.Command{
@@ -40,10 +63,270 @@ var syncImageBuildCmd = &cobra.Command{
 	},
 }
 
+var syncAssetsCmd = &cobra.Command{
+	Use:   "assets [product] [tag]",
+	Short: "Mirror the assets of a release into the prime artifacts bucket",
+	Long: `Mirror the assets of a rke2, k3s or rancher release from GitHub into the prime artifacts
+bucket, under <product>/<tag>/. Assets are verified against the release checksum files before
+being stored, assets already stored with the same checksum are skipped, and the artifacts index
+is regenerated afterwards. Assets without a published checksum are skipped when they're stored
+with the same size and source modification time. Use --endpoint to mirror into an S3-compatible
+stand-in, or --artifacts-dir to mirror into a local directory. Use the global --dry-run flag to
+list the assets that would be copied.`,
+	Example: "release sync assets rke2 v1.30.4+rke2r1 --endpoint http://localhost:9000",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return errors.New("expected at least two arguments: [product] [tag]")
+		}
+		product, tag := args[0], args[1]
+
+		owner, repo, err := productRepository(product)
+		if err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+		client := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
+
+		filesystem, err := newReleaseFS(ctx, client, owner, repo, tag)
+		if err != nil {
+			return err
+		}
+
+		var store prime.ArtifactStore
+		if syncAssetsArtifactsDir != "" {
+			store = prime.NewArtifactDir(syncAssetsArtifactsDir)
+		} else {
+			s3Client, err := newPrimeArtifactsClient(ctx, syncAssetsEndpoint)
+			if err != nil {
+				return err
+			}
+			store = prime.NewArtifactBucket(s3Client)
+		}
+
+		result, err := prime.MirrorRelease(ctx, filesystem, product, tag, store, prime.MirrorOptions{
+			ConcurrencyLimit: syncAssetsConcurrencyLimit,
+			DryRun:           dryRun,
+		})
+		if err != nil {
+			return err
+		}
+
+		if syncAssetsJSONOutput {
+			b, err := json.MarshalIndent(result, "", " ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(b))
+		} else if dryRun {
+			for _, key := range result.Copied {
+				fmt.Println("would copy: " + key)
+			}
+			fmt.Println("dry run: " + strconv.Itoa(len(result.Copied)) + " would be copied, " + strconv.Itoa(len(result.Skipped)) + " already up to date")
+		} else {
+			for _, key := range result.Copied {
+				fmt.Println("copied:  " + key)
+			}
+			for _, key := range result.Skipped {
+				fmt.Println("skipped: " + key)
+			}
+			fmt.Println(strconv.Itoa(len(result.Copied)) + " copied, " + strconv.Itoa(len(result.Skipped)) + " already up to date")
+		}
+
+		if dryRun {
+			return nil
+		}
+
+		return prime.GenerateArtifactsIndex(ctx, syncAssetsIndexWriteToPath, artifactsIndexKnownOmissions, store)
+	},
+}
+
+var syncImagesCmd = &cobra.Command{
+	Use:   "images",
+	Short: "Copy images between registries",
+	Long: `Copy images from a source to a target registry, keeping multi-arch indexes and digests intact.
+Images already in the target with the same digest are skipped.
+
+The images are read from an image list file with --images-file, copied from --source, or from
+the JSON output of 'release generate rancher images-locations' with --images-locations, copied
+from the registry they were located in, or only from --source when set.
+
+Copied images are recorded in --state-file, so an interrupted copy can be resumed. Use the
+global --dry-run flag to list the images that would be copied.`,
+	Example: "release sync images --images-locations locations.json --target registry.rancher.com --state-file sync-state.json",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if (syncImagesFile == "") == (syncImagesLocationsFile == "") {
+			return errors.New("either --images-file or --images-locations must be provided")
+		}
+
+		imagesBySource := make(map[string][]string)
+		if syncImagesFile != "" {
+			if syncImagesSource == "" {
+				return errors.New("--source is required with --images-file")
+			}
+			images, err := readImagesFile(syncImagesFile)
+			if err != nil {
+				return err
+			}
+			imagesBySource[syncImagesSource] = images
+		} else {
+			b, err := os.ReadFile(syncImagesLocationsFile)
+			if err != nil {
+				return err
+			}
+			var locations map[string][]string
+			if err := json.Unmarshal(b, &locations); err != nil {
+				return errors.New("invalid images locations file: " + err.Error())
+			}
+			for registry, images := range locations {
+				// missing images aren't in any of the registries
+				if registry == "missing" || registry == syncImagesTarget {
+					continue
+				}
+				if syncImagesSource != "" && registry != syncImagesSource {
+					continue
+				}
+				imagesBySource[registry] = images
+			}
+		}
+
+		sources := make([]string, 0, len(imagesBySource))
+		for source := range imagesBySource {
+			sources = append(sources, source)
+		}
+		sort.Strings(sources)
+
+		ctx := context.Background()
+		target := newRegistryClient(syncImagesTarget)
+		summary := &reg.CopySummary{
+			Copied:  make([]reg.CopyResult, 0),
+			Skipped: make([]reg.CopyResult, 0),
+			Failed:  make([]reg.CopyResult, 0),
+		}
+		for _, source := range sources {
+			s, err := reg.CopyImages(ctx, newRegistryClient(source), target, imagesBySource[source], reg.CopyOptions{
+				ConcurrencyLimit: syncImagesConcurrencyLimit,
+				DryRun:           dryRun,
+				StateFile:        syncImagesStateFile,
+			})
+			if err != nil {
+				return err
+			}
+			summary.Copied = append(summary.Copied, s.Copied...)
+			summary.Skipped = append(summary.Skipped, s.Skipped...)
+			summary.Failed = append(summary.Failed, s.Failed...)
+		}
+
+		if syncImagesJSONOutput {
+			b, err := json.MarshalIndent(summary, "", " ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(b))
+		} else {
+			copiedPrefix := "copied:  "
+			if dryRun {
+				copiedPrefix = "to copy: "
+			}
+			for _, result := range summary.Copied {
+				fmt.Println(copiedPrefix + result.Source + "/" + result.Image + " " + result.Digest)
+			}
+			for _, result := range summary.Skipped {
+				fmt.Println("skipped: " + result.Source + "/" + result.Image + " " + result.Digest)
+			}
+			for _, result := range summary.Failed {
+				fmt.Println("failed:  " + result.Source + "/" + result.Image + ": " + result.Error)
+			}
+			fmt.Println(strconv.Itoa(len(summary.Copied)) + " copied, " + strconv.Itoa(len(summary.Skipped)) + " skipped, " + strconv.Itoa(len(summary.Failed)) + " failed")
+		}
+
+		if len(summary.Failed) > 0 {
+			return errors.New("failed to copy " + strconv.Itoa(len(summary.Failed)) + " images")
+		}
+
+		return nil
+	},
+}
+
+// readImagesFile reads an image list file, skipping empty lines and comments
+func readImagesFile(file string) ([]string, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []string
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		images = append(images, line)
+	}
+
+	return images, nil
+}
+
+// newPrimeArtifactsClient creates an S3 client for the prime artifacts bucket, using the AWS
+// credentials from the config when set. A custom endpoint can be used for S3-compatible stand-ins.
+func newPrimeArtifactsClient(ctx context.Context, endpoint string) (*s3.Client, error) {
+	region := "us-east-1"
+	options := []func(*config.LoadOptions) error{}
+
+	if auth := rootConfig.Auth; auth != nil {
+		if auth.AWSDefaultRegion != "" {
+			region = auth.AWSDefaultRegion
+		}
+		if auth.AWSAccessKeyID != "" {
+			options = append(options, config.WithCredentialsProvider(aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+				return aws.Credentials{
+					AccessKeyID:     auth.AWSAccessKeyID,
+					SecretAccessKey: auth.AWSSecretAccessKey,
+					SessionToken:    auth.AWSSessionToken,
+				}, nil
+			})))
+		}
+	}
+	options = append(options, config.WithDefaultRegion(region))
+
+	cfg, err := config.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		}
+	}), nil
+}
+
 func init() {
 	rootCmd.AddCommand(syncCmd)
 
 	syncCmd.AddCommand(syncImageBuildCmd)
+	syncCmd.AddCommand(syncAssetsCmd)
+	syncCmd.AddCommand(syncImagesCmd)
+
+	syncAssetsCmd.Flags().StringVar(&syncAssetsEndpoint, "endpoint", "", "S3-compatible endpoint, defaults to AWS S3")
+	syncAssetsCmd.Flags().StringVar(&syncAssetsArtifactsDir, "artifacts-dir", "", "Local artifacts directory to mirror into instead of the bucket, for testing purposes")
+	syncAssetsCmd.Flags().StringVarP(&syncAssetsIndexWriteToPath, "write-path", "w", ".", "Output directory of the regenerated index, defaults to current working directory")
+	syncAssetsCmd.Flags().IntVarP(&syncAssetsConcurrencyLimit, "concurrency-limit", "l", defaultConcurrencyLimit, "Maximum number of assets copied at a time")
+	syncAssetsCmd.Flags().BoolVarP(&syncAssetsJSONOutput, "json", "j", false, "JSON Output")
+	syncAssetsCmd.Flags().StringVar(&releaseOwner, "owner", "", "Owner of the release repository, defaults to the product's owner")
+
+	syncImagesCmd.Flags().StringVarP(&syncImagesSource, "source", "s", "", "Registry to copy the images from, required with --images-file")
+	syncImagesCmd.Flags().StringVarP(&syncImagesTarget, "target", "t", "", "Registry to copy the images to")
+	if err := syncImagesCmd.MarkFlagRequired("target"); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	syncImagesCmd.Flags().StringVar(&syncImagesLocationsFile, "images-locations", "", "JSON output of 'release generate rancher images-locations'")
+	syncImagesCmd.Flags().StringVarP(&syncImagesFile, "images-file", "f", "", "File with one image per line. e.g: rancher/rancher:v2.9.0")
+	syncImagesCmd.Flags().StringVar(&syncImagesStateFile, "state-file", "", "File recording the copied images, to resume interrupted copies")
+	syncImagesCmd.Flags().IntVarP(&syncImagesConcurrencyLimit, "concurrency-limit", "l", defaultConcurrencyLimit, "Maximum number of images copied at a time")
+	syncImagesCmd.Flags().BoolVarP(&syncImagesJSONOutput, "json", "j", false, "JSON Output")
 
 	syncImageBuildCmd.Flags().StringVar(&upstreamTagPrefix, "tag-prefix", "", "Upstream tag Prefix")
 	syncImageBuildCmd.Flags().StringVar(&upstreamRepo, "upstream-repo", "", "Upstream repository name")
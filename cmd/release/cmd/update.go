@@ -187,7 +187,7 @@ var updateRancherDashboardCmd = &cobra.Command{
 
 		ghClient := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
 
-		return rancher.UpdateDashboardReferences(ctx, ghClient, &dashboardRelease, rootConfig.User, tag, rancherReleaseBranch, rancherRepo, rancherRepoOwner, rancherRepoURL, dryRun)
+		return rancher.UpdateDashboardReferences(ctx, ghClient, &dashboardRelease, rootConfig.User, tag, rancherReleaseBranch, rancherRepo, rancherRepoOwner, rancherRepoURL, rootConfig.Auth.GithubToken, dryRun)
 	},
 }
 
@@ -236,7 +236,7 @@ var updateRancherCLICmd = &cobra.Command{
 
 		ghClient := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
 
-		return rancher.UpdateCLIReferences(ctx, ghClient, tag, rancherReleaseBranch, githubUsername, rancherRepo, rancherRepoOwner, rancherRepoURL, dryRun)
+		return rancher.UpdateCLIReferences(ctx, ghClient, tag, rancherReleaseBranch, githubUsername, rancherRepo, rancherRepoOwner, rancherRepoURL, rootConfig.Auth.GithubToken, dryRun)
 	},
 }
 
@@ -276,16 +276,16 @@ var updateCLICmd = &cobra.Command{
 
 		cliBranch = config.ValueOrDefault(cliRelease.ReleaseBranch, cliBranch)
 		cliRepo := config.ValueOrDefault(rootConfig.CLIRepositoryName, config.CLIRepositoryName)
+		cliRepoURL := config.ValueOrDefault(rootConfig.CLIRepositoryURL, config.CLIRepositoryURL)
 
 		rancherRepo := config.ValueOrDefault(rootConfig.RancherRepositoryName, config.RancherRepositoryName)
 		rancherRepoOwner := config.ValueOrDefault(rootConfig.RancherGithubOrganization, config.RancherGithubOrganization)
-		rancherUpstreamURL := config.ValueOrDefault(rootConfig.RancherRepositoryURL, config.RancherRepositoryURL)
 
 		ctx := context.Background()
 
 		ghClient := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
 
-		return cli.UpdateRancherReferences(ctx, ghClient, tag, rancherRepo, rancherRepoOwner, rancherUpstreamURL, cliBranch, cliRepo, githubUsername, dryRun)
+		return cli.UpdateRancherReferences(ctx, ghClient, tag, rancherRepo, rancherRepoOwner, cliRepoURL, cliBranch, cliRepo, githubUsername, rootConfig.Auth.GithubToken, dryRun)
 	},
 }
 
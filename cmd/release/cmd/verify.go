@@ -0,0 +1,358 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/rancher/ecm-distro-tools/cmd/release/config"
+	reg "github.com/rancher/ecm-distro-tools/registry"
+	"github.com/rancher/ecm-distro-tools/release"
+	"github.com/rancher/ecm-distro-tools/release/product"
+	"github.com/rancher/ecm-distro-tools/release/rke2"
+	"github.com/rancher/ecm-distro-tools/repository"
+	"github.com/rancher/ecm-distro-tools/signature"
+	"github.com/spf13/cobra"
+)
+
+var (
+	verifyOutput           string
+	verifyConcurrencyLimit int
+	verifyRegistry         string
+	verifySkipImages       bool
+	verifySkipAssets       bool
+)
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify release artifacts",
+}
+
+var verifyAssetsSubCmd = &cobra.Command{
+	Use:     "assets [product] [tag...]",
+	Short:   "Verify the assets of releases against the expected asset manifest",
+	Example: "release verify assets rke2 v1.30.4+rke2r1 v1.29.8+rke2r1",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return errors.New("expected at least two arguments: [product] [tag...]")
+		}
+
+		owner, repo, err := productRepository(args[0])
+		if err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+		client := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
+
+		verifications, err := release.VerifyAssets(ctx, client, owner, repo, args[1:])
+		if err != nil {
+			return err
+		}
+
+		switch verifyOutput {
+		case "json":
+			b, err := json.MarshalIndent(verifications, "", " ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(b))
+		case "text":
+			assetVerificationsText(os.Stdout, verifications)
+		default:
+			return errors.New("unrecognized output format: " + verifyOutput)
+		}
+
+		for _, verification := range verifications {
+			if !verification.OK() {
+				return errors.New("assets verification failed")
+			}
+		}
+
+		return nil
+	},
+}
+
+var verifyChecksumsSubCmd = &cobra.Command{
+	Use:     "checksums [product] [tag]",
+	Short:   "Verify the assets of a release against its published sha256sum files",
+	Example: "release verify checksums rke2 v1.30.4+rke2r1",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return errors.New("expected at least two arguments: [product] [tag]")
+		}
+		if verifyConcurrencyLimit < 1 {
+			return errors.New("--concurrency-limit must be at least 1")
+		}
+
+		owner, repo, err := productRepository(args[0])
+		if err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+		client := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
+
+		filesystem, err := newReleaseFS(ctx, client, owner, repo, args[1])
+		if err != nil {
+			return err
+		}
+
+		verification, err := release.VerifyChecksums(ctx, filesystem, verifyConcurrencyLimit)
+		if err != nil {
+			return err
+		}
+
+		switch verifyOutput {
+		case "json":
+			b, err := json.MarshalIndent(verification, "", " ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(b))
+		case "text":
+			checksumVerificationText(os.Stdout, verification)
+		default:
+			return errors.New("unrecognized output format: " + verifyOutput)
+		}
+
+		if !verification.OK() {
+			return errors.New("checksums verification failed")
+		}
+
+		return nil
+	},
+}
+
+var verifySignaturesSubCmd = &cobra.Command{
+	Use:   "signatures [product] [tag]",
+	Short: "Verify the signatures and attestations of the images and assets of a release",
+	Long: `Verify the cosign signatures and in-toto attestations of the images in the
+image lists of a release and of its assets, using the trusted keys and identities
+in the verification section of the config.`,
+	Example: "release verify signatures rke2 v1.30.4+rke2r1 --registry registry.rancher.com",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return errors.New("expected at least two arguments: [product] [tag]")
+		}
+		if verifyConcurrencyLimit < 1 {
+			return errors.New("--concurrency-limit must be at least 1")
+		}
+		productName, tag := args[0], args[1]
+
+		owner, repo, err := productRepository(productName)
+		if err != nil {
+			return err
+		}
+
+		verifier, err := newSignatureVerifier(rootConfig.Verification)
+		if err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+		client := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
+
+		filesystem, err := newReleaseFS(ctx, client, owner, repo, tag)
+		if err != nil {
+			return err
+		}
+
+		var results []signature.Result
+
+		if !verifySkipImages {
+			p, ok := product.Products[productName]
+			if !ok {
+				return errors.New("unsupported product: " + productName)
+			}
+			inspector := rke2.NewProductReleaseInspector(p, filesystem, nil, nil, debug)
+			images, err := inspector.ReleaseImages()
+			if err != nil {
+				return err
+			}
+
+			remoteOptions := append(newRegistryClient(verifyRegistry).RemoteOptions(ctx), remote.WithJobs(verifyConcurrencyLimit))
+			imageVerifier := signature.NewImageVerifier(verifier, remoteOptions...)
+			for _, image := range images {
+				ref, err := reg.ReplaceRegistry(verifyRegistry, image.Reference)
+				if err != nil {
+					return err
+				}
+
+				imageResults, err := imageVerifier.VerifyImage(ctx, ref)
+				if err != nil {
+					return errors.New("failed to verify " + ref.String() + ": " + err.Error())
+				}
+				results = append(results, imageResults...)
+			}
+		}
+
+		if !verifySkipAssets {
+			manifest, err := release.AssetManifestFor(repo, tag)
+			if err != nil {
+				return err
+			}
+
+			var patterns []string
+			for _, platform := range manifest.Platforms {
+				patterns = append(patterns, platform.Patterns...)
+			}
+
+			assetResults, err := verifier.VerifyAssets(ctx, filesystem, patterns, verifyConcurrencyLimit)
+			if err != nil {
+				return err
+			}
+			results = append(results, assetResults...)
+		}
+
+		switch verifyOutput {
+		case "json":
+			b, err := json.MarshalIndent(results, "", " ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(b))
+		case "text":
+			signatureResultsText(os.Stdout, results)
+		default:
+			return errors.New("unrecognized output format: " + verifyOutput)
+		}
+
+		for _, result := range results {
+			if !result.Signed {
+				return errors.New("signatures verification failed")
+			}
+		}
+
+		return nil
+	},
+}
+
+// newSignatureVerifier creates a signature verifier from the keys and identities trusted in the config
+func newSignatureVerifier(conf *config.Verification) (*signature.Verifier, error) {
+	if conf == nil {
+		return nil, errors.New("verification config is missing")
+	}
+
+	publicKeys := make([][]byte, 0, len(conf.PublicKeys))
+	for _, path := range conf.PublicKeys {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		publicKeys = append(publicKeys, b)
+	}
+
+	var rootCertificates []byte
+	if conf.RootCertificates != "" {
+		b, err := os.ReadFile(conf.RootCertificates)
+		if err != nil {
+			return nil, err
+		}
+		rootCertificates = b
+	}
+
+	identities := make([]signature.Identity, 0, len(conf.Identities))
+	for _, id := range conf.Identities {
+		identities = append(identities, signature.Identity{
+			Issuer:        id.Issuer,
+			SubjectRegexp: id.SubjectRegexp,
+		})
+	}
+
+	rekorPublicKeys := make([][]byte, 0, len(conf.RekorPublicKeys))
+	for _, path := range conf.RekorPublicKeys {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		rekorPublicKeys = append(rekorPublicKeys, b)
+	}
+
+	return signature.NewVerifier(publicKeys, rootCertificates, identities, rekorPublicKeys)
+}
+
+func signatureResultsText(w io.Writer, results []signature.Result) {
+	for _, result := range results {
+		subject := result.Subject
+		if result.Platform != "" {
+			subject += " (" + result.Platform + ")"
+		}
+
+		status := "unsigned"
+		if result.Signed {
+			status = "signed by " + result.Signer
+		}
+		fmt.Fprintln(w, subject+": "+status)
+
+		if len(result.Attestations) > 0 {
+			fmt.Fprintln(w, "  attestations: "+strings.Join(result.Attestations, ", "))
+		}
+		for _, err := range result.Errors {
+			fmt.Fprintln(w, "  error: "+err)
+		}
+	}
+}
+
+func assetVerificationsText(w io.Writer, verifications []release.AssetVerification) {
+	for _, verification := range verifications {
+		switch {
+		case !verification.Found:
+			fmt.Fprintln(w, verification.Tag+": release not found")
+			continue
+		case verification.OK():
+			fmt.Fprintln(w, verification.Tag+": all assets OK")
+			continue
+		}
+
+		fmt.Fprintln(w, verification.Tag+":")
+		for _, missing := range verification.Missing {
+			fmt.Fprintln(w, "  missing:    "+missing)
+		}
+		for _, unexpected := range verification.Unexpected {
+			fmt.Fprintln(w, "  unexpected: "+unexpected)
+		}
+	}
+}
+
+func checksumVerificationText(w io.Writer, verification *release.ChecksumVerification) {
+	if len(verification.ChecksumFiles) == 0 {
+		fmt.Fprintln(w, "no checksum files found")
+		return
+	}
+
+	fmt.Fprintf(w, "%d assets verified against %s\n", len(verification.Verified), strings.Join(verification.ChecksumFiles, ", "))
+	for _, mismatch := range verification.Mismatches {
+		fmt.Fprintf(w, "  mismatch:  %s (%s) expected %s, got %s\n", mismatch.Asset, mismatch.ChecksumFile, mismatch.Expected, mismatch.Actual)
+	}
+	for _, uncovered := range verification.Uncovered {
+		fmt.Fprintln(w, "  uncovered: "+uncovered)
+	}
+	for _, missing := range verification.Missing {
+		fmt.Fprintln(w, "  missing:   "+missing)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+
+	verifyCmd.AddCommand(verifyAssetsSubCmd)
+	verifyCmd.AddCommand(verifyChecksumsSubCmd)
+	verifyCmd.AddCommand(verifySignaturesSubCmd)
+
+	verifyCmd.PersistentFlags().StringVarP(&verifyOutput, "output", "o", "text", "Output format (text|json)")
+	verifyCmd.PersistentFlags().StringVar(&releaseOwner, "owner", "", "Owner of the release repository, defaults to the product's owner")
+
+	verifyChecksumsSubCmd.Flags().IntVarP(&verifyConcurrencyLimit, "concurrency-limit", "l", defaultConcurrencyLimit, "Maximum number of assets downloaded at a time")
+
+	verifySignaturesSubCmd.Flags().StringVarP(&verifyRegistry, "registry", "r", ossRegistry, "Registry the images are verified in")
+	verifySignaturesSubCmd.Flags().BoolVar(&verifySkipImages, "skip-images", false, "Don't verify the images of the release")
+	verifySignaturesSubCmd.Flags().BoolVar(&verifySkipAssets, "skip-assets", false, "Don't verify the assets of the release")
+	verifySignaturesSubCmd.Flags().IntVarP(&verifyConcurrencyLimit, "concurrency-limit", "l", defaultConcurrencyLimit, "Maximum number of assets downloaded at a time")
+}
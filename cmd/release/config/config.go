@@ -89,7 +89,9 @@ type K3sRelease struct {
 
 // RancherRelease
 type RancherRelease struct {
-	ReleaseBranch string `json:"release_branch"`
+	ReleaseBranch    string `json:"release_branch"`
+	DashboardVersion string `json:"dashboard_version"`
+	CLIVersion       string `json:"cli_version"`
 }
 
 type DashboardRelease struct {
@@ -148,6 +150,28 @@ type Auth struct {
 	AWSSecretAccessKey string `json:"aws_secret_access_key"`
 	AWSSessionToken    string `json:"aws_session_token"`
 	AWSDefaultRegion   string `json:"aws_default_region"`
+	// Registries are the credentials for container registries, keyed by registry host
+	Registries map[string]RegistryCredential `json:"registries"`
+}
+
+// RegistryCredential
+type RegistryCredential struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// VerificationIdentity
+type VerificationIdentity struct {
+	Issuer        string `json:"issuer"`
+	SubjectRegexp string `json:"subject_regexp"`
+}
+
+// Verification
+type Verification struct {
+	PublicKeys       []string               `json:"public_keys"`
+	RootCertificates string                 `json:"root_certificates"`
+	Identities       []VerificationIdentity `json:"identities"`
+	RekorPublicKeys  []string               `json:"rekor_public_keys"`
 }
 
 // Config
@@ -160,7 +184,9 @@ type Config struct {
 	Auth                      *Auth          `json:"auth"`
 	Dashboard                 *Dashboard     `json:"dashboard"`
 	CLI                       *CLI           `json:"cli"`
+	Verification              *Verification  `json:"verification"`
 	PrimeRegistry             string         `json:"prime_registry"`
+	InsecureRegistries        []string       `json:"insecure_registries"`
 	RancherGithubOrganization string         `json:"rancher_github_organization"`
 	RancherRepositoryName     string         `json:"rancher_repository_name"`
 	RancherRepositoryGitURI   string         `json:"rancher_repository_git_uri"`
@@ -169,6 +195,7 @@ type Config struct {
 	DashboardRepositoryName   string         `json:"dashboard_repository_name"`
 	CLIRepositoryName         string         `json:"cli_repository_name"`
 	CLIRepositoryGitURI       string         `json:"cli_repository_git_uri"`
+	CLIRepositoryURL          string         `json:"cli_repository_url"`
 }
 
 // OpenOnEditor opens the given config file on the user's default text editor.
@@ -244,7 +271,9 @@ func ExampleConfig() (string, error) {
 		Rancher: &Rancher{
 			Versions: map[string]RancherRelease{
 				"v2.x.y": {
-					ReleaseBranch: "release/v2.x",
+					ReleaseBranch:    "release/v2.x",
+					DashboardVersion: "v2.x.y",
+					CLIVersion:       "v2.x.y",
 				},
 			},
 		},
@@ -277,6 +306,23 @@ func ExampleConfig() (string, error) {
 			AWSSecretAccessKey: "xxxxxxxxxxxxxxxxxxxxxxxxxxxxx",
 			AWSSessionToken:    "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx",
 			AWSDefaultRegion:   "us-east-1",
+			Registries: map[string]RegistryCredential{
+				"stgregistry.suse.com": {
+					Username: "YOUR_USERNAME",
+					Password: "YOUR_PASSWORD",
+				},
+			},
+		},
+		Verification: &Verification{
+			PublicKeys:       []string{"path/to/cosign.pub"},
+			RootCertificates: "path/to/fulcio_v1.crt.pem",
+			Identities: []VerificationIdentity{
+				{
+					Issuer:        "https://token.actions.githubusercontent.com",
+					SubjectRegexp: "^https://github.com/rancher/",
+				},
+			},
+			RekorPublicKeys: []string{"path/to/rekor.pub"},
 		},
 		PrimeRegistry:             "example.com",
 		RancherGithubOrganization: RancherGithubOrganization,
@@ -286,6 +332,7 @@ func ExampleConfig() (string, error) {
 		UIRepositoryName:          UIRepositoryName,
 		DashboardRepositoryName:   DashboardRepositoryName,
 		CLIRepositoryName:         CLIRepositoryName,
+		CLIRepositoryURL:          CLIRepositoryURL,
 	}
 	b, err := json.MarshalIndent(conf, "", "  ")
 	if err != nil {
@@ -335,6 +382,8 @@ K3s {{ range $k3sVersion, $k3sValue := .K3s.Versions }}
 Rancher {{ range $rancherVersion, $rancherValue := .Rancher.Versions }}
 	{{ $rancherVersion }}:
 		Release Branch:     {{ $rancherValue.ReleaseBranch }}
+		Dashboard Version:  {{ $rancherValue.DashboardVersion }}
+		CLI Version:        {{ $rancherValue.CLIVersion }}
 		Rancher Repo Owner: {{ $rancherValue.RancherRepoOwner }}{{ end }}
 
 RKE2{{ range .RKE2.Versions }}
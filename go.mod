@@ -22,6 +22,7 @@ require (
 	github.com/aws/aws-sdk-go-v2/config v1.27.29
 	github.com/aws/aws-sdk-go-v2/service/s3 v1.60.1
 	github.com/briandowns/spinner v1.23.1
+	github.com/klauspost/compress v1.16.5
 	github.com/spf13/cobra v1.8.0
 	github.com/urfave/cli/v2 v2.25.7
 	golang.org/x/sync v0.8.0
@@ -57,7 +58,6 @@ require (
 	github.com/fatih/color v1.7.0 // indirect
 	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
-	github.com/klauspost/compress v1.16.5 // indirect
 	github.com/mattn/go-colorable v0.1.2 // indirect
 	github.com/mattn/go-isatty v0.0.8 // indirect
 	github.com/mitchellh/go-homedir v1.1.0 // indirect
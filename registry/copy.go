@@ -0,0 +1,237 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"golang.org/x/sync/errgroup"
+)
+
+// CopyStatus is the outcome of copying an image
+type CopyStatus string
+
+const (
+	// CopyStatusCopied means the image was copied, or would be copied in a dry run
+	CopyStatusCopied CopyStatus = "copied"
+	// CopyStatusSkipped means the target already holds the same image
+	CopyStatusSkipped CopyStatus = "skipped"
+	// CopyStatusFailed means the image couldn't be copied, see CopyResult.Error
+	CopyStatusFailed CopyStatus = "failed"
+)
+
+// CopyResult is the result of copying an image between registries
+type CopyResult struct {
+	Image  string     `json:"image"`
+	Source string     `json:"source"`
+	Target string     `json:"target"`
+	Status CopyStatus `json:"status"`
+	Digest string     `json:"digest,omitempty"`
+	Error  string     `json:"error,omitempty"`
+}
+
+// CopySummary are the results of copying a set of images
+type CopySummary struct {
+	Copied  []CopyResult `json:"copied"`
+	Skipped []CopyResult `json:"skipped"`
+	Failed  []CopyResult `json:"failed"`
+}
+
+// CopyOptions configure CopyImages
+type CopyOptions struct {
+	// ConcurrencyLimit is the number of images copied at once
+	ConcurrencyLimit int
+	// DryRun only reports the images that would be copied
+	DryRun bool
+	// StateFile records the copied images, so an interrupted copy can be
+	// resumed without checking them again
+	StateFile string
+}
+
+// Copy copies an image to the target registry, keeping its digest. Multi-arch
+// images are copied with their index and every platform manifest. The image
+// isn't copied when the target already holds the same digest.
+func (c *Client) Copy(ctx context.Context, ref name.Reference, target *Client, dryRun bool) (string, bool, error) {
+	sourceRef, err := ReplaceRegistry(c.registry, ref, c.nameOptions()...)
+	if err != nil {
+		return "", false, err
+	}
+	targetRef, err := ReplaceRegistry(target.registry, ref, target.nameOptions()...)
+	if err != nil {
+		return "", false, err
+	}
+
+	desc, err := remote.Get(sourceRef, c.RemoteOptions(ctx)...)
+	if err != nil {
+		return "", false, err
+	}
+	digest := desc.Digest.String()
+
+	targetDigest, err := target.Digest(ctx, ref)
+	if err != nil {
+		return digest, false, err
+	}
+	if targetDigest == digest {
+		return digest, false, nil
+	}
+	if dryRun {
+		return digest, true, nil
+	}
+
+	// blobs are read from the source registry while they're written to the target
+	if desc.MediaType.IsIndex() {
+		idx, err := desc.ImageIndex()
+		if err != nil {
+			return digest, false, err
+		}
+		return digest, true, remote.WriteIndex(targetRef, idx, target.RemoteOptions(ctx)...)
+	}
+
+	img, err := desc.Image()
+	if err != nil {
+		return digest, false, err
+	}
+
+	return digest, true, remote.Write(targetRef, img, target.RemoteOptions(ctx)...)
+}
+
+// CopyImages copies the images from the source to the target registry. Failed
+// images don't stop the copy, they're reported in the summary.
+func CopyImages(ctx context.Context, source, target *Client, images []string, opts CopyOptions) (*CopySummary, error) {
+	state, err := loadCopyState(opts.StateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &CopySummary{
+		Copied:  make([]CopyResult, 0),
+		Skipped: make([]CopyResult, 0),
+		Failed:  make([]CopyResult, 0),
+	}
+	var mu sync.Mutex
+
+	g, ctx := errgroup.WithContext(ctx)
+	if opts.ConcurrencyLimit > 0 {
+		g.SetLimit(opts.ConcurrencyLimit)
+	}
+
+	for _, image := range images {
+		image := image
+		g.Go(func() error {
+			result := CopyResult{
+				Image:  image,
+				Source: source.registry,
+				Target: target.registry,
+			}
+
+			stateKey := target.registry + "/" + image
+			mu.Lock()
+			digest, done := state[stateKey]
+			mu.Unlock()
+
+			var copied bool
+			if done {
+				result.Digest = digest
+			} else {
+				ref, err := name.ParseReference(image)
+				if err == nil {
+					result.Digest, copied, err = source.Copy(ctx, ref, target, opts.DryRun)
+				}
+				if err != nil {
+					result.Status = CopyStatusFailed
+					result.Error = err.Error()
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			switch {
+			case result.Status == CopyStatusFailed:
+				summary.Failed = append(summary.Failed, result)
+				return nil
+			case copied:
+				result.Status = CopyStatusCopied
+				summary.Copied = append(summary.Copied, result)
+			default:
+				result.Status = CopyStatusSkipped
+				summary.Skipped = append(summary.Skipped, result)
+			}
+
+			if opts.DryRun || done {
+				return nil
+			}
+			state[stateKey] = result.Digest
+
+			return saveCopyState(opts.StateFile, state)
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return summary, err
+	}
+
+	for _, results := range [][]CopyResult{summary.Copied, summary.Skipped, summary.Failed} {
+		sort.Slice(results, func(i, j int) bool {
+			return results[i].Image < results[j].Image
+		})
+	}
+
+	return summary, nil
+}
+
+// loadCopyState reads the digests of the images already copied, keyed by target image
+func loadCopyState(file string) (map[string]string, error) {
+	state := make(map[string]string)
+	if file == "" {
+		return state, nil
+	}
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return state, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, errors.New("invalid state file " + file + ": " + err.Error())
+	}
+
+	return state, nil
+}
+
+// saveCopyState writes the state through a temporary file, so an interrupted
+// write doesn't corrupt it
+func saveCopyState(file string, state map[string]string) error {
+	if file == "" {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(state, "", " ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), file)
+}
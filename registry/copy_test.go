@@ -0,0 +1,116 @@
+package registry
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestCopyImages(t *testing.T) {
+	newRegistry := func() string {
+		server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+		t.Cleanup(server.Close)
+		return strings.TrimPrefix(server.URL, "http://")
+	}
+	sourceHost, targetHost := newRegistry(), newRegistry()
+
+	idx, err := random.Index(64, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(sourceHost + "/rancher/rancher:v2.9.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.WriteIndex(ref, idx); err != nil {
+		t.Fatal(err)
+	}
+	ref, err = name.ParseReference(sourceHost + "/rancher/rancher-agent:v2.9.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+
+	source, target := NewClient(sourceHost, false), NewClient(targetHost, false)
+	images := []string{"rancher/rancher:v2.9.0", "rancher/rancher-agent:v2.9.0", "rancher/missing:v0.0.0"}
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+
+	tests := []struct {
+		name    string
+		opts    CopyOptions
+		copied  int
+		skipped int
+	}{
+		{
+			name:   "dry run",
+			opts:   CopyOptions{ConcurrencyLimit: 2, DryRun: true},
+			copied: 2,
+		},
+		{
+			name:   "copy",
+			opts:   CopyOptions{ConcurrencyLimit: 2, StateFile: stateFile},
+			copied: 2,
+		},
+		{
+			name:    "resume from the state file",
+			opts:    CopyOptions{ConcurrencyLimit: 2, StateFile: stateFile},
+			skipped: 2,
+		},
+		{
+			name:    "already copied",
+			opts:    CopyOptions{ConcurrencyLimit: 2},
+			skipped: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary, err := CopyImages(context.Background(), source, target, images, tt.opts)
+			if err != nil {
+				t.Fatalf("CopyImages() error = %v", err)
+			}
+			if len(summary.Copied) != tt.copied || len(summary.Skipped) != tt.skipped {
+				t.Errorf("CopyImages() copied %d and skipped %d, want %d and %d", len(summary.Copied), len(summary.Skipped), tt.copied, tt.skipped)
+			}
+			if len(summary.Failed) != 1 || summary.Failed[0].Image != "rancher/missing:v0.0.0" {
+				t.Errorf("CopyImages() failed = %+v, want the missing image", summary.Failed)
+			}
+		})
+	}
+
+	digest, err := idx.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied, err := target.Image(context.Background(), mustParse(t, "rancher/rancher:v2.9.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copied.Digest != digest.String() {
+		t.Errorf("copied index digest = %s, want %s", copied.Digest, digest)
+	}
+
+	state, err := os.ReadFile(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(state), digest.String()) {
+		t.Errorf("state file = %s, want the index digest", state)
+	}
+}
@@ -3,9 +3,14 @@ package registry
 import (
 	"context"
 	"errors"
+	"log"
 	"net/http"
+	"os"
+	"strings"
 
+	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
 )
@@ -13,45 +18,187 @@ import (
 type Platform struct {
 	OS           string
 	Architecture string
+	// Variant is the CPU variant, e.g. v7 for arm/v7
+	Variant string
+	// OSVersion is the OS build, e.g. 10.0.17763.6189 for Windows Server 2019
+	OSVersion string
 }
 
+// String formats the platform as os/arch[/variant][:osversion]
 func (p Platform) String() string {
-	return p.OS + "/" + p.Architecture
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	if p.OSVersion != "" {
+		s += ":" + p.OSVersion
+	}
+	return s
+}
+
+// Matches reports whether the platform satisfies a required platform. An empty
+// required variant or OS version matches any, arm64 matches the v8 variant, and
+// an OS version matches its patch builds, so 10.0.17763 matches 10.0.17763.6189.
+func (p Platform) Matches(required Platform) bool {
+	if p.OS != required.OS || p.Architecture != required.Architecture {
+		return false
+	}
+	if required.Variant != "" && normalizeVariant(p) != normalizeVariant(required) {
+		return false
+	}
+	if required.OSVersion != "" && p.OSVersion != required.OSVersion && !strings.HasPrefix(p.OSVersion, required.OSVersion+".") {
+		return false
+	}
+
+	return true
+}
+
+// normalizeVariant returns the variant of a platform, defaulting arm64 to v8
+func normalizeVariant(p Platform) string {
+	if p.Architecture == "arm64" && p.Variant == "" {
+		return "v8"
+	}
+	return p.Variant
 }
 
 type Image struct {
 	Platforms map[Platform]bool
 	Exists    bool
+	// Digest is the digest of the image index, or of the manifest for single platform images
+	Digest string
+	// Digests are the manifest digests of each platform
+	Digests map[Platform]string
+}
+
+// HasPlatform reports whether the image has a platform matching the required platform
+func (i Image) HasPlatform(required Platform) bool {
+	for platform, ok := range i.Platforms {
+		if ok && platform.Matches(required) {
+			return true
+		}
+	}
+	return false
 }
 
 type Client struct {
-	registry string
+	registry    string
+	debug       bool
+	insecure    bool
+	keychain    authn.Keychain
+	credentials staticKeychain
+	transport   http.RoundTripper
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithKeychain replaces the docker config keychain used to resolve credentials
+func WithKeychain(keychain authn.Keychain) Option {
+	return func(c *Client) {
+		c.keychain = keychain
+	}
+}
+
+// WithCredentials sets the username and password used for a registry. They
+// take precedence over the keychain.
+func WithCredentials(registry, username, password string) Option {
+	return func(c *Client) {
+		c.credentials[normalizeRegistry(registry)] = authn.AuthConfig{
+			Username: username,
+			Password: password,
+		}
+	}
+}
+
+// WithInsecure allows plain HTTP and skips TLS verification, for local and
+// staging registries.
+func WithInsecure() Option {
+	return func(c *Client) {
+		c.insecure = true
+	}
+}
+
+// WithInsecureRegistries enables WithInsecure when the client's registry is one of the given registries
+func WithInsecureRegistries(registries ...string) Option {
+	return func(c *Client) {
+		for _, registry := range registries {
+			if registry == c.registry {
+				c.insecure = true
+			}
+		}
+	}
+}
+
+// WithTransport sets the base transport used for requests
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *Client) {
+		c.transport = transport
+	}
 }
 
-func NewClient(registry string, debug bool) *Client {
-	return &Client{registry}
+// NewClient creates a client for a registry. Credentials are resolved from the
+// docker config keychain unless set with the options.
+func NewClient(registry string, debug bool, options ...Option) *Client {
+	c := &Client{
+		registry:    registry,
+		debug:       debug,
+		keychain:    authn.DefaultKeychain,
+		credentials: make(staticKeychain),
+		transport:   remote.DefaultTransport,
+	}
+	for _, option := range options {
+		option(c)
+	}
+
+	return c
 }
 
-func replaceRegistry(registry string, ref name.Reference) (name.Tag, error) {
-	newRef, err := name.NewRepository(registry + "/" + ref.Context().RepositoryStr())
+// ReplaceRegistry returns the tag of a reference in another registry
+func ReplaceRegistry(registry string, ref name.Reference, options ...name.Option) (name.Tag, error) {
+	newRef, err := name.NewRepository(registry+"/"+ref.Context().RepositoryStr(), options...)
 	if err != nil {
 		return name.Tag{}, err
 	}
 
-	return name.NewTag(newRef.String() + ":" + ref.Identifier())
+	return name.NewTag(newRef.String()+":"+ref.Identifier(), options...)
+}
+
+// RemoteOptions returns the options used for requests to the registry
+func (c *Client) RemoteOptions(ctx context.Context) []remote.Option {
+	transport := c.transport
+	if c.insecure {
+		transport = insecureTransport(transport)
+	}
+	if c.debug {
+		transport = &loggingTransport{next: transport, logger: log.New(os.Stderr, "registry: ", log.LstdFlags)}
+	}
+
+	return []remote.Option{
+		remote.WithContext(ctx),
+		remote.WithAuthFromKeychain(authn.NewMultiKeychain(c.credentials, c.keychain)),
+		remote.WithTransport(transport),
+	}
+}
+
+func (c *Client) nameOptions() []name.Option {
+	if c.insecure {
+		return []name.Option{name.Insecure}
+	}
+	return nil
 }
 
 func (c *Client) Image(ctx context.Context, ref name.Reference) (Image, error) {
 	info := Image{
 		Platforms: make(map[Platform]bool),
+		Digests:   make(map[Platform]string),
 	}
 
-	tagRef, err := replaceRegistry(c.registry, ref)
+	tagRef, err := ReplaceRegistry(c.registry, ref, c.nameOptions()...)
 	if err != nil {
 		return info, err
 	}
 
-	desc, err := remote.Get(tagRef)
+	desc, err := remote.Get(tagRef, c.RemoteOptions(ctx)...)
 	if err != nil {
 		var transportErr *transport.Error
 		if errors.As(err, &transportErr) && transportErr.StatusCode == http.StatusNotFound {
@@ -61,6 +208,7 @@ func (c *Client) Image(ctx context.Context, ref name.Reference) (Image, error) {
 	}
 
 	info.Exists = true
+	info.Digest = desc.Digest.String()
 
 	if desc.MediaType.IsIndex() {
 		if err := c.handleMultiArchImage(desc, &info); err != nil {
@@ -75,6 +223,87 @@ func (c *Client) Image(ctx context.Context, ref name.Reference) (Image, error) {
 	return info, nil
 }
 
+// Digest returns the digest of an image in the registry, using a HEAD request
+// so the manifest isn't downloaded. The image doesn't exist if the digest is empty.
+func (c *Client) Digest(ctx context.Context, ref name.Reference) (string, error) {
+	tagRef, err := ReplaceRegistry(c.registry, ref, c.nameOptions()...)
+	if err != nil {
+		return "", err
+	}
+
+	desc, err := remote.Head(tagRef, c.RemoteOptions(ctx)...)
+	if err != nil {
+		var transportErr *transport.Error
+		if errors.As(err, &transportErr) && transportErr.StatusCode == http.StatusNotFound {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return desc.Digest.String(), nil
+}
+
+// PlatformImage returns the image of a platform. Layers are fetched lazily as they're read.
+// The manifest of an index is picked with Platform.Matches, so a platform with an OS version
+// like 10.0.17763 resolves the Windows images of its patch builds.
+func (c *Client) PlatformImage(ctx context.Context, ref name.Reference, platform Platform) (v1.Image, error) {
+	tagRef, err := ReplaceRegistry(c.registry, ref, c.nameOptions()...)
+	if err != nil {
+		return nil, err
+	}
+
+	desc, err := remote.Get(tagRef, c.RemoteOptions(ctx)...)
+	if err != nil {
+		return nil, err
+	}
+	if !desc.MediaType.IsIndex() {
+		return desc.Image()
+	}
+
+	idx, err := desc.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range manifest.Manifests {
+		if m.Platform == nil {
+			continue
+		}
+		imagePlatform := Platform{
+			OS:           m.Platform.OS,
+			Architecture: m.Platform.Architecture,
+			Variant:      m.Platform.Variant,
+			OSVersion:    m.Platform.OSVersion,
+		}
+		if imagePlatform.Matches(platform) {
+			return idx.Image(m.Digest)
+		}
+	}
+
+	return nil, errors.New("no image for platform " + platform.String())
+}
+
+// ParsePlatform parses a platform formatted as os/arch[/variant][:osversion]
+func ParsePlatform(s string) (Platform, error) {
+	var platform Platform
+	osArch, osVersion, _ := strings.Cut(s, ":")
+	platform.OSVersion = osVersion
+
+	parts := strings.Split(osArch, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return Platform{}, errors.New("invalid platform, expected os/arch[/variant][:osversion]: " + s)
+	}
+	platform.OS, platform.Architecture = parts[0], parts[1]
+	if len(parts) == 3 {
+		platform.Variant = parts[2]
+	}
+
+	return platform, nil
+}
+
 func (c *Client) handleMultiArchImage(desc *remote.Descriptor, info *Image) error {
 	idx, err := desc.ImageIndex()
 	if err != nil {
@@ -87,11 +316,17 @@ func (c *Client) handleMultiArchImage(desc *remote.Descriptor, info *Image) erro
 	}
 
 	for _, m := range manifest.Manifests {
+		if m.Platform == nil {
+			continue
+		}
 		platform := Platform{
 			OS:           m.Platform.OS,
 			Architecture: m.Platform.Architecture,
+			Variant:      m.Platform.Variant,
+			OSVersion:    m.Platform.OSVersion,
 		}
 		info.Platforms[platform] = true
+		info.Digests[platform] = m.Digest.String()
 	}
 
 	return nil
@@ -111,8 +346,11 @@ func (c *Client) handleSingleArchImage(desc *remote.Descriptor, info *Image) err
 	platform := Platform{
 		OS:           cfg.OS,
 		Architecture: cfg.Architecture,
+		Variant:      cfg.Variant,
+		OSVersion:    cfg.OSVersion,
 	}
 	info.Platforms[platform] = true
+	info.Digests[platform] = desc.Digest.String()
 
 	return nil
 }
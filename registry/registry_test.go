@@ -1,9 +1,24 @@
 package registry
 
 import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
 )
 
 func TestReplaceRegistry(t *testing.T) {
@@ -37,14 +52,337 @@ func TestReplaceRegistry(t *testing.T) {
 				t.Fatalf("failed to parse input reference: %v", err)
 			}
 
-			result, err := replaceRegistry(tt.registry, ref)
+			result, err := ReplaceRegistry(tt.registry, ref)
 			if (err != nil) != tt.expectErr {
-				t.Errorf("replaceRegistry() error = %v, expectErr %v", err, tt.expectErr)
+				t.Errorf("ReplaceRegistry() error = %v, expectErr %v", err, tt.expectErr)
 				return
 			}
 
 			if !tt.expectErr && result.Name() != tt.expected {
-				t.Errorf("replaceRegistry() = %v, want %v", result.Name(), tt.expected)
+				t.Errorf("ReplaceRegistry() = %v, want %v", result.Name(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestClientImage(t *testing.T) {
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(server.Close)
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	idx, err := random.Index(64, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// random indexes don't set platforms
+	manifest.Manifests[0].Platform = &v1.Platform{OS: "linux", Architecture: "amd64"}
+	manifest.Manifests[1].Platform = &v1.Platform{OS: "linux", Architecture: "arm64"}
+	withPlatforms := mutate.IndexMediaType(mutate.AppendManifests(empty.Index,
+		mutate.IndexAddendum{Add: mustImage(t, idx, manifest.Manifests[0].Digest), Descriptor: manifest.Manifests[0]},
+		mutate.IndexAddendum{Add: mustImage(t, idx, manifest.Manifests[1].Digest), Descriptor: manifest.Manifests[1]},
+	), types.OCIImageIndex)
+
+	ref, err := name.ParseReference(host + "/rancher/rke2-runtime:v1.30.4-rke2r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.WriteIndex(ref, withPlatforms); err != nil {
+		t.Fatal(err)
+	}
+	digest, err := withPlatforms.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient(host, false)
+
+	image, err := client.Image(context.Background(), mustParse(t, "rancher/rke2-runtime:v1.30.4-rke2r1"))
+	if err != nil {
+		t.Fatalf("Image() error = %v", err)
+	}
+	if !image.Exists {
+		t.Fatal("Image() expected image to exist")
+	}
+	if image.Digest != digest.String() {
+		t.Errorf("Image() digest = %s, want %s", image.Digest, digest)
+	}
+	amd64 := Platform{OS: "linux", Architecture: "amd64"}
+	if image.Digests[amd64] != manifest.Manifests[0].Digest.String() {
+		t.Errorf("Image() amd64 digest = %s, want %s", image.Digests[amd64], manifest.Manifests[0].Digest)
+	}
+
+	missing, err := client.Image(context.Background(), mustParse(t, "rancher/rke2-runtime:v0.0.0"))
+	if err != nil {
+		t.Fatalf("Image() error = %v", err)
+	}
+	if missing.Exists {
+		t.Error("Image() expected missing image")
+	}
+}
+
+func TestClientAuth(t *testing.T) {
+	handler := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "pass" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	img, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(host + "/rancher/hardened-etcd:v3.5.13-k3s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img, remote.WithAuth(&authn.Basic{Username: "user", Password: "pass"})); err != nil {
+		t.Fatal(err)
+	}
+
+	var requests int
+	countingTransport := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		requests++
+		return http.DefaultTransport.RoundTrip(r)
+	})
+
+	tests := []struct {
+		name      string
+		options   []Option
+		expectErr bool
+	}{
+		{
+			name:      "anonymous",
+			options:   []Option{WithKeychain(authn.NewMultiKeychain())},
+			expectErr: true,
+		},
+		{
+			name:      "wrong credentials",
+			options:   []Option{WithKeychain(authn.NewMultiKeychain()), WithCredentials(host, "user", "wrong")},
+			expectErr: true,
+		},
+		{
+			name:      "credentials",
+			options:   []Option{WithKeychain(authn.NewMultiKeychain()), WithCredentials(host, "user", "pass")},
+			expectErr: false,
+		},
+		{
+			name:      "custom transport",
+			options:   []Option{WithKeychain(authn.NewMultiKeychain()), WithCredentials(host, "user", "pass"), WithTransport(countingTransport)},
+			expectErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient(host, false, tt.options...)
+
+			image, err := client.Image(context.Background(), mustParse(t, "rancher/hardened-etcd:v3.5.13-k3s1"))
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("Image() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if !tt.expectErr && !image.Exists {
+				t.Error("Image() expected image to exist")
+			}
+		})
+	}
+
+	if requests == 0 {
+		t.Error("expected requests through the custom transport")
+	}
+}
+
+func TestClientContext(t *testing.T) {
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(server.Close)
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := NewClient(host, false).Image(ctx, mustParse(t, "rancher/rke2-runtime:v1.30.4-rke2r1")); !errors.Is(err, context.Canceled) {
+		t.Errorf("Image() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestStaticKeychain(t *testing.T) {
+	keychain := make(staticKeychain)
+	client := &Client{credentials: keychain}
+	WithCredentials("docker.io", "user", "pass")(client)
+
+	reg, err := name.NewRegistry("index.docker.io")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := keychain.Resolve(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := auth.Authorization()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Username != "user" || config.Password != "pass" {
+		t.Errorf("Resolve() = %+v, want docker.io credentials", config)
+	}
+
+	WithCredentials("harbor.example.com/mirror", "mirror-user", "mirror-pass")(client)
+	mirror, err := name.NewRepository("harbor.example.com/mirror/rancher/rancher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err = keychain.Resolve(mirror)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err = auth.Authorization()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Username != "mirror-user" || config.Password != "mirror-pass" {
+		t.Errorf("Resolve() = %+v, want mirror credentials", config)
+	}
+
+	other, err := name.NewRegistry("stgregistry.suse.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth, _ := keychain.Resolve(other); auth != authn.Anonymous {
+		t.Errorf("Resolve() = %v, want anonymous", auth)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func mustImage(t *testing.T, idx v1.ImageIndex, digest v1.Hash) v1.Image {
+	t.Helper()
+
+	img, err := idx.Image(digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return img
+}
+
+func mustParse(t *testing.T, s string) name.Reference {
+	t.Helper()
+
+	ref, err := name.ParseReference(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ref
+}
+
+func TestPlatformMatches(t *testing.T) {
+	tests := []struct {
+		platform Platform
+		required Platform
+		expected bool
+		str      string
+	}{
+		{
+			platform: Platform{OS: "linux", Architecture: "amd64"},
+			required: Platform{OS: "linux", Architecture: "amd64"},
+			expected: true,
+			str:      "linux/amd64",
+		},
+		{
+			platform: Platform{OS: "linux", Architecture: "arm64", Variant: "v8"},
+			required: Platform{OS: "linux", Architecture: "arm64"},
+			expected: true,
+			str:      "linux/arm64/v8",
+		},
+		{
+			platform: Platform{OS: "linux", Architecture: "arm64"},
+			required: Platform{OS: "linux", Architecture: "arm64", Variant: "v8"},
+			expected: true,
+			str:      "linux/arm64",
+		},
+		{
+			platform: Platform{OS: "linux", Architecture: "arm", Variant: "v7"},
+			required: Platform{OS: "linux", Architecture: "arm", Variant: "v6"},
+			expected: false,
+			str:      "linux/arm/v7",
+		},
+		{
+			platform: Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.6189"},
+			required: Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763"},
+			expected: true,
+			str:      "windows/amd64:10.0.17763.6189",
+		},
+		{
+			platform: Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.6189"},
+			required: Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.20348"},
+			expected: false,
+			str:      "windows/amd64:10.0.17763.6189",
+		},
+		{
+			platform: Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.177630"},
+			required: Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763"},
+			expected: false,
+			str:      "windows/amd64:10.0.177630",
+		},
+		{
+			platform: Platform{OS: "linux", Architecture: "amd64"},
+			required: Platform{OS: "windows", Architecture: "amd64"},
+			expected: false,
+			str:      "linux/amd64",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.platform.String()+" "+tt.required.String(), func(t *testing.T) {
+			if got := tt.platform.Matches(tt.required); got != tt.expected {
+				t.Errorf("Matches() = %v, want %v", got, tt.expected)
+			}
+			if got := tt.platform.String(); got != tt.str {
+				t.Errorf("String() = %q, want %q", got, tt.str)
+			}
+		})
+	}
+}
+
+func TestParsePlatform(t *testing.T) {
+	tests := []struct {
+		platform  string
+		expected  Platform
+		expectErr bool
+	}{
+		{platform: "linux/amd64", expected: Platform{OS: "linux", Architecture: "amd64"}},
+		{platform: "linux/arm/v7", expected: Platform{OS: "linux", Architecture: "arm", Variant: "v7"}},
+		{platform: "windows/amd64:10.0.17763", expected: Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763"}},
+		{platform: "linux", expectErr: true},
+		{platform: "linux/", expectErr: true},
+		{platform: "linux/arm/v7/extra", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.platform, func(t *testing.T) {
+			platform, err := ParsePlatform(tt.platform)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("ParsePlatform() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if platform != tt.expected {
+				t.Errorf("ParsePlatform() = %+v, want %+v", platform, tt.expected)
+			}
+			if !tt.expectErr && platform.String() != tt.platform {
+				t.Errorf("String() = %q, want %q", platform.String(), tt.platform)
 			}
 		})
 	}
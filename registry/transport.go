@@ -0,0 +1,74 @@
+package registry
+
+import (
+	"crypto/tls"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// staticKeychain resolves credentials configured for specific registries
+type staticKeychain map[string]authn.AuthConfig
+
+func (k staticKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	config, ok := k[normalizeRegistry(target.RegistryStr())]
+	if !ok {
+		return authn.Anonymous, nil
+	}
+
+	return authn.FromConfig(config), nil
+}
+
+// normalizeRegistry returns the name go-containerregistry uses for a registry,
+// so docker.io and index.docker.io resolve to the same credentials. Mirrors under
+// a path, such as harbor.example.com/mirror, use the credentials of their host.
+func normalizeRegistry(registry string) string {
+	host, _, _ := strings.Cut(registry, "/")
+
+	reg, err := name.NewRegistry(host)
+	if err != nil {
+		return host
+	}
+
+	return reg.RegistryStr()
+}
+
+// insecureTransport returns a copy of the transport that skips TLS verification
+func insecureTransport(transport http.RoundTripper) http.RoundTripper {
+	t, ok := transport.(*http.Transport)
+	if !ok {
+		return transport
+	}
+
+	t = t.Clone()
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	}
+	t.TLSClientConfig.InsecureSkipVerify = true
+
+	return t
+}
+
+// loggingTransport logs every request made to the registry. Headers are never
+// logged since they carry credentials.
+type loggingTransport struct {
+	next   http.RoundTripper
+	logger *log.Logger
+}
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.logger.Printf("%s %s: %v (%s)", req.Method, req.URL.Redacted(), err, time.Since(start))
+		return nil, err
+	}
+	t.logger.Printf("%s %s: %s (%s)", req.Method, req.URL.Redacted(), res.Status, time.Since(start))
+
+	return res, nil
+}
@@ -0,0 +1,330 @@
+// Package airgap builds and verifies the air-gap image bundles of releases: tarballs
+// with the images of a platform, in the docker-archive or OCI layout formats.
+package airgap
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/klauspost/compress/zstd"
+	reg "github.com/rancher/ecm-distro-tools/registry"
+	"golang.org/x/sync/errgroup"
+)
+
+// Format is the format of the bundle tarball
+type Format string
+
+const (
+	// FormatDockerArchive is the format of docker save, used by the published bundles
+	FormatDockerArchive Format = "docker-archive"
+	// FormatOCI is a tarball of an OCI image layout
+	FormatOCI Format = "oci"
+)
+
+// Compression is the compression of the bundle tarball
+type Compression string
+
+const (
+	CompressionZstd Compression = "zstd"
+	CompressionGzip Compression = "gzip"
+	CompressionNone Compression = "none"
+)
+
+const (
+	// containerdImageNameAnnotation is the annotation containerd reads image names from in OCI layouts
+	containerdImageNameAnnotation = "io.containerd.image.name"
+	ociRefNameAnnotation          = "org.opencontainers.image.ref.name"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Options configure Build
+type Options struct {
+	Format      Format
+	Compression Compression
+	// ConcurrencyLimit is the number of image manifests resolved at once
+	ConcurrencyLimit int
+}
+
+// Build pulls the images of a platform from the registry and writes them as a bundle. The
+// platform's OS version picks the images of a Windows build, e.g. windows/amd64:10.0.17763.
+func Build(ctx context.Context, w io.Writer, client *reg.Client, images []string, platform reg.Platform, opts Options) error {
+	refs := make([]name.Reference, len(images))
+	imgs := make([]v1.Image, len(images))
+
+	// the images read their layers with the context, so it must outlive the group
+	g := new(errgroup.Group)
+	if opts.ConcurrencyLimit > 0 {
+		g.SetLimit(opts.ConcurrencyLimit)
+	}
+	for i, image := range images {
+		i, image := i, image
+		g.Go(func() error {
+			ref, err := name.ParseReference(image)
+			if err != nil {
+				return err
+			}
+			img, err := client.PlatformImage(ctx, ref, platform)
+			if err != nil {
+				return errors.New(image + ": " + err.Error())
+			}
+			refs[i], imgs[i] = ref, img
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	cw, err := compressWriter(w, opts.Compression)
+	if err != nil {
+		return err
+	}
+
+	switch opts.Format {
+	case FormatOCI:
+		err = writeOCI(cw, refs, imgs)
+	case FormatDockerArchive, "":
+		refToImage := make(map[name.Reference]v1.Image, len(refs))
+		for i, ref := range refs {
+			refToImage[ref] = imgs[i]
+		}
+		err = tarball.MultiRefWrite(refToImage, cw)
+	default:
+		err = errors.New("unsupported bundle format: " + string(opts.Format))
+	}
+	if err != nil {
+		cw.Close()
+		return err
+	}
+
+	return cw.Close()
+}
+
+// writeOCI writes the images to an OCI image layout in a temporary directory, then tars it
+func writeOCI(w io.Writer, refs []name.Reference, imgs []v1.Image) error {
+	dir, err := os.MkdirTemp("", "airgap-oci-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	path, err := layout.Write(dir, empty.Index)
+	if err != nil {
+		return err
+	}
+	for i, ref := range refs {
+		if err := path.AppendImage(imgs[i], layout.WithAnnotations(map[string]string{
+			containerdImageNameAnnotation: ref.String(),
+			ociRefNameAnnotation:          ref.Identifier(),
+		})); err != nil {
+			return err
+		}
+	}
+
+	tw := tar.NewWriter(w)
+	err = filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if d.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func compressWriter(w io.Writer, compression Compression) (io.WriteCloser, error) {
+	switch compression {
+	case CompressionZstd, "":
+		return zstd.NewWriter(w)
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionNone:
+		return nopWriteCloser{w}, nil
+	}
+
+	return nil, errors.New("unsupported compression: " + string(compression))
+}
+
+// decompressReader detects the compression of the bundle from its magic bytes
+func decompressReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, zstdMagic):
+		return zstd.NewReader(br)
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+	}
+
+	return br, nil
+}
+
+// Contents returns the names of the images in a bundle, in either format and any compression
+func Contents(r io.Reader) ([]string, error) {
+	dr, err := decompressReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []string
+	found := false
+	tr := tar.NewReader(dr)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+
+		switch header.Name {
+		case "manifest.json":
+			var manifest tarball.Manifest
+			if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+				return nil, err
+			}
+			for _, descriptor := range manifest {
+				images = append(images, descriptor.RepoTags...)
+			}
+			found = true
+		case "index.json":
+			var index v1.IndexManifest
+			if err := json.NewDecoder(tr).Decode(&index); err != nil {
+				return nil, err
+			}
+			for _, descriptor := range index.Manifests {
+				if image, ok := descriptor.Annotations[containerdImageNameAnnotation]; ok {
+					images = append(images, image)
+				}
+			}
+			found = true
+		}
+	}
+	if !found {
+		return nil, errors.New("not a docker-archive or OCI layout bundle")
+	}
+	sort.Strings(images)
+
+	return images, nil
+}
+
+// Verification is the difference between the contents of a bundle and its image list
+type Verification struct {
+	// Missing are the listed images missing from the bundle
+	Missing []string `json:"missing"`
+	// Unexpected are the images in the bundle that aren't listed
+	Unexpected []string `json:"unexpected"`
+}
+
+// OK reports whether the bundle holds exactly the listed images
+func (v *Verification) OK() bool {
+	return len(v.Missing) == 0 && len(v.Unexpected) == 0
+}
+
+// Verify compares the contents of a bundle to the image list. Image names are
+// normalized, so docker.io/rancher/pause:3.6 matches rancher/pause:3.6.
+func Verify(r io.Reader, images []string) (*Verification, error) {
+	contents, err := Contents(r)
+	if err != nil {
+		return nil, err
+	}
+
+	bundled := make(map[string]bool, len(contents))
+	for _, image := range contents {
+		bundled[normalize(image)] = true
+	}
+	listed := make(map[string]bool, len(images))
+
+	verification := &Verification{
+		Missing:    make([]string, 0),
+		Unexpected: make([]string, 0),
+	}
+	for _, image := range images {
+		listed[normalize(image)] = true
+		if !bundled[normalize(image)] {
+			verification.Missing = append(verification.Missing, image)
+		}
+	}
+	for _, image := range contents {
+		if !listed[normalize(image)] {
+			verification.Unexpected = append(verification.Unexpected, image)
+		}
+	}
+
+	return verification, nil
+}
+
+func normalize(image string) string {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return image
+	}
+
+	return ref.Name()
+}
@@ -0,0 +1,194 @@
+package airgap
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	reg "github.com/rancher/ecm-distro-tools/registry"
+)
+
+func TestBuildAndVerify(t *testing.T) {
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(server.Close)
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	for _, image := range []string{"rancher/mirrored-pause:3.6", "rancher/klipper-lb:v0.4.9"} {
+		ref, err := name.ParseReference(host + "/" + image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := remote.WriteIndex(ref, multiPlatformIndex(t)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client := reg.NewClient(host, false)
+	images := []string{"docker.io/rancher/klipper-lb:v0.4.9", "docker.io/rancher/mirrored-pause:3.6"}
+
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{name: "docker-archive zstd", opts: Options{Format: FormatDockerArchive, Compression: CompressionZstd}},
+		{name: "docker-archive gzip", opts: Options{Format: FormatDockerArchive, Compression: CompressionGzip}},
+		{name: "oci uncompressed", opts: Options{Format: FormatOCI, Compression: CompressionNone}},
+		{name: "oci zstd", opts: Options{Format: FormatOCI, Compression: CompressionZstd, ConcurrencyLimit: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var bundle bytes.Buffer
+			if err := Build(context.Background(), &bundle, client, images, reg.Platform{OS: "linux", Architecture: "arm64"}, tt.opts); err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+
+			contents, err := Contents(bytes.NewReader(bundle.Bytes()))
+			if err != nil {
+				t.Fatalf("Contents() error = %v", err)
+			}
+			if !reflect.DeepEqual(contents, images) {
+				t.Errorf("Contents() = %v, want %v", contents, images)
+			}
+
+			verification, err := Verify(bytes.NewReader(bundle.Bytes()), []string{"rancher/mirrored-pause:3.6", "rancher/mirrored-coredns:1.10.1"})
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			expected := &Verification{
+				Missing:    []string{"rancher/mirrored-coredns:1.10.1"},
+				Unexpected: []string{"docker.io/rancher/klipper-lb:v0.4.9"},
+			}
+			if !reflect.DeepEqual(verification, expected) {
+				t.Errorf("Verify() = %+v, want %+v", verification, expected)
+			}
+		})
+	}
+
+	var bundle bytes.Buffer
+	if err := Build(context.Background(), &bundle, client, []string{"docker.io/rancher/missing:v0.0.0"}, reg.Platform{OS: "linux", Architecture: "amd64"}, Options{}); err == nil {
+		t.Error("Build() expected an error for a missing image")
+	}
+
+	// one image per Windows build, the published images set the patch build as the OS version
+	var addenda []mutate.IndexAddendum
+	configs := make(map[string]v1.Hash)
+	for _, osVersion := range []string{"10.0.17763.6189", "10.0.20348.2655"} {
+		img, err := random.Image(64, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		configs[osVersion], err = img.ConfigName()
+		if err != nil {
+			t.Fatal(err)
+		}
+		addenda = append(addenda, mutate.IndexAddendum{
+			Add:        img,
+			Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "windows", Architecture: "amd64", OSVersion: osVersion}},
+		})
+	}
+	windowsRef, err := name.ParseReference(host + "/rancher/windows-pause:3.6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.WriteIndex(windowsRef, mutate.AppendManifests(empty.Index, addenda...)); err != nil {
+		t.Fatal(err)
+	}
+
+	image := "docker.io/rancher/windows-pause:3.6"
+
+	windowsTests := []struct {
+		name      string
+		platform  reg.Platform
+		expected  string
+		expectErr bool
+	}{
+		{
+			name:     "ltsc2019",
+			platform: reg.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763"},
+			expected: "10.0.17763.6189",
+		},
+		{
+			name:     "ltsc2022",
+			platform: reg.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.20348"},
+			expected: "10.0.20348.2655",
+		},
+		{
+			name:      "unpublished build",
+			platform:  reg.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.26100"},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range windowsTests {
+		t.Run(tt.name, func(t *testing.T) {
+			var bundle bytes.Buffer
+			err := Build(context.Background(), &bundle, client, []string{image}, tt.platform, Options{Compression: CompressionNone})
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("Build() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if tt.expectErr {
+				return
+			}
+
+			tag, err := name.NewTag(image)
+			if err != nil {
+				t.Fatal(err)
+			}
+			img, err := tarball.Image(func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(bundle.Bytes())), nil
+			}, &tag)
+			if err != nil {
+				t.Fatal(err)
+			}
+			config, err := img.ConfigName()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config != configs[tt.expected] {
+				t.Errorf("Build() bundled config %s, want the %s image config %s", config, tt.expected, configs[tt.expected])
+			}
+		})
+	}
+}
+
+// multiPlatformIndex returns a random index with linux/amd64 and linux/arm64 images
+func multiPlatformIndex(t *testing.T) v1.ImageIndex {
+	t.Helper()
+
+	idx, err := random.Index(64, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// random indexes don't set platforms
+	var addenda []mutate.IndexAddendum
+	for i, arch := range []string{"amd64", "arm64"} {
+		img, err := idx.Image(manifest.Manifests[i].Digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		descriptor := manifest.Manifests[i]
+		descriptor.Platform = &v1.Platform{OS: "linux", Architecture: arch}
+		addenda = append(addenda, mutate.IndexAddendum{Add: img, Descriptor: descriptor})
+	}
+
+	return mutate.AppendManifests(empty.Index, addenda...)
+}
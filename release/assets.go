@@ -0,0 +1,264 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path"
+	"sort"
+
+	"github.com/google/go-github/v39/github"
+	"golang.org/x/mod/semver"
+)
+
+// AssetPlatform groups the glob patterns of the assets expected for
+// a single platform, e.g. linux/amd64. Assets that are not specific to
+// a platform are listed under "any".
+type AssetPlatform struct {
+	Platform string
+	Patterns []string
+}
+
+// AssetManifest describes the assets expected in the releases of a
+// version line onwards, until a manifest with a newer MinVersion exists.
+type AssetManifest struct {
+	Repo       string
+	MinVersion string
+	Platforms  []AssetPlatform
+}
+
+// AssetVerification contains the result of comparing the assets of
+// a release against its manifest.
+type AssetVerification struct {
+	Tag        string   `json:"tag"`
+	Found      bool     `json:"found"`
+	Missing    []string `json:"missing"`
+	Unexpected []string `json:"unexpected"`
+}
+
+// OK indicates if the release exists and its assets match the manifest.
+func (a AssetVerification) OK() bool {
+	return a.Found && len(a.Missing) == 0 && len(a.Unexpected) == 0
+}
+
+func rke2ImageTarballs(arch string) []string {
+	return []string{
+		"rke2-images*.linux-" + arch + ".tar.gz",
+		"rke2-images*.linux-" + arch + ".tar.zst",
+		"rke2-images*.linux-" + arch + ".txt",
+	}
+}
+
+func rke2LinuxAssets(arch string) []string {
+	return append([]string{
+		"rke2.linux-" + arch,
+		"rke2.linux-" + arch + ".tar.gz",
+		"rke2-images-all.linux-" + arch + ".txt",
+		"sha256sum-" + arch + ".txt",
+	}, rke2ImageTarballs(arch)...)
+}
+
+var rke2WindowsAssets = []string{
+	"rke2.windows-amd64.exe",
+	"rke2.windows-amd64.tar.gz",
+	"rke2-images.windows-amd64.tar.gz",
+	"rke2-images.windows-amd64.tar.zst",
+	"rke2-images.windows-amd64.txt",
+	"rke2-windows-*-amd64*.tar.gz",
+	"sha256sum-windows-amd64.txt",
+}
+
+func k3sLinuxAssets(binary, arch string) []string {
+	return []string{
+		binary,
+		"k3s-airgap-images-" + arch + ".tar",
+		"k3s-airgap-images-" + arch + ".tar.gz",
+		"k3s-airgap-images-" + arch + ".tar.zst",
+		"sha256sum-" + arch + ".txt",
+	}
+}
+
+// rke2PackagingRPMs are the rpms of a rke2-packaging release for an architecture,
+// each pattern matches the rpm built for every supported distribution
+func rke2PackagingRPMs(arch string) []string {
+	return []string{
+		"rke2-agent-*." + arch + ".rpm",
+		"rke2-common-*." + arch + ".rpm",
+		"rke2-server-*." + arch + ".rpm",
+	}
+}
+
+// assetManifests contains the asset manifests for each supported repository,
+// sorted from the oldest to the newest version line.
+var assetManifests = map[string][]AssetManifest{
+	rke2Repo: {
+		{
+			Repo:       rke2Repo,
+			MinVersion: "v1.0",
+			Platforms: []AssetPlatform{
+				{Platform: "linux/amd64", Patterns: rke2LinuxAssets("amd64")},
+				{Platform: "windows/amd64", Patterns: rke2WindowsAssets},
+			},
+		},
+		{
+			Repo:       rke2Repo,
+			MinVersion: "v1.27",
+			Platforms: []AssetPlatform{
+				{Platform: "linux/amd64", Patterns: rke2LinuxAssets("amd64")},
+				{Platform: "linux/arm64", Patterns: rke2LinuxAssets("arm64")},
+				{Platform: "windows/amd64", Patterns: rke2WindowsAssets},
+			},
+		},
+	},
+	rke2PackagingRepo: {
+		{
+			Repo:       rke2PackagingRepo,
+			MinVersion: "v1.0",
+			Platforms: []AssetPlatform{
+				{Platform: "linux/amd64", Patterns: rke2PackagingRPMs("x86_64")},
+			},
+		},
+		{
+			Repo:       rke2PackagingRepo,
+			MinVersion: "v1.27",
+			Platforms: []AssetPlatform{
+				{Platform: "linux/amd64", Patterns: rke2PackagingRPMs("x86_64")},
+				{Platform: "linux/arm64", Patterns: rke2PackagingRPMs("aarch64")},
+			},
+		},
+	},
+	k3sRepo: {
+		{
+			Repo:       k3sRepo,
+			MinVersion: "v1.0",
+			Platforms: []AssetPlatform{
+				{Platform: "any", Patterns: []string{"k3s-images.txt"}},
+				{Platform: "linux/amd64", Patterns: k3sLinuxAssets("k3s", "amd64")},
+				{Platform: "linux/arm64", Patterns: k3sLinuxAssets("k3s-arm64", "arm64")},
+				{Platform: "linux/arm", Patterns: k3sLinuxAssets("k3s-armhf", "arm")},
+			},
+		},
+		{
+			Repo:       k3sRepo,
+			MinVersion: "v1.31",
+			Platforms: []AssetPlatform{
+				{Platform: "any", Patterns: []string{"k3s-images.txt"}},
+				{Platform: "linux/amd64", Patterns: k3sLinuxAssets("k3s", "amd64")},
+				{Platform: "linux/arm64", Patterns: k3sLinuxAssets("k3s-arm64", "arm64")},
+				{Platform: "linux/arm", Patterns: k3sLinuxAssets("k3s-armhf", "arm")},
+				{Platform: "linux/s390x", Patterns: k3sLinuxAssets("k3s-s390x", "s390x")},
+			},
+		},
+	},
+}
+
+// AssetManifestFor returns the asset manifest of the version line
+// the given tag belongs to.
+func AssetManifestFor(repo, tag string) (*AssetManifest, error) {
+	manifests, ok := assetManifests[repo]
+	if !ok {
+		return nil, errors.New("no asset manifest for repository: " + repo)
+	}
+
+	majorMinor := semver.MajorMinor(tag)
+	if majorMinor == "" {
+		return nil, errors.New("the tag isn't a valid semver: " + tag)
+	}
+
+	for i := len(manifests) - 1; i >= 0; i-- {
+		if semver.Compare(majorMinor, manifests[i].MinVersion) >= 0 {
+			return &manifests[i], nil
+		}
+	}
+
+	return nil, errors.New("no asset manifest for " + repo + " " + tag)
+}
+
+// Compare matches the given asset names against the manifest patterns and
+// returns the patterns without any matching asset and the assets that
+// don't match any pattern.
+func (m *AssetManifest) Compare(names []string) ([]string, []string, error) {
+	matched := make(map[string]bool, len(names))
+	missing := make([]string, 0)
+
+	for _, platform := range m.Platforms {
+		for _, pattern := range platform.Patterns {
+			found := false
+			for _, name := range names {
+				ok, err := path.Match(pattern, name)
+				if err != nil {
+					return nil, nil, err
+				}
+				if ok {
+					matched[name] = true
+					found = true
+				}
+			}
+			if !found {
+				missing = append(missing, pattern)
+			}
+		}
+	}
+
+	unexpected := make([]string, 0)
+	for _, name := range names {
+		if !matched[name] {
+			unexpected = append(unexpected, name)
+		}
+	}
+	sort.Strings(unexpected)
+
+	return missing, unexpected, nil
+}
+
+// VerifyAssets compares the assets of each of the given release
+// tags against the asset manifest of its version line.
+func VerifyAssets(ctx context.Context, client *github.Client, owner, repo string, tags []string) ([]AssetVerification, error) {
+	if len(tags) == 0 {
+		return nil, errors.New("no tags provided")
+	}
+
+	verifications := make([]AssetVerification, 0, len(tags))
+
+	for _, tag := range tags {
+		if tag == "" {
+			continue
+		}
+
+		manifest, err := AssetManifestFor(repo, tag)
+		if err != nil {
+			return nil, err
+		}
+
+		verification := AssetVerification{Tag: tag}
+
+		release, _, err := client.Repositories.GetReleaseByTag(ctx, owner, repo, tag)
+		if err != nil {
+			switch err := err.(type) {
+			case *github.ErrorResponse:
+				if err.Response.StatusCode != http.StatusNotFound {
+					return nil, err
+				}
+				verifications = append(verifications, verification)
+				continue
+			default:
+				return nil, err
+			}
+		}
+		verification.Found = true
+
+		names := make([]string, len(release.Assets))
+		for i, asset := range release.Assets {
+			names[i] = asset.GetName()
+		}
+
+		verification.Missing, verification.Unexpected, err = manifest.Compare(names)
+		if err != nil {
+			return nil, err
+		}
+
+		verifications = append(verifications, verification)
+	}
+
+	return verifications, nil
+}
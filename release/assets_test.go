@@ -0,0 +1,117 @@
+package release
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAssetManifestFor(t *testing.T) {
+	tests := []struct {
+		repo           string
+		tag            string
+		wantMinVersion string
+		wantErr        bool
+	}{
+		{
+			repo:           "rke2",
+			tag:            "v1.26.15+rke2r1",
+			wantMinVersion: "v1.0",
+		},
+		{
+			repo:           "rke2",
+			tag:            "v1.30.4-rc1+rke2r1",
+			wantMinVersion: "v1.27",
+		},
+		{
+			repo:           "k3s",
+			tag:            "v1.31.0+k3s1",
+			wantMinVersion: "v1.31",
+		},
+		{
+			repo:           "rke2-packaging",
+			tag:            "v1.30.4+rke2r1.testing.0",
+			wantMinVersion: "v1.27",
+		},
+		{
+			repo:    "rke2-packing",
+			tag:     "v1.30.4+rke2r1.testing.0",
+			wantErr: true,
+		},
+		{
+			repo:    "rke2",
+			tag:     "1.30.4",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.repo+"/"+tt.tag, func(t *testing.T) {
+			manifest, err := AssetManifestFor(tt.repo, tt.tag)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AssetManifestFor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if manifest.MinVersion != tt.wantMinVersion {
+				t.Errorf("AssetManifestFor() = %v, want %v", manifest.MinVersion, tt.wantMinVersion)
+			}
+		})
+	}
+}
+
+func TestAssetManifestCompare(t *testing.T) {
+	manifest := AssetManifest{
+		Repo:       "k3s",
+		MinVersion: "v1.0",
+		Platforms: []AssetPlatform{
+			{Platform: "any", Patterns: []string{"k3s-images.txt"}},
+			{Platform: "linux/amd64", Patterns: []string{"k3s", "k3s-airgap-images-amd64.tar*", "sha256sum-amd64.txt"}},
+		},
+	}
+	names := []string{
+		"k3s",
+		"k3s-airgap-images-amd64.tar.gz",
+		"k3s-airgap-images-amd64.tar.zst",
+		"k3s-images.txt",
+		"k3s-debug.log",
+	}
+
+	missing, unexpected, err := manifest.Compare(names)
+	if err != nil {
+		t.Fatalf("Compare() error = %v", err)
+	}
+	if strings.Join(missing, ",") != "sha256sum-amd64.txt" {
+		t.Errorf("Compare() missing = %v, want [sha256sum-amd64.txt]", missing)
+	}
+	if strings.Join(unexpected, ",") != "k3s-debug.log" {
+		t.Errorf("Compare() unexpected = %v, want [k3s-debug.log]", unexpected)
+	}
+}
+
+func TestRKE2PackagingAssetManifest(t *testing.T) {
+	manifest, err := AssetManifestFor("rke2-packaging", "v1.30.4+rke2r1.stable.0")
+	if err != nil {
+		t.Fatalf("AssetManifestFor() error = %v", err)
+	}
+
+	var names []string
+	for _, dist := range []string{"el8", "el9"} {
+		for _, arch := range []string{"x86_64", "aarch64"} {
+			for _, pkg := range []string{"agent", "common", "server"} {
+				names = append(names, "rke2-"+pkg+"-1.30.4.rke2r1-0."+dist+"."+arch+".rpm")
+			}
+		}
+	}
+	names = append(names, "rke2-common-1.30.4.rke2r1-0.el8.src.rpm")
+
+	missing, unexpected, err := manifest.Compare(names)
+	if err != nil {
+		t.Fatalf("Compare() error = %v", err)
+	}
+	if len(missing) != 0 {
+		t.Errorf("Compare() missing = %v, want none", missing)
+	}
+	if strings.Join(unexpected, ",") != "rke2-common-1.30.4.rke2r1-0.el8.src.rpm" {
+		t.Errorf("Compare() unexpected = %v, want the source rpm", unexpected)
+	}
+}
@@ -0,0 +1,240 @@
+package release
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// checksumFilesPattern matches the checksum files published with RKE2 and K3s releases.
+const checksumFilesPattern = "sha256sum*.txt"
+
+// ChecksumMismatch is an asset whose computed checksum differs from the one
+// published in a checksum file.
+type ChecksumMismatch struct {
+	Asset        string `json:"asset"`
+	ChecksumFile string `json:"checksumFile"`
+	Expected     string `json:"expected"`
+	Actual       string `json:"actual"`
+}
+
+// ChecksumVerification contains the result of verifying the assets of a release
+// against its published checksum files.
+type ChecksumVerification struct {
+	ChecksumFiles []string           `json:"checksumFiles"`
+	Verified      []string           `json:"verified"`
+	Mismatches    []ChecksumMismatch `json:"mismatches"`
+	Uncovered     []string           `json:"uncovered"`
+	Missing       []string           `json:"missing"`
+}
+
+// OK indicates if every asset is covered by a checksum file and all checksums match.
+func (c ChecksumVerification) OK() bool {
+	return len(c.ChecksumFiles) > 0 && len(c.Mismatches) == 0 && len(c.Uncovered) == 0 && len(c.Missing) == 0
+}
+
+// ParseChecksums parses a file in the sha256sum format and returns a
+// map of file names to their checksums.
+func ParseChecksums(r io.Reader) (map[string]string, error) {
+	checksums := make(map[string]string)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, errors.New("malformed checksum line: " + scanner.Text())
+		}
+
+		// binary mode entries are prefixed by '*' and some files list paths relative to the build directory
+		name := path.Base(strings.TrimPrefix(fields[1], "*"))
+		checksums[name] = strings.ToLower(fields[0])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return checksums, nil
+}
+
+// SHA256 streams the named file from the filesystem and returns its hex encoded SHA-256 checksum.
+func SHA256(fsys fs.FS, name string) (string, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// PublishedChecksums returns the checksums of the assets listed in the checksum files
+// of a release, failing if checksum files disagree on the checksum of an asset.
+func PublishedChecksums(fsys fs.FS) (map[string]string, error) {
+	checksumFiles, err := fs.Glob(fsys, checksumFilesPattern)
+	if err != nil {
+		return nil, err
+	}
+
+	listed, err := readChecksumFiles(fsys, checksumFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	published := make(map[string]string, len(listed))
+	for name, checksums := range listed {
+		for _, checksum := range checksums {
+			if existing, ok := published[name]; ok && existing != checksum {
+				return nil, errors.New("conflicting checksums published for " + name)
+			}
+			published[name] = checksum
+		}
+	}
+
+	return published, nil
+}
+
+// readChecksumFiles parses the checksum files, returning the checksums of the listed
+// assets by asset name and checksum file
+func readChecksumFiles(fsys fs.FS, checksumFiles []string) (map[string]map[string]string, error) {
+	listed := make(map[string]map[string]string)
+	for _, checksumFile := range checksumFiles {
+		f, err := fsys.Open(checksumFile)
+		if err != nil {
+			return nil, err
+		}
+		checksums, err := ParseChecksums(f)
+		f.Close()
+		if err != nil {
+			return nil, errors.New("failed to parse " + checksumFile + ": " + err.Error())
+		}
+
+		for name, checksum := range checksums {
+			if _, ok := listed[name]; !ok {
+				listed[name] = make(map[string]string)
+			}
+			listed[name][checksumFile] = checksum
+		}
+	}
+
+	return listed, nil
+}
+
+// VerifyChecksums computes the SHA-256 checksum of every asset in the filesystem covered
+// by a checksum file and compares it against every checksum file listing it. Assets are
+// streamed concurrently, with at most concurrencyLimit downloads at a time.
+func VerifyChecksums(ctx context.Context, fsys fs.FS, concurrencyLimit int) (*ChecksumVerification, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	verification := ChecksumVerification{
+		ChecksumFiles: make([]string, 0),
+		Verified:      make([]string, 0),
+		Mismatches:    make([]ChecksumMismatch, 0),
+		Uncovered:     make([]string, 0),
+		Missing:       make([]string, 0),
+	}
+
+	assets := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if ok, _ := path.Match(checksumFilesPattern, entry.Name()); ok {
+			verification.ChecksumFiles = append(verification.ChecksumFiles, entry.Name())
+			continue
+		}
+		assets[entry.Name()] = true
+	}
+	sort.Strings(verification.ChecksumFiles)
+
+	expected, err := readChecksumFiles(fsys, verification.ChecksumFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	for name := range expected {
+		if !assets[name] {
+			verification.Missing = append(verification.Missing, name)
+		}
+	}
+
+	var mu sync.Mutex
+	errGroup, ctx := errgroup.WithContext(ctx)
+	errGroup.SetLimit(concurrencyLimit)
+
+	for name := range assets {
+		checksums, ok := expected[name]
+		if !ok {
+			verification.Uncovered = append(verification.Uncovered, name)
+			continue
+		}
+
+		name := name
+		errGroup.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			actual, err := SHA256(fsys, name)
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			verified := true
+			for checksumFile, checksum := range checksums {
+				if checksum != actual {
+					verified = false
+					verification.Mismatches = append(verification.Mismatches, ChecksumMismatch{
+						Asset:        name,
+						ChecksumFile: checksumFile,
+						Expected:     checksum,
+						Actual:       actual,
+					})
+				}
+			}
+			if verified {
+				verification.Verified = append(verification.Verified, name)
+			}
+
+			return nil
+		})
+	}
+	if err := errGroup.Wait(); err != nil {
+		return nil, err
+	}
+
+	sort.Strings(verification.Verified)
+	sort.Strings(verification.Uncovered)
+	sort.Strings(verification.Missing)
+	sort.Slice(verification.Mismatches, func(i, j int) bool {
+		if verification.Mismatches[i].Asset != verification.Mismatches[j].Asset {
+			return verification.Mismatches[i].Asset < verification.Mismatches[j].Asset
+		}
+		return verification.Mismatches[i].ChecksumFile < verification.Mismatches[j].ChecksumFile
+	})
+
+	return &verification, nil
+}
@@ -0,0 +1,64 @@
+package release
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseChecksums(t *testing.T) {
+	content := "abc123  k3s\nDEF456 *dist/artifacts/k3s-airgap-images-amd64.tar.gz\n\n"
+
+	checksums, err := ParseChecksums(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("ParseChecksums() error = %v", err)
+	}
+	if checksums["k3s"] != "abc123" {
+		t.Errorf("ParseChecksums() k3s = %v, want abc123", checksums["k3s"])
+	}
+	if checksums["k3s-airgap-images-amd64.tar.gz"] != "def456" {
+		t.Errorf("ParseChecksums() airgap = %v, want def456", checksums["k3s-airgap-images-amd64.tar.gz"])
+	}
+
+	if _, err := ParseChecksums(strings.NewReader("abc123 k3s extra\n")); err == nil {
+		t.Error("ParseChecksums() expected error for malformed line")
+	}
+}
+
+func TestVerifyChecksums(t *testing.T) {
+	k3sSum, err := SHA256(fstest.MapFS{"k3s": {Data: []byte("k3s")}}, "k3s")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := fstest.MapFS{
+		"k3s":                            {Data: []byte("k3s")},
+		"k3s-airgap-images-amd64.tar.gz": {Data: []byte("tampered")},
+		"k3s-images.txt":                 {Data: []byte("rancher/mirrored-pause:3.6")},
+		"sha256sum-amd64.txt": {
+			Data: []byte(k3sSum + "  k3s\n" + k3sSum + "  k3s-airgap-images-amd64.tar.gz\n" + k3sSum + "  k3s-airgap-images-amd64.tar.zst\n"),
+		},
+	}
+
+	verification, err := VerifyChecksums(context.Background(), fsys, 2)
+	if err != nil {
+		t.Fatalf("VerifyChecksums() error = %v", err)
+	}
+
+	if strings.Join(verification.Verified, ",") != "k3s" {
+		t.Errorf("VerifyChecksums() verified = %v, want [k3s]", verification.Verified)
+	}
+	if len(verification.Mismatches) != 1 || verification.Mismatches[0].Asset != "k3s-airgap-images-amd64.tar.gz" {
+		t.Errorf("VerifyChecksums() mismatches = %v, want k3s-airgap-images-amd64.tar.gz", verification.Mismatches)
+	}
+	if strings.Join(verification.Uncovered, ",") != "k3s-images.txt" {
+		t.Errorf("VerifyChecksums() uncovered = %v, want [k3s-images.txt]", verification.Uncovered)
+	}
+	if strings.Join(verification.Missing, ",") != "k3s-airgap-images-amd64.tar.zst" {
+		t.Errorf("VerifyChecksums() missing = %v, want [k3s-airgap-images-amd64.tar.zst]", verification.Missing)
+	}
+	if verification.OK() {
+		t.Error("VerifyChecksums() expected verification to fail")
+	}
+}
@@ -6,11 +6,15 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	gitHTTP "github.com/go-git/go-git/v5/plumbing/transport/http"
 	"github.com/google/go-github/v39/github"
 	ecmExec "github.com/rancher/ecm-distro-tools/exec"
 	"github.com/rancher/ecm-distro-tools/release"
 	"github.com/rancher/ecm-distro-tools/repository"
+	"golang.org/x/mod/module"
 	"golang.org/x/mod/semver"
 )
 
@@ -18,6 +22,9 @@ const (
 	cliOrg           = "rancher"
 	cliRepo          = "cli"
 	cliImagesBaseURL = "https://github.com/" + cliOrg + "/" + cliRepo + "/releases"
+
+	rancherAPIsModule   = "github.com/rancher/rancher/pkg/apis"
+	rancherClientModule = "github.com/rancher/rancher/pkg/client"
 )
 
 // CreateRelease will create a new tag and a new release with given params.
@@ -85,13 +92,24 @@ func ReleaseBranchFromTag(tag string) (string, error) {
 	return majorMinor, nil
 }
 
-func UpdateRancherReferences(ctx context.Context, ghClient *github.Client, tag, rancherRepoName, rancherRepoOwner, rancherUpstreamURL, cliReleaseBranch, cliRepoName, githubUsername string, dryRun bool) error {
+func UpdateRancherReferences(ctx context.Context, ghClient *github.Client, tag, rancherRepoName, rancherRepoOwner, cliUpstreamURL, cliReleaseBranch, cliRepoName, githubUsername, githubToken string, dryRun bool) error {
 	commitSHA, err := getRancherPkgSHA(ctx, ghClient, rancherRepoOwner, rancherRepoName, tag)
 	if err != nil {
 		return err
 	}
 
-	if err := updateRancherReferencesAndPush(tag, cliReleaseBranch, commitSHA, dryRun); err != nil {
+	commit, _, err := ghClient.Git.GetCommit(ctx, rancherRepoOwner, rancherRepoName, commitSHA)
+	if err != nil {
+		return fmt.Errorf("error getting commit %s: %v", commitSHA, err)
+	}
+
+	version, err := rancherPseudoVersion(commitSHA, commit.GetCommitter().GetDate())
+	if err != nil {
+		return err
+	}
+
+	auth := &gitHTTP.BasicAuth{Username: githubUsername, Password: githubToken}
+	if err := updateRancherReferencesAndPush(tag, cliUpstreamURL, cliReleaseBranch, version, auth, dryRun); err != nil {
 		return err
 	}
 
@@ -123,25 +141,52 @@ func UpdateCLIRefsBranchName(tag string) string {
 	return "update-cli-build-refs-" + tag
 }
 
-func updateRancherReferencesAndPush(tag, releaseBranch, rancherCommitSHA string, dryRun bool) error {
-	updateScriptVars := map[string]string{
-		"Tag":              tag,
-		"ReleaseBranch":    releaseBranch,
-		"RancherCommitSHA": rancherCommitSHA,
-		"DryRun":           strconv.FormatBool(dryRun),
-		"BranchName":       UpdateCLIRefsBranchName(tag),
+// rancherPseudoVersion returns the go module pseudo-version of a rancher commit, the
+// rancher pkg modules aren't tagged so go get resolves commits to v0.0.0 pseudo-versions
+func rancherPseudoVersion(commitSHA string, commitTime time.Time) (string, error) {
+	if len(commitSHA) < 12 {
+		return "", errors.New("invalid commit sha: " + commitSHA)
 	}
 
-	fmt.Println("creating update cli references script template")
-	updateScriptOut, err := ecmExec.RunTemplatedScript("./", "replace_cli_ref.sh", updateRancherReferencesScript, nil, updateScriptVars)
+	return module.PseudoVersion("", "", commitTime.UTC(), commitSHA[:12]), nil
+}
+
+func updateRancherReferencesAndPush(tag, cliUpstreamURL, releaseBranch, rancherPkgVersion string, auth transport.AuthMethod, dryRun bool) error {
+	diff, err := repository.UpdateBranch(&repository.UpdateBranchOpts{
+		Dir:            "./",
+		UpstreamURL:    cliUpstreamURL,
+		UpstreamBranch: releaseBranch,
+		Branch:         UpdateCLIRefsBranchName(tag),
+		CommitMessage:  "Update Rancher refs to " + tag,
+		Edits:          rancherReferencesEdits(rancherPkgVersion),
+		AfterEdit: func(dir string) error {
+			fmt.Println("running go mod tidy")
+			_, err := ecmExec.RunCommand(dir, "go", "mod", "tidy")
+			return err
+		},
+		Auth:   auth,
+		DryRun: dryRun,
+	})
 	if err != nil {
-		fmt.Println("error executing script")
 		return err
 	}
-	fmt.Println(updateScriptOut)
+	fmt.Println(diff)
 	return nil
 }
 
+// rancherReferencesEdits set the version of the rancher pkg modules required by the CLI
+func rancherReferencesEdits(rancherPkgVersion string) []repository.FileEdit {
+	return []repository.FileEdit{
+		{
+			Path: "go.mod",
+			Edit: repository.SetGoModRequire(map[string]string{
+				rancherAPIsModule:   rancherPkgVersion,
+				rancherClientModule: rancherPkgVersion,
+			}),
+		},
+	}
+}
+
 func createCLIReferencesPR(ctx context.Context, ghClient *github.Client, tag, releaseBranch, cliRepoName, rancherRepoOwner, githubUsername string) error {
 	pull := &github.NewPullRequest{
 		Title:               github.String("[" + releaseBranch + "]" + "Bump Rancher CLI version to " + tag),
@@ -160,54 +205,3 @@ func createCLIReferencesPR(ctx context.Context, ghClient *github.Client, tag, re
 
 	return nil
 }
-
-const updateRancherReferencesScript = `#!/bin/sh
-set -ex
-OS=$(uname -s)
-# Set variables (these are populated by Go's template engine)
-DRY_RUN="{{ .DryRun }}"
-TAG="{{ .Tag }}"
-BRANCH_NAME="{{ .BranchName }}"
-RELEASE_BRANCH="{{ .ReleaseBranch }}"
-RANCHER_COMMIT_SHA="{{ .RancherCommitSHA }}"
-UPSTREAM_URL="{{ .CLIUpstreamURL }}"
-
-# Add upstream remote if it doesn't exist
-# Note: Using ls | grep is not recommended for general use, but it's okay here
-# since we're only checking for 'rancher'
-git remote -v | grep -w upstream || git remote add upstream "$UPSTREAM_URL"
-git fetch upstream
-git stash
-
-# Delete the branch if it exists, then create a new one based on upstream
-git branch -D "${BRANCH_NAME}" > /dev/null 2>&1 || true
-git checkout -B "${BRANCH_NAME}" "upstream/$RELEASE_BRANCH"
-# git clean -xfd
-
-# Function to update the file
-update_go_mod() {
-	echo "Updating pkg/apis module..."
-	go get "github.com/rancher/rancher/pkg/apis@$RANCHER_COMMIT_SHA"
-	sleep 2
-
-	echo "Updating pkg/client module..."
-	go get "github.com/rancher/rancher/pkg/client@$RANCHER_COMMIT_SHA"
-
-	sleep 2
-	go mod tidy
-}
-
-# Run the update function
-update_go_mod
-
-git add go.mod go.sum
-
-# Cleaning temp files/scripts
-git clean -f
-
-git commit --signoff -m "Update Rancher refs to ${RANCHER_VERSION}"
-
-# Push the changes if not a dry run
-if [ "${DRY_RUN}" = false ]; then
-	git push --set-upstream origin "${BRANCH_NAME}" # run git remote -v for your origin
-fi`
@@ -0,0 +1,107 @@
+package release
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// Component is a component bundled in a k3s or rke2 release
+type Component struct {
+	Name    string
+	Version string
+	// Chart is set for the helm charts bundled in rke2 releases
+	Chart bool
+}
+
+// Components returns the versions of the components bundled in a k3s or rke2
+// release, collected the same way as for the release notes. Components whose
+// version can't be found are left out.
+func Components(repo, milestone string) ([]Component, error) {
+	k8sVersion := strings.Split(milestone, "+")[0]
+	if idx := strings.Index(k8sVersion, "-rc"); idx != -1 {
+		k8sVersion = k8sVersion[:idx]
+	}
+	majorMinor := strings.TrimPrefix(semver.MajorMinor(k8sVersion), "v")
+	if majorMinor == "" {
+		return nil, errors.New("invalid milestone: " + milestone)
+	}
+
+	commonRD := releaseNoteData{
+		Milestone:  milestone,
+		MajorMinor: majorMinor,
+	}
+
+	var components []Component
+	add := func(name, version string, chart bool) {
+		if version != "" {
+			components = append(components, Component{Name: name, Version: version, Chart: chart})
+		}
+	}
+
+	switch repo {
+	case k3sRepo:
+		rd := k3sReleaseNoteData{
+			releaseNoteData: commonRD,
+			K8sVersion:      k8sVersion,
+		}
+		if err := rd.Fill(milestone); err != nil {
+			return nil, err
+		}
+
+		add("kubernetes", k8sVersion, false)
+		add("kine", rd.KineVersion, false)
+		add("etcd", rd.EtcdVersion, false)
+		add("containerd", rd.ContainerdVersion, false)
+		add("runc", rd.RuncVersion, false)
+		add("flannel", rd.FlannelVersion, false)
+		add("metrics-server", rd.MetricsServerVersion, false)
+		add("traefik", rd.TraefikVersion, false)
+		add("coredns", imageTagVersion("coredns", repo, milestone), false)
+		add("helm-controller", goModLibVersion("helm-controller", repo, milestone), false)
+		add("local-path-provisioner", rd.LocalPathProvisionerVersion, false)
+	case rke2Repo:
+		rd := rke2ReleaseNoteData{
+			releaseNoteData: commonRD,
+			K8sVersion:      k8sVersion,
+		}
+		if err := rd.Fill(milestone); err != nil {
+			return nil, err
+		}
+
+		add("kubernetes", k8sVersion, false)
+		add("etcd", rd.EtcdVersion, false)
+		add("containerd", rd.ContainerdVersion, false)
+		add("runc", rd.RuncVersion, false)
+		add("metrics-server", rd.MetricsServerVersion, false)
+		add("coredns", imageTagVersion("coredns", repo, milestone), false)
+		add("ingress-nginx", rd.IngressNginxVersion, false)
+		add("helm-controller", goModLibVersion("helm-controller", repo, milestone), false)
+		add("flannel", rd.FlannelVersion, false)
+		add("canal-calico", rd.CanalCalicoVersion, false)
+		add("calico", rd.CalicoVersion, false)
+		add("cilium", rd.CiliumVersion, false)
+		add("multus", rd.MultusVersion, false)
+
+		charts, err := rke2ChartsVersion(milestone)
+		if err != nil {
+			return nil, err
+		}
+		for filename, chart := range charts {
+			add(strings.TrimSuffix(filename, ".yaml"), chart.Version, true)
+		}
+	default:
+		return nil, errors.New("invalid repo: it must be k3s or rke2, received " + repo)
+	}
+
+	sort.SliceStable(components, func(i, j int) bool {
+		if components[i].Chart != components[j].Chart {
+			return !components[i].Chart
+		}
+		return components[i].Name < components[j].Name
+	})
+
+	return components, nil
+}
@@ -0,0 +1,157 @@
+package release
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/google/go-github/v39/github"
+)
+
+// DeletedAsset is an asset removed from a release, as recorded in the audit log
+type DeletedAsset struct {
+	Name   string `json:"name"`
+	ID     int64  `json:"id"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+	Backup string `json:"backup"`
+	// Deleted is false when the deletion failed after the asset was backed up
+	Deleted bool `json:"deleted"`
+}
+
+// AssetDeletion is the audit record of a deletion of release assets
+type AssetDeletion struct {
+	Owner      string         `json:"owner"`
+	Repo       string         `json:"repo"`
+	Tag        string         `json:"tag"`
+	Prerelease bool           `json:"prerelease"`
+	User       string         `json:"user,omitempty"`
+	Filters    []string       `json:"filters"`
+	Time       time.Time      `json:"time"`
+	Assets     []DeletedAsset `json:"assets"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// MatchAssets returns the assets of a release whose names match any of the glob filters, sorted by name
+func MatchAssets(release *github.RepositoryRelease, filters []string) ([]*github.ReleaseAsset, error) {
+	if len(filters) == 0 {
+		return nil, errors.New("at least one filter is required")
+	}
+
+	var matches []*github.ReleaseAsset
+	for _, asset := range release.Assets {
+		for _, filter := range filters {
+			ok, err := path.Match(filter, asset.GetName())
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				matches = append(matches, asset)
+				break
+			}
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].GetName() < matches[j].GetName()
+	})
+
+	return matches, nil
+}
+
+// BackupAssets copies the given assets from the release filesystem to dir, recording
+// the checksum of each copy so the backup can be verified before restoring it.
+func BackupAssets(fsys fs.FS, assets []*github.ReleaseAsset, dir string) ([]DeletedAsset, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	backups := make([]DeletedAsset, 0, len(assets))
+	for _, asset := range assets {
+		backup := filepath.Join(dir, asset.GetName())
+
+		sum, err := copyAsset(fsys, asset.GetName(), backup)
+		if err != nil {
+			return nil, errors.New("failed to back up " + asset.GetName() + ": " + err.Error())
+		}
+
+		backups = append(backups, DeletedAsset{
+			Name:   asset.GetName(),
+			ID:     asset.GetID(),
+			Size:   asset.GetSize(),
+			SHA256: sum,
+			Backup: backup,
+		})
+	}
+
+	return backups, nil
+}
+
+func copyAsset(fsys fs.FS, name, dst string) (string, error) {
+	src, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), src); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// DeleteAssets deletes the backed up assets from a release, marking each one as deleted
+// in the given slice. It stops at the first failure so the audit record stays accurate.
+func DeleteAssets(ctx context.Context, client *github.Client, owner, repo string, assets []DeletedAsset) error {
+	for i := range assets {
+		if _, err := client.Repositories.DeleteReleaseAsset(ctx, owner, repo, assets[i].ID); err != nil {
+			return errors.New("failed to delete " + assets[i].Name + ": " + err.Error())
+		}
+		assets[i].Deleted = true
+	}
+
+	return nil
+}
+
+// WriteAudit appends the audit record of a deletion to a JSON lines file
+func WriteAudit(file string, deletion *AssetDeletion) error {
+	b, err := json.Marshal(deletion)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
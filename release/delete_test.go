@@ -0,0 +1,136 @@
+package release
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-github/v39/github"
+)
+
+func testRelease(names ...string) *github.RepositoryRelease {
+	release := &github.RepositoryRelease{TagName: github.String("v1.30.4-rc1+rke2r1")}
+	for i, name := range names {
+		release.Assets = append(release.Assets, &github.ReleaseAsset{
+			ID:   github.Int64(int64(i + 1)),
+			Name: github.String(name),
+		})
+	}
+
+	return release
+}
+
+func TestMatchAssets(t *testing.T) {
+	release := testRelease("rke2.linux-amd64", "rke2-images.linux-amd64.tar.zst", "rke2-images.linux-arm64.tar.zst", "sha256sum-amd64.txt")
+
+	tests := []struct {
+		name      string
+		filters   []string
+		expected  string
+		expectErr bool
+	}{
+		{
+			name:     "single filter",
+			filters:  []string{"rke2-images*"},
+			expected: "rke2-images.linux-amd64.tar.zst,rke2-images.linux-arm64.tar.zst",
+		},
+		{
+			name:     "multiple filters",
+			filters:  []string{"sha256sum-*.txt", "rke2.linux-*"},
+			expected: "rke2.linux-amd64,sha256sum-amd64.txt",
+		},
+		{
+			name:     "no matches",
+			filters:  []string{"*.rpm"},
+			expected: "",
+		},
+		{
+			name:      "no filters",
+			expectErr: true,
+		},
+		{
+			name:      "invalid filter",
+			filters:   []string{"["},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assets, err := MatchAssets(release, tt.filters)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("MatchAssets() error = %v, expectErr %v", err, tt.expectErr)
+			}
+
+			var names []string
+			for _, asset := range assets {
+				names = append(names, asset.GetName())
+			}
+			if strings.Join(names, ",") != tt.expected {
+				t.Errorf("MatchAssets() = %v, want %s", names, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBackupAssets(t *testing.T) {
+	fsys := fstest.MapFS{
+		"sha256sum-amd64.txt": {Data: []byte("abc  rke2.linux-amd64\n")},
+	}
+	release := testRelease("sha256sum-amd64.txt")
+	dir := t.TempDir()
+
+	backups, err := BackupAssets(fsys, release.Assets, dir)
+	if err != nil {
+		t.Fatalf("BackupAssets() error = %v", err)
+	}
+	if len(backups) != 1 {
+		t.Fatalf("BackupAssets() returned %d backups, want 1", len(backups))
+	}
+
+	b, err := os.ReadFile(backups[0].Backup)
+	if err != nil {
+		t.Fatalf("failed to read backup: %v", err)
+	}
+	if string(b) != "abc  rke2.linux-amd64\n" {
+		t.Errorf("backup content = %q", b)
+	}
+
+	sum, err := SHA256(fsys, "sha256sum-amd64.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backups[0].SHA256 != sum {
+		t.Errorf("backup sha256 = %s, want %s", backups[0].SHA256, sum)
+	}
+
+	auditLog := filepath.Join(dir, "audit.jsonl")
+	for i := 0; i < 2; i++ {
+		if err := WriteAudit(auditLog, &AssetDeletion{Tag: "v1.30.4-rc1+rke2r1", Assets: backups}); err != nil {
+			t.Fatalf("WriteAudit() error = %v", err)
+		}
+	}
+
+	f, err := os.Open(auditLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var records int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var deletion AssetDeletion
+		if err := json.Unmarshal(scanner.Bytes(), &deletion); err != nil {
+			t.Fatalf("invalid audit record: %v", err)
+		}
+		records++
+	}
+	if records != 2 {
+		t.Errorf("audit log has %d records, want 2", records)
+	}
+}
@@ -7,7 +7,11 @@ import (
 	"io"
 	"io/fs"
 	"net/http"
+	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,15 +20,22 @@ import (
 
 // FS implements fs.FS for GitHub release assets
 type FS struct {
-	ctx     context.Context
-	client  *github.Client
-	owner   string
-	repo    string
-	tag     string
-	release *github.RepositoryRelease
-	assets  map[string]*github.ReleaseAsset
+	ctx      context.Context
+	client   *github.Client
+	owner    string
+	repo     string
+	tag      string
+	release  *github.RepositoryRelease
+	assets   map[string]*github.ReleaseAsset
+	cacheDir string
+	// cacheMaxSize is the size of the largest asset cached
+	cacheMaxSize int64
 }
 
+// DefaultCacheMaxSize is the size of the largest asset cached by default, large enough for
+// images lists, checksum files and manifests but not for binaries and images tarballs
+const DefaultCacheMaxSize = 10 << 20
+
 // NewFS creates a new filesystem for accessing GitHub release assets
 func NewFS(ctx context.Context, client *github.Client, owner, repo, tag string) (*FS, error) {
 	if tag == "" {
@@ -54,13 +65,41 @@ func NewFS(ctx context.Context, client *github.Client, owner, repo, tag string)
 	return fs, nil
 }
 
+// NewCachedFS creates a new filesystem for accessing GitHub release assets that
+// keeps a copy of the downloaded assets up to maxSize bytes in cacheDir, larger assets
+// are always downloaded. Cached copies are keyed by the asset ID and its last update
+// time, so re-uploaded assets are downloaded again.
+func NewCachedFS(ctx context.Context, client *github.Client, owner, repo, tag, cacheDir string, maxSize int64) (*FS, error) {
+	if cacheDir == "" {
+		return nil, errors.New("invalid cache dir provided")
+	}
+
+	fs, err := NewFS(ctx, client, owner, repo, tag)
+	if err != nil {
+		return nil, err
+	}
+	fs.cacheDir = cacheDir
+	fs.cacheMaxSize = maxSize
+
+	return fs, nil
+}
+
+// Release returns the GitHub release backing the filesystem
+func (r *FS) Release() *github.RepositoryRelease {
+	return r.release
+}
+
+func cleanName(name string) string {
+	name = filepath.Clean(name)
+	return strings.TrimPrefix(name, "/")
+}
+
 // Open implements fs.FS for a GitHub release, treating assets as a filesystem
 func (r *FS) Open(name string) (fs.File, error) {
 	// Clean and normalize the path
-	name = filepath.Clean(name)
-	name = strings.TrimPrefix(name, "/")
+	name = cleanName(name)
 	if name == "." {
-		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		return &releaseDir{fs: r}, nil
 	}
 
 	asset, ok := r.assets[name]
@@ -68,7 +107,15 @@ func (r *FS) Open(name string) (fs.File, error) {
 		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
 	}
 
-	rc, _, err := r.client.Repositories.DownloadReleaseAsset(r.ctx, r.owner, r.repo, asset.GetID(), http.DefaultClient)
+	var (
+		rc  io.ReadCloser
+		err error
+	)
+	if r.cacheDir != "" && int64(asset.GetSize()) <= r.cacheMaxSize {
+		rc, err = r.openCached(asset)
+	} else {
+		rc, _, err = r.client.Repositories.DownloadReleaseAsset(r.ctx, r.owner, r.repo, asset.GetID(), http.DefaultClient)
+	}
 	if err != nil {
 		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
 	}
@@ -79,6 +126,88 @@ func (r *FS) Open(name string) (fs.File, error) {
 	}, nil
 }
 
+// cachePath returns the path of the cached copy of an asset
+func (r *FS) cachePath(asset *github.ReleaseAsset) string {
+	key := strconv.FormatInt(asset.GetID(), 10) + "-" + strconv.FormatInt(asset.GetUpdatedAt().Unix(), 10)
+	return filepath.Join(r.cacheDir, r.owner, r.repo, key)
+}
+
+// openCached opens the cached copy of an asset, downloading it first if it isn't cached yet
+func (r *FS) openCached(asset *github.ReleaseAsset) (io.ReadCloser, error) {
+	cachePath := r.cachePath(asset)
+
+	f, err := os.Open(cachePath)
+	if err == nil {
+		return f, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return nil, err
+	}
+
+	rc, _, err := r.client.Repositories.DownloadReleaseAsset(r.ctx, r.owner, r.repo, asset.GetID(), http.DefaultClient)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	// download to a temporary file first so interrupted downloads are never used
+	tmp, err := os.CreateTemp(filepath.Dir(cachePath), filepath.Base(cachePath)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, rc); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), cachePath); err != nil {
+		return nil, err
+	}
+
+	return os.Open(cachePath)
+}
+
+// Stat implements fs.StatFS, returning the asset info without downloading it
+func (r *FS) Stat(name string) (fs.FileInfo, error) {
+	name = cleanName(name)
+	if name == "." {
+		return &releaseDirInfo{}, nil
+	}
+
+	asset, ok := r.assets[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return &releaseFileInfo{asset: asset}, nil
+}
+
+// Glob implements fs.GlobFS, returning the sorted names of the assets matching the pattern
+func (r *FS) Glob(pattern string) ([]string, error) {
+	// validate the pattern even if there are no assets
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	var matches []string
+	for name := range r.assets {
+		if ok, _ := path.Match(pattern, name); ok {
+			matches = append(matches, name)
+		}
+	}
+	sort.Strings(matches)
+
+	return matches, nil
+}
+
 // releaseFile implements fs.File for a GitHub release asset
 type releaseFile struct {
 	asset      *github.ReleaseAsset
@@ -110,8 +239,7 @@ func (r *releaseFileInfo) IsDir() bool        { return false }
 func (r *releaseFileInfo) Sys() interface{}   { return r.asset }
 
 func (r *FS) ReadDir(name string) ([]fs.DirEntry, error) {
-	name = filepath.Clean(name)
-	name = strings.TrimPrefix(name, "/")
+	name = cleanName(name)
 	if name != "." {
 		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
 	}
@@ -120,14 +248,70 @@ func (r *FS) ReadDir(name string) ([]fs.DirEntry, error) {
 	for _, asset := range r.assets {
 		entries = append(entries, &releaseFileInfo{asset: asset})
 	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
 	return entries, nil
 }
 
 // releaseFileInfo implements both fs.FileInfo and fs.DirEntry
 func (r *releaseFileInfo) Type() fs.FileMode {
-	return r.Mode()
+	return r.Mode().Type()
 }
 
 func (r *releaseFileInfo) Info() (fs.FileInfo, error) {
 	return r, nil
 }
+
+// releaseDir implements fs.ReadDirFile for the root of a GitHub release
+type releaseDir struct {
+	fs      *FS
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *releaseDir) Stat() (fs.FileInfo, error) {
+	return &releaseDirInfo{}, nil
+}
+
+func (d *releaseDir) Read(_ []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: ".", Err: errors.New("is a directory")}
+}
+
+func (d *releaseDir) Close() error { return nil }
+
+func (d *releaseDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.entries == nil {
+		entries, err := d.fs.ReadDir(".")
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+	}
+
+	remaining := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(remaining) {
+		n = len(remaining)
+	}
+	d.offset += n
+
+	return remaining[:n], nil
+}
+
+// releaseDirInfo implements fs.FileInfo for the root of a GitHub release
+type releaseDirInfo struct{}
+
+func (r *releaseDirInfo) Name() string       { return "." }
+func (r *releaseDirInfo) Size() int64        { return 0 }
+func (r *releaseDirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0555 }
+func (r *releaseDirInfo) ModTime() time.Time { return time.Time{} }
+func (r *releaseDirInfo) IsDir() bool        { return true }
+func (r *releaseDirInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,129 @@
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v39/github"
+)
+
+// newTestReleaseServer serves a single release with the given assets, counting asset downloads
+func newTestReleaseServer(t *testing.T, assets map[int64][2]string, downloads *int32) *github.Client {
+	t.Helper()
+
+	updatedAt := github.Timestamp{Time: time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC)}
+	release := github.RepositoryRelease{TagName: github.String("v1.30.4+k3s1")}
+	for id, asset := range assets {
+		release.Assets = append(release.Assets, &github.ReleaseAsset{
+			ID:        github.Int64(id),
+			Name:      github.String(asset[0]),
+			Size:      github.Int(len(asset[1])),
+			UpdatedAt: &updatedAt,
+		})
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/k3s-io/k3s/releases/tags/v1.30.4+k3s1", func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewEncoder(w).Encode(release); err != nil {
+			t.Error(err)
+		}
+	})
+	mux.HandleFunc("/repos/k3s-io/k3s/releases/assets/", func(w http.ResponseWriter, r *http.Request) {
+		for id, asset := range assets {
+			if strings.HasSuffix(r.URL.Path, "/"+github.Stringify(id)) {
+				atomic.AddInt32(downloads, 1)
+				io.WriteString(w, asset[1])
+				return
+			}
+		}
+		http.NotFound(w, r)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	return client
+}
+
+func TestFS(t *testing.T) {
+	var downloads int32
+	client := newTestReleaseServer(t, map[int64][2]string{
+		1: {"k3s", "k3s binary"},
+		2: {"k3s-images.txt", "rancher/mirrored-pause:3.6\n"},
+		3: {"sha256sum-amd64.txt", "abc  k3s\n"},
+	}, &downloads)
+
+	// only assets up to the size of the binary are cached
+	fsys, err := NewCachedFS(context.Background(), client, "k3s-io", "k3s", "v1.30.4+k3s1", t.TempDir(), int64(len("k3s binary")))
+	if err != nil {
+		t.Fatalf("NewCachedFS() error = %v", err)
+	}
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if strings.Join(names, ",") != "k3s,k3s-images.txt,sha256sum-amd64.txt" {
+		t.Errorf("ReadDir() = %v, want [k3s k3s-images.txt sha256sum-amd64.txt]", names)
+	}
+
+	matches, err := fs.Glob(fsys, "sha256sum-*.txt")
+	if err != nil {
+		t.Fatalf("Glob() error = %v", err)
+	}
+	if strings.Join(matches, ",") != "sha256sum-amd64.txt" {
+		t.Errorf("Glob() = %v, want [sha256sum-amd64.txt]", matches)
+	}
+
+	info, err := fs.Stat(fsys, "k3s")
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if info.Size() != int64(len("k3s binary")) {
+		t.Errorf("Stat() size = %d, want %d", info.Size(), len("k3s binary"))
+	}
+
+	content, err := fs.ReadFile(fsys, "k3s")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if string(content) != "k3s binary" {
+		t.Errorf("ReadFile() = %q, want %q", content, "k3s binary")
+	}
+
+	if _, err := fs.ReadFile(fsys, "k3s"); err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+
+	// the second read must be served from the cache
+	if downloads := atomic.LoadInt32(&downloads); downloads != 1 {
+		t.Errorf("expected 1 download, got %d", downloads)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := fs.ReadFile(fsys, "k3s-images.txt"); err != nil {
+			t.Fatalf("ReadFile() error = %v", err)
+		}
+	}
+
+	// the images list is larger than the cache limit, so it's downloaded on every read
+	if downloads := atomic.LoadInt32(&downloads); downloads != 3 {
+		t.Errorf("expected 3 downloads, got %d", downloads)
+	}
+}
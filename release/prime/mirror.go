@@ -0,0 +1,310 @@
+package prime
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/rancher/ecm-distro-tools/release"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// checksumMetadataKey is the object metadata holding the SHA-256 checksum of mirrored artifacts
+	checksumMetadataKey = "sha256"
+	// sourceModifiedMetadataKey is the object metadata holding the modification time of the
+	// release asset an artifact was mirrored from
+	sourceModifiedMetadataKey = "source-modified"
+)
+
+// artifactsPrefixes are the key prefixes of the artifacts of each product
+var artifactsPrefixes = map[string]string{
+	"rancher": rancherArtifactsPrefix,
+	"rke2":    rke2ArtifactsPrefix,
+	"k3s":     k3sArtifactsPrefix,
+}
+
+// ArtifactInfo describes a stored artifact
+type ArtifactInfo struct {
+	Size int64
+	// Checksum is the SHA-256 checksum of the artifact, empty if unknown
+	Checksum string
+	// SourceModTime is the modification time of the release asset the artifact was mirrored from, zero if unknown
+	SourceModTime time.Time
+}
+
+// ArtifactStore stores mirrored artifacts
+type ArtifactStore interface {
+	ArtifactLister
+	// Stat returns the stored artifact, nil if it doesn't exist
+	Stat(ctx context.Context, key string) (*ArtifactInfo, error)
+	// Put stores an artifact along with its checksum and the modification time of its source
+	Put(ctx context.Context, key string, body io.ReadSeeker, info ArtifactInfo) error
+}
+
+// MirrorResult lists the keys of the artifacts copied and skipped by a mirror, on a
+// dry run the keys of the artifacts that would be copied are listed as copied
+type MirrorResult struct {
+	DryRun  bool     `json:"dryRun,omitempty"`
+	Copied  []string `json:"copied"`
+	Skipped []string `json:"skipped"`
+}
+
+// MirrorOptions configure MirrorRelease
+type MirrorOptions struct {
+	// ConcurrencyLimit is the number of assets copied at a time
+	ConcurrencyLimit int
+	// DryRun only reports the assets that would be copied, without downloading or storing them
+	DryRun bool
+}
+
+// ArtifactKey returns the key of a release asset in the artifacts store
+func ArtifactKey(product, tag, name string) (string, error) {
+	prefix, ok := artifactsPrefixes[product]
+	if !ok {
+		return "", errors.New("unsupported product: " + product)
+	}
+	if len(tag) < 2 || tag[0] != 'v' {
+		return "", errors.New("invalid tag: " + tag)
+	}
+
+	return prefix + tag[1:] + "/" + name, nil
+}
+
+// MirrorRelease copies the assets of a release into the artifacts store. Assets listed in the
+// release checksum files are verified before being stored. Assets already stored with the same
+// checksum are skipped, as well as assets without a published checksum stored with the same size
+// from a source with the same modification time, so they aren't downloaded again.
+func MirrorRelease(ctx context.Context, fsys fs.FS, product, tag string, store ArtifactStore, opts MirrorOptions) (*MirrorResult, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	published, err := release.PublishedChecksums(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	result := MirrorResult{
+		DryRun:  opts.DryRun,
+		Copied:  make([]string, 0),
+		Skipped: make([]string, 0),
+	}
+
+	concurrencyLimit := opts.ConcurrencyLimit
+	if concurrencyLimit <= 0 {
+		concurrencyLimit = 1
+	}
+
+	var mu sync.Mutex
+	errGroup, ctx := errgroup.WithContext(ctx)
+	errGroup.SetLimit(concurrencyLimit)
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		name := entry.Name()
+		key, err := ArtifactKey(product, tag, name)
+		if err != nil {
+			return nil, err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		errGroup.Go(func() error {
+			copied, err := mirrorAsset(ctx, fsys, info, key, published[name], store, opts.DryRun)
+			if err != nil {
+				return errors.New("failed to mirror " + name + ": " + err.Error())
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if copied {
+				result.Copied = append(result.Copied, key)
+			} else {
+				result.Skipped = append(result.Skipped, key)
+			}
+
+			return nil
+		})
+	}
+	if err := errGroup.Wait(); err != nil {
+		return nil, err
+	}
+
+	sort.Strings(result.Copied)
+	sort.Strings(result.Skipped)
+
+	return &result, nil
+}
+
+// mirrorAsset copies an asset into the store unless an identical copy is already stored,
+// returning whether it was copied, or would be on a dry run. Expected is the published checksum
+// of the asset, if any.
+func mirrorAsset(ctx context.Context, fsys fs.FS, info fs.FileInfo, key, expected string, store ArtifactStore, dryRun bool) (bool, error) {
+	stored, err := store.Stat(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	if stored != nil {
+		if expected != "" && stored.Checksum == expected {
+			return false, nil
+		}
+		// without a published checksum, compare what is known of the asset before downloading it
+		if expected == "" && stored.Size == info.Size() && !info.ModTime().IsZero() && stored.SourceModTime.Equal(info.ModTime()) {
+			return false, nil
+		}
+	}
+	if dryRun {
+		return true, nil
+	}
+
+	src, err := fsys.Open(info.Name())
+	if err != nil {
+		return false, err
+	}
+	defer src.Close()
+
+	// stage the asset locally so it's verified before anything is stored
+	tmp, err := os.CreateTemp("", "mirror-*")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), src)
+	if err != nil {
+		return false, err
+	}
+	checksum := hex.EncodeToString(h.Sum(nil))
+
+	if expected != "" && checksum != expected {
+		return false, errors.New("checksum mismatch, expected " + expected + ", got " + checksum)
+	}
+	if stored != nil && stored.Checksum == checksum && stored.SourceModTime.Equal(info.ModTime()) {
+		return false, nil
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	if err := store.Put(ctx, key, tmp, ArtifactInfo{Size: size, Checksum: checksum, SourceModTime: info.ModTime()}); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Stat implements ArtifactStore, reading the checksum and source modification time from the object metadata
+func (a ArtifactBucket) Stat(ctx context.Context, key string) (*ArtifactInfo, error) {
+	object, err := a.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: &a.bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		var responseErr *awshttp.ResponseError
+		if errors.As(err, &responseErr) && responseErr.HTTPStatusCode() == 404 {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	info := ArtifactInfo{
+		Size:     aws.ToInt64(object.ContentLength),
+		Checksum: object.Metadata[checksumMetadataKey],
+	}
+	if modified, ok := object.Metadata[sourceModifiedMetadataKey]; ok {
+		// an unparsable time is left unknown
+		info.SourceModTime, _ = time.Parse(time.RFC3339, modified)
+	}
+
+	return &info, nil
+}
+
+// Put implements ArtifactStore
+func (a ArtifactBucket) Put(ctx context.Context, key string, body io.ReadSeeker, info ArtifactInfo) error {
+	metadata := map[string]string{checksumMetadataKey: info.Checksum}
+	if !info.SourceModTime.IsZero() {
+		metadata[sourceModifiedMetadataKey] = info.SourceModTime.UTC().Format(time.RFC3339)
+	}
+
+	_, err := a.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        &a.bucket,
+		Key:           &key,
+		Body:          body,
+		ContentLength: aws.Int64(info.Size),
+		Metadata:      metadata,
+	})
+
+	return err
+}
+
+// Stat implements ArtifactStore, computing the checksum of the stored file. The modification
+// time of the file is set to the one of its source when it's stored.
+func (a ArtifactDir) Stat(ctx context.Context, key string) (*ArtifactInfo, error) {
+	fi, err := os.Stat(filepath.Join(a.dir, filepath.FromSlash(key)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	checksum, err := release.SHA256(os.DirFS(a.dir), key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ArtifactInfo{
+		Size:          fi.Size(),
+		Checksum:      checksum,
+		SourceModTime: fi.ModTime(),
+	}, nil
+}
+
+// Put implements ArtifactStore
+func (a ArtifactDir) Put(ctx context.Context, key string, body io.ReadSeeker, info ArtifactInfo) error {
+	dst := filepath.Join(a.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if !info.SourceModTime.IsZero() {
+		if err := os.Chtimes(tmp.Name(), info.SourceModTime, info.SourceModTime); err != nil {
+			return err
+		}
+	}
+
+	return os.Rename(tmp.Name(), dst)
+}
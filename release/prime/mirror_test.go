@@ -0,0 +1,256 @@
+package prime
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+var testUploadedAt = time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC)
+
+func testReleaseFS(k3sBinary string) fstest.MapFS {
+	return fstest.MapFS{
+		"k3s":                 {Data: []byte(k3sBinary), ModTime: testUploadedAt},
+		"k3s-images.txt":      {Data: []byte("rancher/mirrored-pause:3.6\n"), ModTime: testUploadedAt},
+		"sha256sum-amd64.txt": {Data: []byte(sha256Hex("k3s binary") + "  k3s\n"), ModTime: testUploadedAt},
+	}
+}
+
+// countingFS counts the times each file is opened
+type countingFS struct {
+	fs.FS
+	mu    sync.Mutex
+	opens map[string]int
+}
+
+func (c *countingFS) Open(name string) (fs.File, error) {
+	c.mu.Lock()
+	c.opens[name]++
+	c.mu.Unlock()
+
+	return c.FS.Open(name)
+}
+
+func TestArtifactKey(t *testing.T) {
+	tests := []struct {
+		product   string
+		tag       string
+		expected  string
+		expectErr bool
+	}{
+		{product: "k3s", tag: "v1.30.4+k3s1", expected: "k3s/v1.30.4+k3s1/k3s"},
+		{product: "rke2", tag: "v1.30.4-rc1+rke2r1", expected: "rke2/v1.30.4-rc1+rke2r1/k3s"},
+		{product: "rancher", tag: "v2.9.1", expected: "rancher/v2.9.1/k3s"},
+		{product: "dashboard", tag: "v2.9.1", expectErr: true},
+		{product: "k3s", tag: "1.30.4+k3s1", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.product+"-"+tt.tag, func(t *testing.T) {
+			key, err := ArtifactKey(tt.product, tt.tag, "k3s")
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("ArtifactKey() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if key != tt.expected {
+				t.Errorf("ArtifactKey() = %s, want %s", key, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMirrorReleaseToDir(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := NewArtifactDir(dir)
+
+	result, err := MirrorRelease(ctx, testReleaseFS("k3s binary"), "k3s", "v1.30.4+k3s1", store, MirrorOptions{ConcurrencyLimit: 2})
+	if err != nil {
+		t.Fatalf("MirrorRelease() error = %v", err)
+	}
+	if len(result.Copied) != 3 || len(result.Skipped) != 0 {
+		t.Fatalf("MirrorRelease() = %+v, want 3 copied", result)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "k3s", "v1.30.4+k3s1", "k3s"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "k3s binary" {
+		t.Errorf("mirrored content = %q", b)
+	}
+
+	// mirroring again must not copy anything, nor download the assets without a published checksum
+	fsys := &countingFS{FS: testReleaseFS("k3s binary"), opens: map[string]int{}}
+	result, err = MirrorRelease(ctx, fsys, "k3s", "v1.30.4+k3s1", store, MirrorOptions{ConcurrencyLimit: 2})
+	if err != nil {
+		t.Fatalf("MirrorRelease() error = %v", err)
+	}
+	if len(result.Copied) != 0 || len(result.Skipped) != 3 {
+		t.Errorf("MirrorRelease() = %+v, want 3 skipped", result)
+	}
+	if fsys.opens["k3s"] != 0 || fsys.opens["k3s-images.txt"] != 0 {
+		t.Errorf("MirrorRelease() downloaded stored assets: %v", fsys.opens)
+	}
+
+	// a re-uploaded asset without a published checksum is copied again
+	reuploaded := testReleaseFS("k3s binary")
+	reuploaded["k3s-images.txt"] = &fstest.MapFile{Data: []byte("rancher/mirrored-pause:3.7\n"), ModTime: testUploadedAt.Add(time.Hour)}
+	result, err = MirrorRelease(ctx, reuploaded, "k3s", "v1.30.4+k3s1", store, MirrorOptions{ConcurrencyLimit: 2})
+	if err != nil {
+		t.Fatalf("MirrorRelease() error = %v", err)
+	}
+	if expected := []string{"k3s/v1.30.4+k3s1/k3s-images.txt"}; !slices.Equal(result.Copied, expected) {
+		t.Errorf("MirrorRelease() copied %v, want %v", result.Copied, expected)
+	}
+
+	if _, err := MirrorRelease(ctx, testReleaseFS("tampered"), "k3s", "v1.30.4+k3s2", store, MirrorOptions{ConcurrencyLimit: 2}); err == nil {
+		t.Error("MirrorRelease() expected checksum mismatch error")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "k3s", "v1.30.4+k3s2", "k3s")); err == nil {
+		t.Error("MirrorRelease() stored an asset with a checksum mismatch")
+	}
+
+	if err := GenerateArtifactsIndex(ctx, dir, nil, store); err != nil {
+		t.Fatalf("GenerateArtifactsIndex() error = %v", err)
+	}
+	index, err := os.ReadFile(filepath.Join(dir, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(index), "v1.30.4&#43;k3s1") {
+		t.Error("index doesn't list the mirrored release")
+	}
+}
+
+func TestMirrorReleaseDryRun(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := NewArtifactDir(dir)
+
+	fsys := &countingFS{FS: testReleaseFS("k3s binary"), opens: map[string]int{}}
+	result, err := MirrorRelease(ctx, fsys, "k3s", "v1.30.4+k3s1", store, MirrorOptions{ConcurrencyLimit: 2, DryRun: true})
+	if err != nil {
+		t.Fatalf("MirrorRelease() error = %v", err)
+	}
+	if !result.DryRun || len(result.Copied) != 3 {
+		t.Errorf("MirrorRelease() = %+v, want 3 that would be copied", result)
+	}
+	if fsys.opens["k3s"] != 0 || fsys.opens["k3s-images.txt"] != 0 {
+		t.Errorf("MirrorRelease() downloaded assets on a dry run: %v", fsys.opens)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("MirrorRelease() stored %d entries on a dry run", len(entries))
+	}
+}
+
+// fakeS3 is a minimal S3-compatible stand-in supporting the object operations used by the mirror
+type fakeS3 struct {
+	mu       sync.Mutex
+	objects  map[string]string
+	metadata map[string]http.Header
+	puts     int
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := strings.TrimPrefix(r.URL.Path, "/"+rancherArtifactsBucket+"/")
+
+	switch r.Method {
+	case http.MethodHead:
+		if _, ok := f.objects[key]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		for name, values := range f.metadata[key] {
+			w.Header()[name] = values
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(f.objects[key])))
+	case http.MethodPut:
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		f.objects[key] = string(b)
+		f.metadata[key] = http.Header{}
+		for name, values := range r.Header {
+			if strings.HasPrefix(strings.ToLower(name), "x-amz-meta-") {
+				f.metadata[key][name] = values
+			}
+		}
+		f.puts++
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func TestMirrorReleaseToBucket(t *testing.T) {
+	fake := &fakeS3{objects: map[string]string{}, metadata: map[string]http.Header{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "test", SecretAccessKey: "test"}, nil
+		}),
+	})
+	store := NewArtifactBucket(client)
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, err := MirrorRelease(ctx, testReleaseFS("k3s binary"), "k3s", "v1.30.4+k3s1", store, MirrorOptions{ConcurrencyLimit: 1}); err != nil {
+			t.Fatalf("MirrorRelease() error = %v", err)
+		}
+	}
+
+	if fake.puts != 3 {
+		t.Errorf("expected 3 objects stored, got %d", fake.puts)
+	}
+
+	var keys []string
+	for key := range fake.objects {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	if strings.Join(keys, ",") != "k3s/v1.30.4+k3s1/k3s,k3s/v1.30.4+k3s1/k3s-images.txt,k3s/v1.30.4+k3s1/sha256sum-amd64.txt" {
+		t.Errorf("unexpected keys: %v", keys)
+	}
+	metadata := fake.metadata["k3s/v1.30.4+k3s1/k3s"]
+	if metadata.Get("x-amz-meta-"+checksumMetadataKey) != sha256Hex("k3s binary") {
+		t.Errorf("unexpected checksum metadata: %v", metadata)
+	}
+	if metadata.Get("x-amz-meta-"+sourceModifiedMetadataKey) != testUploadedAt.Format(time.RFC3339) {
+		t.Errorf("unexpected source modified metadata: %v", metadata)
+	}
+}
@@ -0,0 +1,134 @@
+package product
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// ListedImage is an image of an image list
+type ListedImage struct {
+	// Name is the image as written in the list
+	Name      string
+	Reference name.Reference
+}
+
+// ReadImageList reads the images of an image list asset, one per line. Empty lines are
+// skipped and a line that isn't an image reference fails with its file and line number.
+func ReadImageList(fsys fs.FS, filename string) ([]ListedImage, error) {
+	f, err := fsys.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var images []ListedImage
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		image := strings.TrimSpace(scanner.Text())
+		if image == "" {
+			continue
+		}
+
+		ref, err := name.ParseReference(image)
+		if err != nil {
+			return nil, errors.New(filename + ":" + strconv.Itoa(line) + ": invalid image " + image + ": " + err.Error())
+		}
+		images = append(images, ListedImage{Name: image, Reference: ref})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return images, nil
+}
+
+// Images reads the images of the image lists of the product for the platforms, or of all
+// its image lists when no platform is given, sorted and deduplicated. Optional image lists
+// missing from the release are skipped.
+func (p Product) Images(fsys fs.FS, platforms ...Architecture) ([]string, error) {
+	seen := make(map[string]bool)
+	var images []string
+	found := false
+	for _, list := range p.ImageLists {
+		if len(platforms) > 0 && !list.hasPlatform(platforms) {
+			continue
+		}
+
+		listed, err := ReadImageList(fsys, list.Filename)
+		if err != nil {
+			if list.Optional && errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		found = true
+
+		for _, image := range listed {
+			if !seen[image.Name] {
+				seen[image.Name] = true
+				images = append(images, image.Name)
+			}
+		}
+	}
+	if !found {
+		return nil, errors.New("no " + p.Name + " image lists for " + platformNames(platforms))
+	}
+	sort.Strings(images)
+
+	return images, nil
+}
+
+// Platforms returns the platforms the product publishes image lists for
+func (p Product) Platforms() []Architecture {
+	var platforms []Architecture
+	for _, list := range p.ImageLists {
+		for _, platform := range list.Platforms {
+			if !slices.Contains(platforms, platform) {
+				platforms = append(platforms, platform)
+			}
+		}
+	}
+
+	return platforms
+}
+
+// CheckPlatform fails if the product doesn't publish image lists for the platform
+func (p Product) CheckPlatform(platform Architecture) error {
+	platforms := p.Platforms()
+	if !slices.Contains(platforms, platform) {
+		return errors.New(p.Name + " doesn't publish image lists for " + string(platform) + ", only for " + platformNames(platforms))
+	}
+
+	return nil
+}
+
+// hasPlatform reports whether the list has images for any of the platforms
+func (l ImageList) hasPlatform(platforms []Architecture) bool {
+	for _, listPlatform := range l.Platforms {
+		for _, platform := range platforms {
+			if listPlatform == platform {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func platformNames(platforms []Architecture) string {
+	if len(platforms) == 0 {
+		return "any platform"
+	}
+
+	names := make([]string, len(platforms))
+	for i, platform := range platforms {
+		names[i] = string(platform)
+	}
+	return strings.Join(names, ", ")
+}
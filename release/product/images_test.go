@@ -0,0 +1,147 @@
+package product
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestReadImageList(t *testing.T) {
+	fsys := fstest.MapFS{
+		"rke2-images-all.linux-amd64.txt": {Data: []byte("rancher/rke2-runtime:v1.23.4-rke2r1\n\n  rancher/rke2-cloud-provider:v1.23.4-rke2r1\n")},
+		"invalid.txt":                     {Data: []byte("rancher/rke2-runtime:v1.23.4-rke2r1\nrancher/Invalid:v1\n")},
+	}
+
+	tests := []struct {
+		name     string
+		filename string
+		want     []string
+		wantErr  string
+	}{
+		{
+			name:     "read rke2-images-all.linux-amd64.txt",
+			filename: "rke2-images-all.linux-amd64.txt",
+			want:     []string{"rancher/rke2-runtime:v1.23.4-rke2r1", "rancher/rke2-cloud-provider:v1.23.4-rke2r1"},
+		},
+		{
+			name:     "read nonexistent file",
+			filename: "fake.txt",
+			wantErr:  "fake.txt",
+		},
+		{
+			name:     "invalid image",
+			filename: "invalid.txt",
+			wantErr:  "invalid.txt:2: invalid image rancher/Invalid:v1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadImageList(fsys, tt.filename)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ReadImageList() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadImageList() error = %v", err)
+			}
+
+			var names []string
+			for _, image := range got {
+				names = append(names, image.Name)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("ReadImageList() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestProductImages(t *testing.T) {
+	fsys := fstest.MapFS{
+		"rke2-images-all.linux-amd64.txt": {Data: []byte("docker.io/rancher/rke2-runtime:v1.30.4-rke2r1\ndocker.io/rancher/mirrored-pause:3.6\n")},
+		"rke2-images-all.linux-arm64.txt": {Data: []byte("docker.io/rancher/rke2-runtime:v1.30.4-rke2r1\n")},
+		"rke2-images.windows-amd64.txt":   {Data: []byte("docker.io/rancher/mirrored-pause:3.6\n\n")},
+		"rancher-images.txt":              {Data: []byte("rancher/rancher:v2.9.1\nrancher/mirrored-pause:3.6\n")},
+	}
+
+	tests := []struct {
+		name      string
+		product   Product
+		platforms []Architecture
+		expected  []string
+		expectErr bool
+	}{
+		{
+			name:     "all image lists",
+			product:  RKE2,
+			expected: []string{"docker.io/rancher/mirrored-pause:3.6", "docker.io/rancher/rke2-runtime:v1.30.4-rke2r1"},
+		},
+		{
+			name:      "one platform",
+			product:   RKE2,
+			platforms: []Architecture{LinuxArm64},
+			expected:  []string{"docker.io/rancher/rke2-runtime:v1.30.4-rke2r1"},
+		},
+		{
+			name:      "optional list missing",
+			product:   Rancher,
+			platforms: []Architecture{LinuxAmd64},
+			expected:  []string{"rancher/mirrored-pause:3.6", "rancher/rancher:v2.9.1"},
+		},
+		{
+			name:      "no list for the platform",
+			product:   Rancher,
+			platforms: []Architecture{WindowsAmd64},
+			expectErr: true,
+		},
+		{
+			name:      "required list missing",
+			product:   K3s,
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			images, err := tt.product.Images(fsys, tt.platforms...)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("Images() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if !reflect.DeepEqual(images, tt.expected) {
+				t.Errorf("Images() = %v, want %v", images, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCheckPlatform(t *testing.T) {
+	tests := []struct {
+		product  Product
+		platform Architecture
+		wantErr  string
+	}{
+		{product: K3s, platform: LinuxArm64},
+		{product: RKE2, platform: WindowsAmd64},
+		{product: K3s, platform: "linux/s390x", wantErr: "k3s doesn't publish image lists for linux/s390x, only for linux/amd64, linux/arm64"},
+		{product: K3s, platform: WindowsAmd64, wantErr: "k3s doesn't publish image lists for windows/amd64, only for linux/amd64, linux/arm64"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.product.Name+" "+string(tt.platform), func(t *testing.T) {
+			err := tt.product.CheckPlatform(tt.platform)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("CheckPlatform() error = %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("CheckPlatform() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+// Package product defines the products whose releases publish image lists, and
+// the image lists published with their releases.
+package product
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// Architecture is a platform an image list has images for
+type Architecture string
+
+const (
+	LinuxAmd64   Architecture = "linux/amd64"
+	LinuxArm64   Architecture = "linux/arm64"
+	WindowsAmd64 Architecture = "windows/amd64"
+)
+
+// ImageList is a release asset listing the images expected for a set of platforms
+type ImageList struct {
+	Filename  string
+	Platforms []Architecture
+	// Optional lists aren't published with every release
+	Optional bool
+}
+
+// Product defines the image lists published with the releases of a product
+type Product struct {
+	Name string
+	// VersionSuffix is the build metadata identifying the product versions, empty if there's none
+	VersionSuffix string
+	// MajorVersion is the major version of the product releases, checked when there's no suffix
+	MajorVersion string
+	ImageLists   []ImageList
+}
+
+var (
+	RKE2 = Product{
+		Name:          "rke2",
+		VersionSuffix: "+rke2",
+		ImageLists: []ImageList{
+			{Filename: "rke2-images-all.linux-amd64.txt", Platforms: []Architecture{LinuxAmd64}},
+			{Filename: "rke2-images-all.linux-arm64.txt", Platforms: []Architecture{LinuxArm64}},
+			{Filename: "rke2-images.windows-amd64.txt", Platforms: []Architecture{WindowsAmd64}},
+		},
+	}
+	K3s = Product{
+		Name:          "k3s",
+		VersionSuffix: "+k3s",
+		ImageLists: []ImageList{
+			{Filename: "k3s-images.txt", Platforms: []Architecture{LinuxAmd64, LinuxArm64}},
+		},
+	}
+	Rancher = Product{
+		Name:         "rancher",
+		MajorVersion: "v2",
+		ImageLists: []ImageList{
+			{Filename: "rancher-images.txt", Platforms: []Architecture{LinuxAmd64, LinuxArm64}},
+			{Filename: "rancher-windows-images.txt", Platforms: []Architecture{WindowsAmd64}, Optional: true},
+		},
+	}
+
+	// Products are the products whose releases can be inspected, by name
+	Products = map[string]Product{
+		RKE2.Name:    RKE2,
+		K3s.Name:     K3s,
+		Rancher.Name: Rancher,
+	}
+)
+
+// Matches reports whether a version is a release version of the product
+func (p Product) Matches(version string) bool {
+	if p.VersionSuffix != "" {
+		return strings.Contains(version, p.VersionSuffix)
+	}
+
+	return !strings.Contains(version, "+") && semver.Major(version) == p.MajorVersion
+}
+
+// ForVersion returns the product a release version belongs to
+func ForVersion(version string) (Product, error) {
+	for _, product := range []Product{RKE2, K3s, Rancher} {
+		if product.Matches(version) {
+			return product, nil
+		}
+	}
+
+	return Product{}, errors.New("unsupported release version: " + version)
+}
@@ -0,0 +1,31 @@
+package product
+
+import "testing"
+
+func TestForVersion(t *testing.T) {
+	tests := []struct {
+		version   string
+		expected  string
+		expectErr bool
+	}{
+		{version: "v1.30.4+rke2r1", expected: "rke2"},
+		{version: "v1.30.4-rc1+rke2r1", expected: "rke2"},
+		{version: "v1.30.4+k3s1", expected: "k3s"},
+		{version: "v2.9.1", expected: "rancher"},
+		{version: "v2.9.1-rc2", expected: "rancher"},
+		{version: "v1.30.4", expectErr: true},
+		{version: "invalid", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			p, err := ForVersion(tt.version)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("ForVersion() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if p.Name != tt.expected {
+				t.Errorf("ForVersion() = %s, want %s", p.Name, tt.expected)
+			}
+		})
+	}
+}
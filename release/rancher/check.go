@@ -0,0 +1,295 @@
+package rancher
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"strconv"
+
+	"github.com/google/go-github/v39/github"
+	reg "github.com/rancher/ecm-distro-tools/registry"
+	"github.com/rancher/ecm-distro-tools/release"
+	"github.com/rancher/ecm-distro-tools/release/product"
+	"github.com/rancher/ecm-distro-tools/release/rcdeps"
+	"golang.org/x/mod/semver"
+)
+
+const (
+	dashboardReferencesPRTitle = "Bump Dashboard to "
+	cliReferencesPRTitle       = "Bump Rancher CLI version to "
+
+	rancherImagesFile = "rancher-images.txt"
+)
+
+// ReadinessCheck is the result of a check run before tagging a Rancher GA
+type ReadinessCheck struct {
+	Name    string   `json:"name"`
+	Passed  bool     `json:"passed"`
+	Summary string   `json:"summary"`
+	Details []string `json:"details,omitempty"`
+}
+
+// ReadinessReport aggregates the checks run before tagging a Rancher GA
+type ReadinessReport struct {
+	Version       string           `json:"version"`
+	ReleaseBranch string           `json:"releaseBranch"`
+	Checks        []ReadinessCheck `json:"checks"`
+}
+
+// Passed reports whether every check passed
+func (r *ReadinessReport) Passed() bool {
+	for _, check := range r.Checks {
+		if !check.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadinessOptions configure CheckReleaseReadiness
+type ReadinessOptions struct {
+	Owner         string
+	Repo          string
+	ReleaseBranch string
+	// ImagesTag is the release whose images list is checked, the latest rc of the version when empty
+	ImagesTag string
+	// Assets are the release assets with the images list, downloaded from the ImagesTag release when nil
+	Assets        fs.FS
+	PrimeRegistry string
+	// DashboardVersion and CLIVersion are the versions the Dashboard and CLI references PRs bump to
+	DashboardVersion string
+	CLIVersion       string
+	ConcurrencyLimit int
+	RegistryOptions  []reg.Option
+}
+
+// CheckReleaseReadiness runs the checks done before tagging a Rancher GA: the release branch has
+// no rc or dev dependencies, the release images are in the Prime registry, the Dashboard and CLI
+// references PRs are merged and the KDM and charts branches aren't dev branches.
+// Checks that can't be run are reported as failed instead of returning an error.
+func CheckReleaseReadiness(ctx context.Context, ghClient *github.Client, version string, opts ReadinessOptions) (*ReadinessReport, error) {
+	if !semver.IsValid(version) {
+		return nil, errors.New("the version isn't a valid semver: " + version)
+	}
+
+	report := ReadinessReport{
+		Version:       version,
+		ReleaseBranch: opts.ReleaseBranch,
+	}
+
+	deps, err := CheckRancherRCDeps(ctx, ghClient, opts.Owner, opts.Repo, opts.ReleaseBranch, nil)
+	if err != nil {
+		report.Checks = append(report.Checks,
+			failedCheck("rc-deps", err),
+			failedCheck("kdm-charts-branches", err),
+		)
+	} else {
+		report.Checks = append(report.Checks, rcDepsCheck(deps), devBranchesCheck(deps))
+	}
+
+	report.Checks = append(report.Checks, primeImagesCheck(ctx, ghClient, version, opts))
+
+	dashboardTitle := dashboardReferencesPRTitle + "`" + opts.DashboardVersion + "`"
+	cliTitle := cliReferencesPRTitle + opts.CLIVersion
+
+	pulls, err := latestPullRequests(ctx, ghClient, opts.Owner, opts.Repo, opts.ReleaseBranch, dashboardTitle, cliTitle)
+	if err != nil {
+		report.Checks = append(report.Checks,
+			failedCheck("dashboard-references", err),
+			failedCheck("cli-references", err),
+		)
+	} else {
+		report.Checks = append(report.Checks,
+			pullRequestCheck("dashboard-references", "dashboard", opts.DashboardVersion, dashboardTitle, pulls[dashboardTitle]),
+			pullRequestCheck("cli-references", "CLI", opts.CLIVersion, cliTitle, pulls[cliTitle]),
+		)
+	}
+
+	return &report, nil
+}
+
+func failedCheck(name string, err error) ReadinessCheck {
+	return ReadinessCheck{Name: name, Summary: "failed to run the check: " + err.Error()}
+}
+
+// rcDepsCheck passes when the release branch has no blocking rc dependencies, the dev
+// branch categories are left to devBranchesCheck
+func rcDepsCheck(deps *rcdeps.Report) ReadinessCheck {
+	check := ReadinessCheck{Name: "rc-deps"}
+
+	for _, category := range deps.Categories {
+		if !category.Blocking || category.DevBranch {
+			continue
+		}
+		for _, line := range category.Lines {
+			check.Details = append(check.Details, category.Title+": "+line.Content+" ("+line.File+", line "+strconv.Itoa(line.Line)+")")
+		}
+	}
+
+	check.Passed = len(check.Details) == 0
+	check.Summary = strconv.Itoa(len(check.Details)) + " blocking rc dependencies in " + deps.Source
+
+	return check
+}
+
+// devBranchesCheck passes when the KDM and charts branches aren't dev-v* branches, as
+// reported by the dev branch categories of the rules
+func devBranchesCheck(deps *rcdeps.Report) ReadinessCheck {
+	const name = "kdm-charts-branches"
+	check := ReadinessCheck{Name: name}
+
+	found := false
+	for _, category := range deps.Categories {
+		if !category.DevBranch {
+			continue
+		}
+		found = true
+		for _, line := range category.Lines {
+			check.Details = append(check.Details, line.Content+" ("+line.File+", line "+strconv.Itoa(line.Line)+")")
+		}
+	}
+	if !found {
+		return failedCheck(name, errors.New("no dev branch categories in the rc-deps rules"))
+	}
+
+	check.Passed = len(check.Details) == 0
+	check.Summary = strconv.Itoa(len(check.Details)) + " KDM and charts references to dev branches"
+
+	return check
+}
+
+// primeImagesCheck passes when all images of the release images list are in the Prime registry
+func primeImagesCheck(ctx context.Context, ghClient *github.Client, version string, opts ReadinessOptions) ReadinessCheck {
+	const name = "prime-images"
+
+	if opts.PrimeRegistry == "" {
+		return failedCheck(name, errors.New("no prime registry"))
+	}
+
+	assets := opts.Assets
+	imagesTag := opts.ImagesTag
+	if assets == nil {
+		if imagesTag == "" {
+			imagesTag = version
+			if semver.Prerelease(version) == "" {
+				latest, err := release.LatestPreRelease(ctx, ghClient, opts.Owner, opts.Repo, version, "rc")
+				if err != nil {
+					return failedCheck(name, err)
+				}
+				if latest == nil {
+					return failedCheck(name, errors.New("no rc found for "+version))
+				}
+				imagesTag = *latest
+			}
+		}
+
+		releaseFS, err := release.NewFS(ctx, ghClient, opts.Owner, opts.Repo, imagesTag)
+		if err != nil {
+			return failedCheck(name, err)
+		}
+		assets = releaseFS
+	}
+
+	images, err := readImagesList(assets)
+	if err != nil {
+		return failedCheck(name, err)
+	}
+
+	concurrencyLimit := opts.ConcurrencyLimit
+	if concurrencyLimit <= 0 {
+		concurrencyLimit = 1
+	}
+	missing, err := MissingImagesFromRegistry("", "", opts.PrimeRegistry, concurrencyLimit, images, nil, opts.RegistryOptions...)
+	if err != nil {
+		return failedCheck(name, err)
+	}
+
+	source := rancherImagesFile
+	if imagesTag != "" {
+		source += " of " + imagesTag
+	}
+
+	return ReadinessCheck{
+		Name:    name,
+		Passed:  len(missing) == 0,
+		Summary: strconv.Itoa(len(missing)) + " of " + strconv.Itoa(len(images)) + " images in " + source + " missing from " + opts.PrimeRegistry,
+		Details: missing,
+	}
+}
+
+// readImagesList reads the images of the rancher images list asset
+func readImagesList(assets fs.FS) ([]string, error) {
+	listed, err := product.ReadImageList(assets, rancherImagesFile)
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]string, len(listed))
+	for i, image := range listed {
+		images[i] = image.Name
+	}
+
+	return images, nil
+}
+
+// latestPullRequests returns the newest pull request against the base branch with each of
+// the titles, paging through the pull requests until all of them are found
+func latestPullRequests(ctx context.Context, ghClient *github.Client, owner, repo, base string, titles ...string) (map[string]*github.PullRequest, error) {
+	found := make(map[string]*github.PullRequest, len(titles))
+
+	opts := &github.PullRequestListOptions{
+		State:       "all",
+		Base:        base,
+		Sort:        "created",
+		Direction:   "desc",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		pulls, resp, err := ghClient.PullRequests.List(ctx, owner, repo, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, pull := range pulls {
+			for _, title := range titles {
+				if _, ok := found[title]; !ok && pull.GetTitle() == title {
+					found[title] = pull
+				}
+			}
+		}
+
+		if len(found) == len(titles) || resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return found, nil
+}
+
+// pullRequestCheck passes when the pull request with the expected title is merged,
+// pull is nil when no pull request was found
+func pullRequestCheck(name, component, version, title string, pull *github.PullRequest) ReadinessCheck {
+	if version == "" {
+		return failedCheck(name, errors.New("no "+component+" version configured"))
+	}
+	if pull == nil {
+		return ReadinessCheck{Name: name, Summary: "no pull request found with the title " + title}
+	}
+
+	check := ReadinessCheck{
+		Name:    name,
+		Passed:  pull.MergedAt != nil,
+		Details: []string{pull.GetHTMLURL()},
+	}
+	switch {
+	case check.Passed:
+		check.Summary = pull.GetTitle() + " is merged"
+	case pull.GetState() == "open":
+		check.Summary = pull.GetTitle() + " is still open"
+	default:
+		check.Summary = pull.GetTitle() + " was closed without merging"
+	}
+
+	return check
+}
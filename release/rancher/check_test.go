@@ -0,0 +1,222 @@
+package rancher
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-github/v39/github"
+	"github.com/rancher/ecm-distro-tools/release/rcdeps"
+)
+
+func TestPullRequestCheck(t *testing.T) {
+	merged := &github.PullRequest{
+		Title:    github.String("Bump Dashboard to `v2.9.2`"),
+		State:    github.String("closed"),
+		MergedAt: &time.Time{},
+		HTMLURL:  github.String("https://github.com/rancher/rancher/pull/1"),
+	}
+	open := &github.PullRequest{
+		Title:   github.String("Bump Dashboard to `v2.9.3`"),
+		State:   github.String("open"),
+		HTMLURL: github.String("https://github.com/rancher/rancher/pull/2"),
+	}
+
+	tests := []struct {
+		name    string
+		version string
+		pull    *github.PullRequest
+		passed  bool
+		summary string
+	}{
+		{
+			name:    "merged",
+			version: "v2.9.2",
+			pull:    merged,
+			passed:  true,
+			summary: "Bump Dashboard to `v2.9.2` is merged",
+		},
+		{
+			name:    "open",
+			version: "v2.9.3",
+			pull:    open,
+			summary: "Bump Dashboard to `v2.9.3` is still open",
+		},
+		{
+			name:    "not found",
+			version: "v2.9.4",
+			summary: "no pull request found with the title Bump Dashboard to `v2.9.4`",
+		},
+		{
+			name:    "no version",
+			summary: "failed to run the check: no dashboard version configured",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := pullRequestCheck("dashboard-references", "dashboard", tt.version, dashboardReferencesPRTitle+"`"+tt.version+"`", tt.pull)
+			if check.Passed != tt.passed || check.Summary != tt.summary {
+				t.Errorf("pullRequestCheck() = %+v, want passed %v and summary %q", check, tt.passed, tt.summary)
+			}
+		})
+	}
+}
+
+func TestLatestPullRequests(t *testing.T) {
+	// newest first, the pull request of a previous patch shares the title prefix
+	pulls := []*github.PullRequest{
+		{Number: github.Int(5), Title: github.String("Bump Dashboard to `v2.9.30`")},
+		{Number: github.Int(4), Title: github.String("Bump Dashboard to `v2.9.3`")},
+		{Number: github.Int(3), Title: github.String("Bump Rancher CLI version to v2.9.30")},
+		{Number: github.Int(2), Title: github.String("Bump Rancher CLI version to v2.9.3")},
+		{Number: github.Int(1), Title: github.String("Bump Dashboard to `v2.9.3`")},
+	}
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Query().Get("base") != "release/v2.9" {
+			t.Errorf("pull requests listed for base %q", r.URL.Query().Get("base"))
+		}
+
+		// two pull requests per page
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+		start := (page - 1) * 2
+		end := start + 2
+		if end < len(pulls) {
+			w.Header().Set("Link", `<`+r.URL.Path+`?page=`+strconv.Itoa(page+1)+`>; rel="next"`)
+		} else {
+			end = len(pulls)
+		}
+		if err := json.NewEncoder(w).Encode(pulls[start:end]); err != nil {
+			t.Error(err)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	dashboardTitle := "Bump Dashboard to `v2.9.3`"
+	cliTitle := "Bump Rancher CLI version to v2.9.3"
+	found, err := latestPullRequests(context.Background(), client, "rancher", "rancher", "release/v2.9", dashboardTitle, cliTitle)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := found[dashboardTitle].GetNumber(); got != 4 {
+		t.Errorf("dashboard pull request = #%d, want #4", got)
+	}
+	if got := found[cliTitle].GetNumber(); got != 2 {
+		t.Errorf("CLI pull request = #%d, want #2", got)
+	}
+	if requests != 2 {
+		t.Errorf("listed %d pages, want 2", requests)
+	}
+}
+
+func TestRCDepsChecks(t *testing.T) {
+	rules, err := rcdeps.Rancher.Rules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"Dockerfile.dapper":       "",
+		"go.mod":                  "require github.com/rancher/rke v1.6.2-rc3\n",
+		"package/Dockerfile":      "ENV CATTLE_KDM_BRANCH=dev-v2.9\n",
+		"pkg/apis/go.mod":         "",
+		"pkg/settings/setting.go": "",
+		"scripts/package-env":     "",
+	}
+	deps, err := rules.Scan("release/v2.9", func(file string) (string, error) {
+		return files[file], nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := rcDepsCheck(deps)
+	expected := []string{
+		"Components with -rc: require github.com/rancher/rke v1.6.2-rc3 (go.mod, line 1)",
+	}
+	if check.Passed || !reflect.DeepEqual(check.Details, expected) {
+		t.Errorf("rcDepsCheck() = %+v, want details %v", check, expected)
+	}
+
+	check = devBranchesCheck(deps)
+	expected = []string{"ENV CATTLE_KDM_BRANCH=dev-v2.9 (package/Dockerfile, line 1)"}
+	if check.Passed || !reflect.DeepEqual(check.Details, expected) {
+		t.Errorf("devBranchesCheck() = %+v, want details %v", check, expected)
+	}
+
+	// renamed categories are still checked, rules without dev branch categories fail the check
+	for i := range deps.Categories {
+		deps.Categories[i].Name += "Renamed"
+	}
+	if check := devBranchesCheck(deps); check.Passed || len(check.Details) != 1 {
+		t.Errorf("devBranchesCheck() with renamed categories = %+v, want the KDM line", check)
+	}
+	for i := range deps.Categories {
+		deps.Categories[i].DevBranch = false
+	}
+	if check := devBranchesCheck(deps); check.Passed {
+		t.Errorf("devBranchesCheck() without dev branch categories = %+v, want a failed check", check)
+	}
+}
+
+func TestPrimeImagesCheck(t *testing.T) {
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(server.Close)
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	img, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(host + "/rancher/rancher:v2.9.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := ReadinessOptions{
+		PrimeRegistry:    host,
+		ConcurrencyLimit: 2,
+		Assets: fstest.MapFS{
+			rancherImagesFile: &fstest.MapFile{Data: []byte("rancher/rancher:v2.9.3\nrancher/shell:v0.2.2\n")},
+		},
+	}
+
+	check := primeImagesCheck(context.Background(), nil, "v2.9.3", opts)
+	if check.Passed || !reflect.DeepEqual(check.Details, []string{"rancher/shell:v0.2.2"}) {
+		t.Errorf("primeImagesCheck() = %+v, want rancher/shell:v0.2.2 missing", check)
+	}
+	if expected := "1 of 2 images in rancher-images.txt missing from " + host; check.Summary != expected {
+		t.Errorf("primeImagesCheck() summary = %q, want %q", check.Summary, expected)
+	}
+
+	opts.PrimeRegistry = ""
+	if check := primeImagesCheck(context.Background(), nil, "v2.9.3", opts); check.Passed {
+		t.Error("primeImagesCheck() passed without a prime registry")
+	}
+}
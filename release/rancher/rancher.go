@@ -2,9 +2,7 @@ package rancher
 
 import (
 	"bufio"
-	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -16,15 +14,18 @@ import (
 	"strconv"
 	"strings"
 	"sync"
-	"text/template"
 	"time"
 
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	gitHTTP "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-github/v39/github"
 	ecmConfig "github.com/rancher/ecm-distro-tools/cmd/release/config"
-	ecmExec "github.com/rancher/ecm-distro-tools/exec"
 	ecmHTTP "github.com/rancher/ecm-distro-tools/http"
+	reg "github.com/rancher/ecm-distro-tools/registry"
 	"github.com/rancher/ecm-distro-tools/release"
 	"github.com/rancher/ecm-distro-tools/release/cli"
+	"github.com/rancher/ecm-distro-tools/release/rcdeps"
 	"github.com/rancher/ecm-distro-tools/repository"
 	"golang.org/x/mod/semver"
 	"golang.org/x/sync/errgroup"
@@ -34,15 +35,9 @@ import (
 const (
 	rancherOrg                    = "rancher"
 	rancherRepo                   = rancherOrg
-	rancherRegistryBaseURL        = "https://registry.rancher.com"
-	stagingRancherRegistryBaseURL = "https://stgregistry.suse.com"
-	sccSUSEURL                    = "https://scc.suse.com/api/registry/authorize"
-	stagingSccSUSEURL             = "https://stgscc.suse.com/api/registry/authorize"
-	dockerRegistryURL             = "https://registry-1.docker.io"
-	dockerAuthURL                 = "https://auth.docker.io/token"
-	sccSUSEService                = "SUSE+Linux+Docker+Registry"
-	dockerService                 = "registry.docker.io"
 	dashboardUpdateRefsBranchBase = "update-dashboard-refs"
+	rancherDockerfile             = "package/Dockerfile"
+	rancherPackageEnv             = "scripts/package-env"
 )
 
 type ReleaseType int
@@ -65,57 +60,44 @@ var regsyncDefaultMediaTypes = []string{
 	"application/vnd.oci.image.index.v1+json",
 }
 
+// registriesInfo are the environment variables regsync reads the credentials of well known
+// registries from. Other registries use variables named after the registry host, see registryEnv.
 var registriesInfo = map[string]registryInfo{
 	"registry.rancher.com": {
-		BaseURL:     rancherRegistryBaseURL,
-		AuthURL:     sccSUSEURL,
-		Service:     sccSUSEService,
 		UserEnv:     `{{env "PRIME_REGISTRY_USERNAME"}}`,
 		PasswordEnv: `{{env "PRIME_REGISTRY_PASSWORD"}}`,
 	},
 	"stgregistry.suse.com": {
-		BaseURL:     stagingRancherRegistryBaseURL,
-		AuthURL:     stagingSccSUSEURL,
-		Service:     sccSUSEService,
 		UserEnv:     `{{env "STAGING_REGISTRY_USERNAME"}}`,
 		PasswordEnv: `{{env "STAGING_REGISTRY_PASSWORD"}}`,
 	},
 	"docker.io": {
-		BaseURL:     dockerRegistryURL,
-		AuthURL:     dockerAuthURL,
-		Service:     dockerService,
 		UserEnv:     `{{env "DOCKERIO_REGISTRY_USERNAME"}}`,
 		PasswordEnv: `{{env "DOCKERIO_REGISTRY_PASSWORD"}}`,
 	},
 }
 
 type registryInfo struct {
-	BaseURL     string
-	AuthURL     string
-	Service     string
 	UserEnv     string
 	PasswordEnv string
 }
 
-type imageDigest map[string]string
+// registryEnv returns the regsync credentials environment variables of a registry,
+// e.g. localhost:5000 reads LOCALHOST_5000_REGISTRY_USERNAME and LOCALHOST_5000_REGISTRY_PASSWORD
+func registryEnv(registry string) registryInfo {
+	if info, ok := registriesInfo[registry]; ok {
+		return info
+	}
 
-type RancherRCDepsLine struct {
-	Line    int    `json:"line"`
-	File    string `json:"file"`
-	Content string `json:"content"`
-}
+	prefix := strings.ToUpper(regexp.MustCompile(`[^A-Za-z0-9]+`).ReplaceAllString(registry, "_"))
 
-type RancherRCDeps struct {
-	RancherImages  []RancherRCDepsLine `json:"rancherImages"`
-	FilesWithRC    []RancherRCDepsLine `json:"filesWithRc"`
-	MinFilesWithRC []RancherRCDepsLine `json:"minFilesWithRc"`
-	ChartsWithDev  []RancherRCDepsLine `json:"chartsWithDev"`
-	KDMWithDev     []RancherRCDepsLine `json:"kdmWithDev"`
+	return registryInfo{
+		UserEnv:     `{{env "` + prefix + `_REGISTRY_USERNAME"}}`,
+		PasswordEnv: `{{env "` + prefix + `_REGISTRY_PASSWORD"}}`,
+	}
 }
 
-type registryAuthToken struct {
-	Token string `json:"token"`
-}
+type imageDigest map[string]string
 
 type regsyncConfig struct {
 	Version  int             `json:"version"`
@@ -137,6 +119,7 @@ type regsyncDefaults struct {
 
 type regsyncTags struct {
 	Allow []string `json:"allow"`
+	Deny  []string `json:"deny,omitempty"`
 }
 
 type regsyncSync struct {
@@ -146,8 +129,9 @@ type regsyncSync struct {
 	Tags   regsyncTags `json:"tags"`
 }
 
-func UpdateDashboardReferences(ctx context.Context, ghClient *github.Client, r *ecmConfig.DashboardRelease, u *ecmConfig.User, tag, rancherReleaseBranch, rancherRepoName, rancherRepoOwner, rancherRepoURL string, dryRun bool) error {
-	if err := updateDashboardReferencesAndPush(tag, rancherReleaseBranch, rancherRepoURL, dryRun); err != nil {
+func UpdateDashboardReferences(ctx context.Context, ghClient *github.Client, r *ecmConfig.DashboardRelease, u *ecmConfig.User, tag, rancherReleaseBranch, rancherRepoName, rancherRepoOwner, rancherRepoURL, githubToken string, dryRun bool) error {
+	auth := &gitHTTP.BasicAuth{Username: u.GithubUsername, Password: githubToken}
+	if err := updateDashboardReferencesAndPush(tag, rancherReleaseBranch, rancherRepoURL, auth, dryRun); err != nil {
 		return err
 	}
 
@@ -162,25 +146,38 @@ func UpdateDashboardRefsBranchName(tag string) string {
 	return dashboardUpdateRefsBranchBase + "-" + tag
 }
 
-func updateDashboardReferencesAndPush(tag, rancherReleaseBranch, rancherUpstreamURL string, dryRun bool) error {
-	updateScriptVars := map[string]string{
-		"Tag":                  tag,
-		"RancherReleaseBranch": rancherReleaseBranch,
-		"RancherUpstreamURL":   rancherUpstreamURL,
-		"DryRun":               strconv.FormatBool(dryRun),
-		"BranchBaseName":       UpdateDashboardRefsBranchName(tag),
-	}
-	updateScriptOut, err := ecmExec.RunTemplatedScript("./", "update_dashboard_refs.sh", updateDashboardReferencesScript, nil, updateScriptVars)
+func updateDashboardReferencesAndPush(tag, rancherReleaseBranch, rancherUpstreamURL string, auth transport.AuthMethod, dryRun bool) error {
+	diff, err := repository.UpdateBranch(&repository.UpdateBranchOpts{
+		Dir:            "./",
+		UpstreamURL:    rancherUpstreamURL,
+		UpstreamBranch: rancherReleaseBranch,
+		Branch:         UpdateDashboardRefsBranchName(tag),
+		CommitMessage:  "Update Dashboard refs to " + tag,
+		Edits:          dashboardReferencesEdits(tag),
+		Auth:           auth,
+		DryRun:         dryRun,
+	})
 	if err != nil {
 		return err
 	}
-	fmt.Println(updateScriptOut)
+	fmt.Println(diff)
 	return nil
 }
 
+// dashboardReferencesEdits set the dashboard versions of the rancher image,
+// CATTLE_UI_VERSION doesn't have the leading v of the tag
+func dashboardReferencesEdits(tag string) []repository.FileEdit {
+	return []repository.FileEdit{
+		{Path: rancherDockerfile, Edit: repository.SetDockerfileEnv("CATTLE_UI_VERSION", strings.TrimPrefix(tag, "v"))},
+		{Path: rancherDockerfile, Edit: repository.SetDockerfileEnv("CATTLE_DASHBOARD_UI_VERSION", tag)},
+		{Path: rancherPackageEnv, Optional: true, Edit: repository.SetEnvFileVar("CATTLE_UI_VERSION", strings.TrimPrefix(tag, "v"))},
+		{Path: rancherPackageEnv, Optional: true, Edit: repository.SetEnvFileVar("CATTLE_DASHBOARD_UI_VERSION", tag)},
+	}
+}
+
 func createDashboardReferencesPR(ctx context.Context, ghClient *github.Client, u *ecmConfig.User, tag, rancherReleaseBranch, rancherRepoName, rancherRepoOwner string) error {
 	pull := &github.NewPullRequest{
-		Title:               github.String(fmt.Sprintf("Bump Dashboard to `%s`", tag)),
+		Title:               github.String(dashboardReferencesPRTitle + "`" + tag + "`"),
 		Base:                github.String(rancherReleaseBranch),
 		Head:                github.String(u.GithubUsername + ":" + UpdateDashboardRefsBranchName(tag)),
 		MaintainerCanModify: github.Bool(true),
@@ -197,8 +194,9 @@ func createDashboardReferencesPR(ctx context.Context, ghClient *github.Client, u
 	return nil
 }
 
-func UpdateCLIReferences(ctx context.Context, ghClient *github.Client, tag, rancherReleaseBranch, githubUsername, rancherRepoName, rancherRepoOwner, rancherUpstreamURL string, dryRun bool) error {
-	if err := updateCLIReferencesAndPush(tag, rancherUpstreamURL, rancherReleaseBranch, dryRun); err != nil {
+func UpdateCLIReferences(ctx context.Context, ghClient *github.Client, tag, rancherReleaseBranch, githubUsername, rancherRepoName, rancherRepoOwner, rancherUpstreamURL, githubToken string, dryRun bool) error {
+	auth := &gitHTTP.BasicAuth{Username: githubUsername, Password: githubToken}
+	if err := updateCLIReferencesAndPush(tag, rancherUpstreamURL, rancherReleaseBranch, auth, dryRun); err != nil {
 		return err
 	}
 
@@ -209,25 +207,35 @@ func UpdateCLIReferences(ctx context.Context, ghClient *github.Client, tag, ranc
 	return createCLIReferencesPR(ctx, ghClient, tag, rancherReleaseBranch, githubUsername, rancherRepoName, rancherRepoOwner)
 }
 
-func updateCLIReferencesAndPush(tag, rancherUpstreamURL, rancherReleaseBranch string, dryRun bool) error {
-	updateScriptVars := map[string]string{
-		"DryRun":               strconv.FormatBool(dryRun),
-		"BranchName":           cli.UpdateCLIRefsBranchName(tag),
-		"Tag":                  tag,
-		"RancherUpstreamURL":   rancherUpstreamURL,
-		"RancherReleaseBranch": rancherReleaseBranch,
-	}
-	updateScriptOut, err := ecmExec.RunTemplatedScript("./", "replace_cli_ref.sh", updateCLIReferencesScript, nil, updateScriptVars)
+func updateCLIReferencesAndPush(tag, rancherUpstreamURL, rancherReleaseBranch string, auth transport.AuthMethod, dryRun bool) error {
+	diff, err := repository.UpdateBranch(&repository.UpdateBranchOpts{
+		Dir:            "./",
+		UpstreamURL:    rancherUpstreamURL,
+		UpstreamBranch: rancherReleaseBranch,
+		Branch:         cli.UpdateCLIRefsBranchName(tag),
+		CommitMessage:  "Update CLI refs to " + tag,
+		Edits:          cliReferencesEdits(tag),
+		Auth:           auth,
+		DryRun:         dryRun,
+	})
 	if err != nil {
 		return err
 	}
-	fmt.Println(updateScriptOut)
+	fmt.Println(diff)
 	return nil
 }
 
+// cliReferencesEdits set the CLI version of the rancher image
+func cliReferencesEdits(tag string) []repository.FileEdit {
+	return []repository.FileEdit{
+		{Path: rancherDockerfile, Edit: repository.SetDockerfileEnv("CATTLE_CLI_VERSION", tag)},
+		{Path: rancherPackageEnv, Optional: true, Edit: repository.SetEnvFileVar("CATTLE_CLI_VERSION", tag)},
+	}
+}
+
 func createCLIReferencesPR(ctx context.Context, ghClient *github.Client, tag, rancherReleaseBranch, githubUsername, rancherRepoName, rancherRepoOwner string) error {
 	pull := &github.NewPullRequest{
-		Title:               github.String("Bump Rancher CLI version to " + tag),
+		Title:               github.String(cliReferencesPRTitle + tag),
 		Base:                github.String(rancherReleaseBranch),
 		Head:                github.String(githubUsername + ":" + cli.UpdateCLIRefsBranchName(tag)),
 		MaintainerCanModify: github.Bool(true),
@@ -297,105 +305,41 @@ func CreateRelease(ctx context.Context, ghClient *github.Client, r *ecmConfig.Ra
 	return createdRelease.GetHTMLURL(), err
 }
 
-func CheckRancherRCDeps(ctx context.Context, org, gitRef string) (*RancherRCDeps, error) {
-	var content RancherRCDeps
-	files := []string{"Dockerfile.dapper", "go.mod", "/package/Dockerfile", "/pkg/apis/go.mod", "/pkg/settings/setting.go", "/scripts/package-env"}
-	devDependencyPattern := regexp.MustCompile(`dev-v[0-9]+\.[0-9]+`)
-	rcTagPattern := regexp.MustCompile(`-rc[0-9]+`)
-	ghClient := repository.NewGithub(ctx, "")
-
-	for _, filePath := range files {
-		var scanner *bufio.Scanner
-
-		fileContent, err := remoteGitContent(ctx, ghClient, org, rancherRepo, gitRef, filePath)
-		if err != nil {
-			return nil, err
-		}
-
-		scanner = bufio.NewScanner(strings.NewReader(fileContent))
-		lineNum := 1
-
-		for scanner.Scan() {
-			line := scanner.Text()
-			if strings.Contains(line, "indirect") {
-				continue
-			}
-
-			if devDependencyPattern.MatchString(line) {
-				lineContent := RancherRCDepsLine{File: filePath, Line: lineNum, Content: formatContentLine(line)}
-				lineContentLower := strings.ToLower(lineContent.Content)
-
-				if strings.Contains(lineContentLower, "chart") {
-					content.ChartsWithDev = append(content.ChartsWithDev, lineContent)
-				} else if strings.Contains(lineContentLower, "kdm") {
-					content.KDMWithDev = append(content.KDMWithDev, lineContent)
-				}
-			}
-			if strings.Contains(filePath, "/package/Dockerfile") {
-				if regexp.MustCompile(`CATTLE_(\S+)_MIN_VERSION`).MatchString(line) && strings.Contains(line, "-rc") {
-					lineContent := RancherRCDepsLine{Line: lineNum, File: filePath, Content: formatContentLine(line)}
-					content.MinFilesWithRC = append(content.MinFilesWithRC, lineContent)
-				}
-			}
-
-			if rcTagPattern.MatchString(line) {
-				lineContent := RancherRCDepsLine{File: filePath, Line: lineNum, Content: formatContentLine(line)}
-				content.FilesWithRC = append(content.FilesWithRC, lineContent)
-			}
-
-			lineNum++
-		}
-		if err := scanner.Err(); err != nil {
+// CheckRancherRCDeps scans the files of a rancher repository git ref on GitHub, with the
+// default Rancher rules when rules is nil and an unauthenticated client when ghClient is nil
+func CheckRancherRCDeps(ctx context.Context, ghClient *github.Client, org, repo, gitRef string, rules *rcdeps.Rules) (*rcdeps.Report, error) {
+	if rules == nil {
+		var err error
+		if rules, err = rcdeps.Rancher.Rules(); err != nil {
 			return nil, err
 		}
 	}
-
-	return &content, nil
-}
-
-func (r *RancherRCDeps) ToString() (string, error) {
-	tmpl := template.New("rancher-release-rc-dev-deps")
-	tmpl = template.Must(tmpl.Parse(checkRancherRCDepsTemplate))
-	buff := bytes.NewBuffer(nil)
-	err := tmpl.ExecuteTemplate(buff, "componentsFile", r)
-
-	return buff.String(), err
-}
-
-func remoteGitContent(ctx context.Context, ghClient *github.Client, org, repo, gitRef, filePath string) (string, error) {
-	content, _, _, err := ghClient.Repositories.GetContents(ctx, org, repo, filePath, &github.RepositoryContentGetOptions{Ref: gitRef})
-	if err != nil {
-		return "", err
+	if ghClient == nil {
+		ghClient = repository.NewGithub(ctx, "")
 	}
 
-	decodedContent, err := content.GetContent()
+	report, err := rcdeps.ScanRemote(ctx, ghClient, org, repo, gitRef, rules)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	report.Product = rcdeps.Rancher.Name
 
-	return decodedContent, nil
-}
-
-func formatContentLine(line string) string {
-	re := regexp.MustCompile(`\s+`)
-	line = re.ReplaceAllString(line, " ")
-
-	return strings.TrimSpace(line)
+	return report, nil
 }
 
 // ImagesLocations searches for missing images in a registry and creates a map with the locations of the images, or if they are missing
 // this map can be used to identify where which image should be synced from
-func ImagesLocations(username, password string, concurrencyLimit int, checkImages, ignoreImages []string, targetRegistry string, imagesRegiestries []string) (map[string][]string, error) {
+func ImagesLocations(username, password string, concurrencyLimit int, checkImages, ignoreImages []string, targetRegistry string, imagesRegiestries []string, options ...reg.Option) (map[string][]string, error) {
 	imagesLocations := make(map[string][]string)
 
-	missingFromTarget, err := MissingImagesFromRegistry(username, password, targetRegistry, concurrencyLimit, checkImages, ignoreImages)
+	missingFromTarget, err := MissingImagesFromRegistry(username, password, targetRegistry, concurrencyLimit, checkImages, ignoreImages, options...)
 	if err != nil {
 		return nil, err
 	}
 
 	lastMissingImages := missingFromTarget
 	for _, registry := range imagesRegiestries {
-		missingFromRegistry, err := MissingImagesFromRegistry(username, password, registry, concurrencyLimit, lastMissingImages, ignoreImages)
+		missingFromRegistry, err := MissingImagesFromRegistry(username, password, registry, concurrencyLimit, lastMissingImages, ignoreImages, options...)
 		if err != nil {
 			return nil, err
 		}
@@ -434,34 +378,25 @@ func imagesDiff(source, compare []string) ([]string, error) {
 	return diff, nil
 }
 
-// MissingImagesFromRegistry receives registry information and a list of images and checks which images are missing from that registry
-// it uses the docker http api v2 to check images concurrently
-func MissingImagesFromRegistry(username, password, registry string, concurrencyLimit int, checkImages, ignoreImages []string) ([]string, error) {
+// MissingImagesFromRegistry receives registry information and a list of images and checks which images are missing from that registry.
+// The registry can be any registry, including mirrors under a path such as harbor.example.com/mirror, and local registries.
+func MissingImagesFromRegistry(username, password, registry string, concurrencyLimit int, checkImages, ignoreImages []string, options ...reg.Option) ([]string, error) {
 	ignore, err := imageSliceToMap(ignoreImages, true)
 	if err != nil {
 		return nil, err
 	}
 
-	// create an error group with a limit to prevent accidentaly doing a DOS attack against our registry
-	ctx, cancel := context.WithCancel(context.Background())
-	errGroup, ctx := errgroup.WithContext(ctx)
-	errGroup.SetLimit(concurrencyLimit)
-	missingImagesChan := make(chan string, len(checkImages))
-
-	// auth tokens can be reused, but maps need a lock for reading and writing in go routines
-	repositoryAuths := make(map[string]string)
-	mu := sync.RWMutex{}
+	client := newRegistryClient(registry, username, password, options)
 
-	rgInfo, ok := registriesInfo[registry]
-	if !ok {
-		cancel()
-		return nil, errors.New("registry must be one of the following: 'docker.io', 'registry.rancher.com' or 'stgregistry.suse.com'")
+	// parse every image before checking any, so a malformed one fails without leaving checks running
+	type imageRef struct {
+		name string
+		ref  name.Reference
 	}
-
+	var refs []imageRef
 	for _, imageAndVersion := range checkImages {
 		image, imageVersion, err := splitImageAndVersion(imageAndVersion)
 		if err != nil {
-			cancel()
 			return nil, err
 		}
 
@@ -469,52 +404,43 @@ func MissingImagesFromRegistry(username, password, registry string, concurrencyL
 			continue
 		}
 
-		func(ctx context.Context, missingImagesChan chan string, image, imageVersion, username, password string, repositoryAuths map[string]string, mu *sync.RWMutex) {
-			errGroup.Go(func() error {
-				// if any other check failed, stop running to prevent wasting resources
-				// this doesn't include 404's since it is expected. Any other errors are included
-				select {
-				case <-ctx.Done():
-					return ctx.Err()
-				default:
-					mu.Lock()
-
-					var ok bool
-					var auth string
-					var err error
-
-					auth, ok = repositoryAuths[image]
-					if !ok {
-						auth, err = registryAuth(rgInfo.AuthURL, rgInfo.Service, image, username, password)
-						if err != nil {
-							cancel()
-							return err
-						}
-						repositoryAuths[image] = auth
-					}
-					mu.Unlock()
-
-					exists, err := checkIfImageExists(rgInfo.BaseURL, image, imageVersion, auth)
-					if err != nil {
-						cancel()
-						return err
-					}
-
-					fullImage := image + ":" + imageVersion
-					if !exists {
-						missingImagesChan <- fullImage
-					}
-					return nil
-				}
-			})
-		}(ctx, missingImagesChan, image, imageVersion, username, password, repositoryAuths, &mu)
+		fullImage := image + ":" + imageVersion
+		ref, err := name.ParseReference(fullImage)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, imageRef{name: fullImage, ref: ref})
+	}
+
+	// create an error group with a limit to prevent accidentaly doing a DOS attack against our registry
+	errGroup, ctx := errgroup.WithContext(context.Background())
+	errGroup.SetLimit(concurrencyLimit)
+	missingImagesChan := make(chan string, len(refs))
+
+	for _, image := range refs {
+		image := image
+
+		errGroup.Go(func() error {
+			// if any other check failed, stop running to prevent wasting resources
+			// this doesn't include 404's since it is expected. Any other errors are included
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 
+			digest, err := client.Digest(ctx, image.ref)
+			if err != nil {
+				return errors.New(image.name + ": " + err.Error())
+			}
+			if digest == "" {
+				missingImagesChan <- image.name
+			}
+
+			return nil
+		})
 	}
 	if err := errGroup.Wait(); err != nil {
-		cancel()
 		return nil, err
 	}
-	cancel()
 
 	close(missingImagesChan)
 	missingImages := readStringChan(missingImagesChan)
@@ -522,8 +448,31 @@ func MissingImagesFromRegistry(username, password, registry string, concurrencyL
 	return missingImages, nil
 }
 
-func GenerateImagesSyncConfig(images []string, sourceRegistry, targetRegistry, outputPath string) error {
-	config, err := generateRegsyncConfig(images, sourceRegistry, targetRegistry)
+// newRegistryClient creates a client for the registry, using the username and password when set
+func newRegistryClient(registry, username, password string, options []reg.Option) *reg.Client {
+	if len(username) > 1 && len(password) > 1 {
+		options = append(options[:len(options):len(options)], reg.WithCredentials(registry, username, password))
+	}
+
+	return reg.NewClient(registry, false, options...)
+}
+
+// RegsyncOptions configure the generated regsync config
+type RegsyncOptions struct {
+	// Parallel is the number of images regsync syncs at once, 1 when unset
+	Parallel int
+	// MediaTypes are the manifest media types synced, the docker and OCI manifests and indexes when empty
+	MediaTypes []string
+	// AllowTags are tag regular expressions allowed for every repository, besides the listed image tags
+	AllowTags []string
+	// DenyTags are tag regular expressions never synced
+	DenyTags []string
+	// Merge adds the entries to an existing config file instead of overwriting it
+	Merge bool
+}
+
+func GenerateImagesSyncConfig(images []string, sourceRegistry, targetRegistry, outputPath string, opts RegsyncOptions) error {
+	config, err := generateRegsyncConfig(images, sourceRegistry, targetRegistry, opts)
 	if err != nil {
 		return err
 	}
@@ -533,18 +482,44 @@ func GenerateImagesSyncConfig(images []string, sourceRegistry, targetRegistry, o
 		return err
 	}
 
+	if opts.Merge {
+		existing, err := os.ReadFile(outputPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if err == nil {
+			if b, err = mergeRegsyncConfig(existing, b); err != nil {
+				return errors.New("failed to merge regsync config " + outputPath + ": " + err.Error())
+			}
+		}
+	}
+
 	return os.WriteFile(outputPath, b, 0644)
 }
 
-func generateRegsyncConfig(images []string, sourceRegistry, targetRegistry string) (*regsyncConfig, error) {
-	sourceRegistryInfo, ok := registriesInfo[sourceRegistry]
-	if !ok {
+func generateRegsyncConfig(images []string, sourceRegistry, targetRegistry string, opts RegsyncOptions) (*regsyncConfig, error) {
+	if sourceRegistry == "" {
 		return nil, errors.New("invalid source registry")
 	}
-	targetRegistryInfo, ok := registriesInfo[targetRegistry]
-	if !ok {
+	if targetRegistry == "" {
 		return nil, errors.New("invalid target registry")
 	}
+	for _, pattern := range append(opts.AllowTags[:len(opts.AllowTags):len(opts.AllowTags)], opts.DenyTags...) {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, errors.New("invalid tag pattern " + pattern + ": " + err.Error())
+		}
+	}
+	sourceRegistryInfo := registryEnv(sourceRegistry)
+	targetRegistryInfo := registryEnv(targetRegistry)
+
+	parallel := opts.Parallel
+	if parallel <= 0 {
+		parallel = 1
+	}
+	mediaTypes := opts.MediaTypes
+	if len(mediaTypes) == 0 {
+		mediaTypes = regsyncDefaultMediaTypes
+	}
 
 	config := regsyncConfig{
 		Version: 1,
@@ -561,27 +536,57 @@ func generateRegsyncConfig(images []string, sourceRegistry, targetRegistry strin
 			},
 		},
 		Defaults: regsyncDefaults{
-			Parallel:   1,
-			MediaTypes: regsyncDefaultMediaTypes,
+			Parallel:   parallel,
+			MediaTypes: mediaTypes,
 		},
-		Sync: make([]regsyncSync, len(images)),
+		Sync: make([]regsyncSync, 0, len(images)),
 	}
 
-	for i, imageAndVersion := range images {
+	// group the tags of each repository in a single entry, in the order the images are listed
+	entries := make(map[string]int)
+	for _, imageAndVersion := range images {
 		image, imageVersion, err := splitImageAndVersion(imageAndVersion)
 		if err != nil {
 			return nil, err
 		}
-		config.Sync[i] = regsyncSync{
-			Source: sourceRegistry + "/" + image,
-			Target: targetRegistry + "/" + image,
-			Type:   "repository",
-			Tags:   regsyncTags{Allow: []string{imageVersion}},
+
+		i, ok := entries[image]
+		if !ok {
+			i = len(config.Sync)
+			entries[image] = i
+			config.Sync = append(config.Sync, regsyncSync{
+				Source: sourceRegistry + "/" + image,
+				Target: targetRegistry + "/" + image,
+				Type:   "repository",
+				Tags:   regsyncTags{Allow: append([]string{}, opts.AllowTags...), Deny: append([]string(nil), opts.DenyTags...)},
+			})
 		}
+		config.Sync[i].Tags.Allow = appendMissing(config.Sync[i].Tags.Allow, imageVersion)
+	}
+	for i := range config.Sync {
+		sort.Strings(config.Sync[i].Tags.Allow)
 	}
+
 	return &config, nil
 }
 
+// appendMissing appends the values that aren't in the slice yet
+func appendMissing(values []string, add ...string) []string {
+	for _, value := range add {
+		found := false
+		for _, v := range values {
+			if v == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 func imageSliceToMap(images []string, validate bool) (map[string]bool, error) {
 	imagesMap := make(map[string]bool, len(images))
 	for _, image := range images {
@@ -623,54 +628,174 @@ func validateRepoImage(repoImage string) error {
 	return nil
 }
 
-func GenerateDockerImageDigests(outputFile, imagesFileURL, registry, username, password string, verbose bool) error {
-	imagesDigests, err := dockerImagesDigests(imagesFileURL, registry, username, password)
+// DigestChange is an image tag whose digest changed between two runs, which points to a retagged image
+type DigestChange struct {
+	Image    string
+	Previous string
+	Current  string
+}
+
+// GenerateDockerImageDigests writes the digests of the images in the images list, one line per image, and
+// one more line per platform manifest of multi-platform images when platformDigests is set.
+// When verifyFile is set, the digests are compared with those of a previous run and changed digests are reported.
+func GenerateDockerImageDigests(outputFile, imagesFileURL, registry, username, password string, concurrencyLimit int, platformDigests bool, verifyFile string, verbose bool, options ...reg.Option) error {
+	imagesList, err := artifactImageList(imagesFileURL, registry)
 	if err != nil {
 		return err
 	}
-	return createAssetFile(outputFile, imagesDigests)
-}
 
-func dockerImagesDigests(imagesFileURL, registry, username, password string) (imageDigest, error) {
-	imagesList, err := artifactImageList(imagesFileURL, registry)
+	client := newRegistryClient(registry, username, password, options)
+
+	imagesDigests, err := dockerImagesDigests(context.Background(), client, registry, imagesList, concurrencyLimit, platformDigests)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if err := createAssetFile(outputFile, imagesDigests); err != nil {
+		return err
+	}
+	if verbose {
+		fmt.Println("wrote " + strconv.Itoa(len(imagesDigests)) + " digests to " + outputFile)
+	}
+
+	if verifyFile == "" {
+		return nil
+	}
+
+	previous, err := readImageDigests(verifyFile)
+	if err != nil {
+		return err
 	}
 
-	rgInfo, ok := registriesInfo[registry]
-	if !ok {
-		return nil, errors.New("registry must be one of the following: 'docker.io', 'registry.rancher.com' or 'stgregistry.suse.com'")
+	changes := changedImageDigests(previous, imagesDigests)
+	for _, change := range changes {
+		fmt.Println(change.Image + ": " + change.Previous + " -> " + change.Current)
+	}
+	if len(changes) > 0 {
+		return errors.New(strconv.Itoa(len(changes)) + " digests changed since " + verifyFile + ", images may have been retagged")
 	}
 
+	return nil
+}
+
+// dockerImagesDigests gets the digests of the images, keyed by the image for the index or single
+// platform manifest digest, and when platformDigests is set by image@os/arch for each platform
+// manifest of an index
+func dockerImagesDigests(ctx context.Context, client *reg.Client, registry string, imagesList []string, concurrencyLimit int, platformDigests bool) (imageDigest, error) {
 	imagesDigests := make(imageDigest)
-	repositoryAuths := make(map[string]string)
+	var mu sync.Mutex
 
+	if concurrencyLimit <= 0 {
+		concurrencyLimit = 1
+	}
+	// parse every image before looking any up, so a malformed one fails without leaving lookups running
+	type imageRef struct {
+		name string
+		ref  name.Reference
+	}
+	var refs []imageRef
 	for _, imageAndVersion := range imagesList {
 		if imageAndVersion == "" || imageAndVersion == " " {
 			continue
 		}
 		if !strings.Contains(imageAndVersion, ":") {
-			return nil, errors.New("malformed image name: , missing ':'")
+			return nil, errors.New("malformed image name: " + imageAndVersion + ", missing ':'")
+		}
+
+		ref, err := name.ParseReference(imageAndVersion)
+		if err != nil {
+			return nil, errors.New("failed to parse image " + imageAndVersion + ": " + err.Error())
 		}
-		splitImage := strings.Split(imageAndVersion, ":")
-		image := splitImage[0]
-		imageVersion := splitImage[1]
+		refs = append(refs, imageRef{name: imageAndVersion, ref: ref})
+	}
 
-		if _, ok := repositoryAuths[image]; !ok {
-			auth, err := registryAuth(rgInfo.AuthURL, rgInfo.Service, image, username, password)
+	errGroup, ctx := errgroup.WithContext(ctx)
+	errGroup.SetLimit(concurrencyLimit)
+
+	for _, image := range refs {
+		image := image
+		// e.g: registry.rancher.com/rancher/rancher:v2.9.0
+		key := registry + "/" + image.name
+
+		errGroup.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			img, err := client.Image(ctx, image.ref)
 			if err != nil {
-				return nil, err
+				return errors.New(image.name + ": " + err.Error())
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			// e.g: registry.rancher.com/rancher/rancher:v2.9.0 = sha256:1234567890
+			imagesDigests[key] = img.Digest
+			if !platformDigests {
+				return nil
+			}
+			for platform, digest := range img.Digests {
+				// attestation manifests stored in the index don't have a platform
+				if platform.OS == "unknown" || digest == img.Digest {
+					continue
+				}
+				// e.g: registry.rancher.com/rancher/rancher:v2.9.0@linux/amd64 = sha256:0987654321
+				imagesDigests[key+"@"+platform.String()] = digest
 			}
-			repositoryAuths[image] = auth
+
+			return nil
+		})
+	}
+	if err := errGroup.Wait(); err != nil {
+		return nil, err
+	}
+
+	return imagesDigests, nil
+}
+
+// readImageDigests reads a file written by GenerateDockerImageDigests
+func readImageDigests(file string) (imageDigest, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	digests := make(imageDigest)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		switch len(fields) {
+		case 0:
+			continue
+		case 1:
+			digests[fields[0]] = ""
+		default:
+			digests[fields[0]] = fields[1]
 		}
-		digest, _, err := dockerImageDigest(rgInfo.BaseURL, image, imageVersion, repositoryAuths[image])
-		if err != nil {
-			return nil, err
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return digests, nil
+}
+
+// changedImageDigests returns the images found in both runs whose digest changed, sorted by image
+func changedImageDigests(previous, current imageDigest) []DigestChange {
+	var changes []DigestChange
+	for image, digest := range current {
+		previousDigest, ok := previous[image]
+		if !ok || previousDigest == "" || digest == "" || previousDigest == digest {
+			continue
 		}
-		// e.g: registry.rancher.com/rancher/rancher:v2.9.0 = sha256:1234567890
-		imagesDigests[registry+"/"+imageAndVersion] = digest
+		changes = append(changes, DigestChange{Image: image, Previous: previousDigest, Current: digest})
 	}
-	return imagesDigests, nil
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Image < changes[j].Image
+	})
+
+	return changes
 }
 
 func createAssetFile(outputFile string, contents fmt.Stringer) error {
@@ -747,81 +872,6 @@ func getLinesFromReader(body io.Reader) ([]string, error) {
 	return strings.Split(string(lines), "\n"), nil
 }
 
-func dockerImageDigest(registryBaseURL, img, imgVersion, auth string) (string, int, error) {
-	httpClient := ecmHTTP.NewClient(time.Second * 15)
-	req, err := http.NewRequest("GET", registryBaseURL+"/v2/"+img+"/manifests/"+imgVersion, nil)
-	if err != nil {
-		return "", 0, err
-	}
-
-	req.Header.Add("Accept", "application/vnd.oci.image.index.v1+json")
-	req.Header.Add("Accept", "application/vnd.oci.image.manifest.v1+json")
-	req.Header.Add("Accept", "application/vnd.docker.distribution.manifest.v2+json")
-	req.Header.Add("Accept", "application/vnd.docker.distribution.manifest.v1+prettyjws")
-	req.Header.Add("Accept", "application/vnd.docker.distribution.manifest.v1+json")
-	req.Header.Add("Accept", "application/vnd.docker.distribution.manifest.list.v2+json")
-	req.Header.Add("Accept", "application/vnd.oci.image.index.v1+json")
-	req.Header.Add("Docker-Distribution-Api-Version", "registry/2.0")
-	req.Header.Add("Authorization", "Bearer "+auth)
-	res, err := httpClient.Do(req)
-	if err != nil {
-		return "", 0, err
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode == http.StatusNotFound {
-		return "", res.StatusCode, nil
-	}
-	dockerDigest := res.Header.Get("Docker-Content-Digest")
-	if dockerDigest == "" {
-		return "", res.StatusCode, errors.New("empty digest header 'Docker-Content-Digest'")
-	}
-	return dockerDigest, res.StatusCode, nil
-}
-
-func checkIfImageExists(registryBaseURL, img, imgVersion, auth string) (bool, error) {
-	_, statusCode, err := dockerImageDigest(registryBaseURL, img, imgVersion, auth)
-	if err != nil {
-		return false, err
-	}
-	if statusCode == http.StatusNotFound {
-		return false, nil
-	}
-	if statusCode != http.StatusOK {
-		return false, errors.New("expected status code to be 200, got: " + strconv.Itoa(statusCode))
-	}
-
-	return true, nil
-}
-
-func registryAuth(authURL, service, image, username, password string) (string, error) {
-	httpClient := ecmHTTP.NewClient(time.Second * 15)
-	scope := "repository:" + image + ":pull"
-	url := authURL + "?scope=" + scope + "&service=" + service
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return "", err
-	}
-	if len(username) > 1 && len(password) > 1 {
-		req.SetBasicAuth(username, password)
-	}
-	res, err := httpClient.Do(req)
-	if err != nil {
-		return "", err
-	}
-	if res.StatusCode != http.StatusOK {
-		return "", errors.New("expected status code to be 200, got: " + strconv.Itoa(res.StatusCode))
-	}
-	defer res.Body.Close()
-
-	var auth registryAuthToken
-	if err := json.NewDecoder(res.Body).Decode(&auth); err != nil {
-		return "", err
-	}
-
-	return auth.Token, nil
-}
-
 func ImagesFromArtifact(url string) ([]string, error) {
 	httpClient := ecmHTTP.NewClient(time.Second * 15)
 	res, err := httpClient.Get(url)
@@ -851,151 +901,3 @@ func readStringChan(ch <-chan string) []string {
 
 	return data
 }
-
-const checkRancherRCDepsTemplate = `{{- define "componentsFile" -}}
-# Images with -rc
-{{range .RancherImages}}
-* {{ .Content }} ({{ .File }}, line {{ .Line }})
-{{- end}}
-
-# Components with -rc
-{{range .FilesWithRC}}
-* {{ .Content }} ({{ .File }}, line {{ .Line }})
-{{- end}}
-
-# Min version components with -rc
-{{range .MinFilesWithRC}}
-* {{ .Content }} ({{ .File }}, line {{ .Line }})
-{{- end}} 
-
-# KDM References with dev branch
-{{range .KDMWithDev}}
-* {{ .Content }} ({{ .File }}, line {{ .Line }})
-{{- end}}
-
-# Chart References with dev branch
-{{range .ChartsWithDev}}
-* {{ .Content }} ({{ .File }}, line {{ .Line }})
-{{- end}}
-{{ end }}`
-
-const updateDashboardReferencesScript = `#!/bin/sh
-set -ex
-OS=$(uname -s)
-# Set variables (these are populated by Go's template engine)
-DRY_RUN="{{ .DryRun }}"
-BRANCH_NAME="{{ .BranchBaseName }}"
-VERSION="{{ .Tag }}"
-RANCHER_BRANCH="{{.RancherReleaseBranch}}"
-RANCHER_UPSTREAM_URL="{{ .RancherUpstreamURL }}"
-FILENAME="package/Dockerfile"
-
-# Add upstream remote if it doesn't exist
-# Note: Using ls | grep is not recommended for general use, but it's okay here
-# since we're only checking for 'rancher'
-git remote -v | grep -w upstream || git remote add upstream "${RANCHER_UPSTREAM_URL}"
-git fetch upstream
-git stash
-
-# Delete the branch if it exists, then create a new one based on upstream
-git branch -D "${BRANCH_NAME}" > /dev/null 2>&1 || true
-git checkout -B "${BRANCH_NAME}" "upstream/${RANCHER_BRANCH}"
-# git clean -xfd
-
-# Function to update the file
-update_file() {
-    _update_file_sed_cmd=""
-
-    # Set the appropriate sed command based on the OS
-    case "${OS}" in
-        Darwin)
-            _update_file_sed_cmd="sed -i ''"
-            ;;
-        Linux)
-            _update_file_sed_cmd="sed -i"
-            ;;
-        *)
-            echo "$(OS) not supported yet" >&2
-            exit 1
-            ;;
-    esac
-
-    # Update CATTLE_UI_VERSION, removing leading 'v' if present (${VERSION#v} the '#v' removes the leading 'v')
-    ${_update_file_sed_cmd} "s/ENV CATTLE_UI_VERSION=.*/ENV CATTLE_UI_VERSION=${VERSION#v}/" "${FILENAME}"
-
-    # Update CATTLE_DASHBOARD_UI_VERSION
-    ${_update_file_sed_cmd} "s/ENV CATTLE_DASHBOARD_UI_VERSION=.*/ENV CATTLE_DASHBOARD_UI_VERSION=${VERSION}/" "${FILENAME}"
-}
-
-# Run the update function
-update_file
-
-git add $FILENAME
-git commit --signoff -m "Update Dashboard refs to ${VERSION}"
-
-if [ "${DRY_RUN}" = false ]; then
-	git push --set-upstream origin "${BRANCH_NAME}" # run git remote -v for your origin
-fi
-
-# Cleaning temp files/scripts
-git clean -f`
-
-const updateCLIReferencesScript = `#!/bin/sh
-set -ex
-OS=$(uname -s)
-
-# Set variables (these are populated by Go's template engine)
-DRY_RUN="{{ .DryRun }}"
-BRANCH_NAME="{{ .BranchName }}"
-VERSION="{{ .Tag }}"
-FILENAME="package/Dockerfile"
-RANCHER_UPSTREAM_URL="{{ .RancherUpstreamURL }}"
-RANCHER_RELEASE_BRANCH="{{ .RancherReleaseBranch }}"
-
-# Add upstream remote if it doesn't exist
-# Note: Using ls | grep is not recommended for general use, but it's okay here
-# since we're only checking for 'rancher'
-git remote -v | grep -w upstream || git remote add upstream "$RANCHER_UPSTREAM_URL"
-git fetch upstream
-git stash
-
-# Delete the branch if it exists, then create a new one based on upstream
-git branch -D "${BRANCH_NAME}" > /dev/null 2>&1 || true
-git checkout -B "${BRANCH_NAME}" "upstream/$RANCHER_RELEASE_BRANCH"
-# git clean -xfd
-
-# Function to update the file
-update_file() {
-    _update_file_sed_cmd=""
-
-    # Set the appropriate sed command based on the OS
-    case "${OS}" in
-        Darwin)
-            _update_file_sed_cmd="sed -i ''"
-            ;;
-        Linux)
-            _update_file_sed_cmd="sed -i"
-            ;;
-        *)
-            echo "$(OS) not supported yet" >&2
-            exit 1
-            ;;
-    esac
-
-    # Update CATTLE_CLI_VERSION
-    ${_update_file_sed_cmd} "s/ENV CATTLE_CLI_VERSION=.*/ENV CATTLE_CLI_VERSION=${VERSION}/" "${FILENAME}"
-}
-
-# Run the update function
-update_file
-
-git add $FILENAME
-git commit --signoff -m "Update to Dashboard refs to ${VERSION}"
-
-# Push the changes if not a dry run
-if [ "${DRY_RUN}" = false ]; then
-	git push --set-upstream origin "${BRANCH_NAME}" # run git remote -v for your origin
-fi
-
-# Cleaning temp files/scripts
-git clean -f`
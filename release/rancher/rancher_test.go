@@ -1,6 +1,31 @@
 package rancher
 
-import "testing"
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	reg "github.com/rancher/ecm-distro-tools/registry"
+	"github.com/rancher/ecm-distro-tools/repository"
+	"sigs.k8s.io/yaml"
+)
 
 const (
 	rancherRepoImage = "rancher/rancher"
@@ -73,7 +98,7 @@ func TestGenerateRegsyncConfig(t *testing.T) {
 	sourceRancherImage := sourceRegistry + "/" + rancherImage
 	sourceRancherAgentImage := sourceRegistry + "/" + rancherAgentImage
 	targetRancherImage := targetRegistry + "/" + rancherImage
-	config, err := generateRegsyncConfig(images, sourceRegistry, targetRegistry)
+	config, err := generateRegsyncConfig(images, sourceRegistry, targetRegistry, RegsyncOptions{})
 	if err != nil {
 		t.Error(err)
 	}
@@ -90,3 +115,502 @@ func TestGenerateRegsyncConfig(t *testing.T) {
 		t.Error("rancher agent image should be: '" + sourceRancherAgentImage + "' instead, got: '" + config.Sync[1].Source + "'")
 	}
 }
+
+func TestGenerateRegsyncConfigGroupsTags(t *testing.T) {
+	images := []string{"rancher/rancher:v2.9.1", "rancher/rancher-agent:v2.9.1", "rancher/rancher:v2.9.0", "rancher/rancher:v2.9.1"}
+	opts := RegsyncOptions{
+		Parallel:   4,
+		MediaTypes: []string{"application/vnd.oci.image.index.v1+json"},
+		AllowTags:  []string{`v2\.9\.[0-9]+-rc[0-9]+`},
+		DenyTags:   []string{`.*-windows-.*`},
+	}
+
+	config, err := generateRegsyncConfig(images, "docker.io", "registry.rancher.com", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []regsyncSync{
+		{
+			Source: "docker.io/rancher/rancher",
+			Target: "registry.rancher.com/rancher/rancher",
+			Type:   "repository",
+			Tags:   regsyncTags{Allow: []string{"v2.9.0", "v2.9.1", `v2\.9\.[0-9]+-rc[0-9]+`}, Deny: []string{`.*-windows-.*`}},
+		},
+		{
+			Source: "docker.io/rancher/rancher-agent",
+			Target: "registry.rancher.com/rancher/rancher-agent",
+			Type:   "repository",
+			Tags:   regsyncTags{Allow: []string{"v2.9.1", `v2\.9\.[0-9]+-rc[0-9]+`}, Deny: []string{`.*-windows-.*`}},
+		},
+	}
+	if !reflect.DeepEqual(config.Sync, expected) {
+		t.Errorf("generateRegsyncConfig() sync = %+v, want %+v", config.Sync, expected)
+	}
+	if config.Defaults.Parallel != 4 || !reflect.DeepEqual(config.Defaults.MediaTypes, opts.MediaTypes) {
+		t.Errorf("generateRegsyncConfig() defaults = %+v", config.Defaults)
+	}
+
+	if _, err := generateRegsyncConfig(images, "docker.io", "registry.rancher.com", RegsyncOptions{DenyTags: []string{"v2.9.["}}); err == nil {
+		t.Error("generateRegsyncConfig() expected an error for an invalid tag pattern")
+	}
+}
+
+func TestGenerateImagesSyncConfigMerge(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "config.yaml")
+
+	if err := GenerateImagesSyncConfig([]string{"rancher/rancher:v2.9.0", "rancher/shell:v0.2.1"}, "docker.io", "registry.rancher.com", output, RegsyncOptions{Merge: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := GenerateImagesSyncConfig([]string{"rancher/rancher:v2.9.1", "rancher/rancher:v2.9.0", "rancher/fleet:v0.10.1"}, "docker.io", "registry.rancher.com", output, RegsyncOptions{Merge: true, Parallel: 8}); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config regsyncConfig
+	if err := yaml.Unmarshal(b, &config); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(config.Creds) != 2 {
+		t.Errorf("merged creds = %+v, want one per registry", config.Creds)
+	}
+	if config.Defaults.Parallel != 1 {
+		t.Errorf("merged parallel = %d, want the existing 1", config.Defaults.Parallel)
+	}
+
+	tags := make(map[string][]string)
+	for _, sync := range config.Sync {
+		if _, ok := tags[sync.Source]; ok {
+			t.Errorf("duplicated sync entry for %s", sync.Source)
+		}
+		tags[sync.Source] = sync.Tags.Allow
+	}
+	expected := map[string][]string{
+		"docker.io/rancher/rancher": {"v2.9.0", "v2.9.1"},
+		"docker.io/rancher/shell":   {"v0.2.1"},
+		"docker.io/rancher/fleet":   {"v0.10.1"},
+	}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("merged tags = %v, want %v", tags, expected)
+	}
+}
+
+func TestGenerateImagesSyncConfigMergeKeepsFields(t *testing.T) {
+	existing := `version: 1
+x-sync-defaults: &sync-defaults
+  type: repository
+  digestTags: true
+  referrers: true
+creds:
+  - registry: registry.rancher.com
+    user: '{{env "PRIME_REGISTRY_USERNAME"}}'
+    pass: '{{env "PRIME_REGISTRY_PASSWORD"}}'
+    tls: enabled
+    repoAuth: true
+defaults:
+  parallel: 4
+  interval: 60m
+  backup: "bkup-{{.Ref.Tag}}"
+  ratelimit:
+    min: 100
+    retry: 15m
+sync:
+  # rancher itself
+  - <<: *sync-defaults
+    source: docker.io/rancher/rancher
+    target: registry.rancher.com/rancher/rancher
+    platform: linux/amd64
+    tags:
+      allow:
+        - v2.9.0
+`
+	output := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(output, []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := GenerateImagesSyncConfig([]string{"rancher/rancher:v2.9.1", "rancher/shell:v0.2.1"}, "docker.io", "registry.rancher.com", output, RegsyncOptions{Merge: true, Parallel: 8}); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, kept := range []string{
+		"x-sync-defaults: &sync-defaults",
+		"<<: *sync-defaults",
+		"# rancher itself",
+		"tls: enabled",
+		"repoAuth: true",
+		"interval: 60m",
+		"backup: \"bkup-{{.Ref.Tag}}\"",
+		"retry: 15m",
+		"platform: linux/amd64",
+	} {
+		if !strings.Contains(string(b), kept) {
+			t.Errorf("merged config doesn't contain %q:\n%s", kept, b)
+		}
+	}
+
+	// the aliases are resolved when parsing, so the merged fields are in every entry using them
+	var config struct {
+		Creds []struct {
+			Registry string `json:"registry"`
+			TLS      string `json:"tls"`
+			RepoAuth bool   `json:"repoAuth"`
+		} `json:"creds"`
+		Defaults struct {
+			Parallel  int               `json:"parallel"`
+			RateLimit map[string]string `json:"ratelimit"`
+		} `json:"defaults"`
+		Sync []struct {
+			regsyncSync
+			DigestTags bool   `json:"digestTags"`
+			Referrers  bool   `json:"referrers"`
+			Platform   string `json:"platform"`
+		} `json:"sync"`
+	}
+	if err := yaml.Unmarshal(b, &config); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(config.Creds) != 2 || config.Creds[0].TLS != "enabled" || !config.Creds[0].RepoAuth || config.Creds[1].Registry != "docker.io" {
+		t.Errorf("merged creds = %+v, want the existing prime creds and the docker.io creds", config.Creds)
+	}
+	if config.Defaults.Parallel != 4 || config.Defaults.RateLimit["retry"] != "15m" {
+		t.Errorf("merged defaults = %+v, want the existing defaults", config.Defaults)
+	}
+	if len(config.Sync) != 2 {
+		t.Fatalf("merged sync = %+v, want 2 entries", config.Sync)
+	}
+	rancherSync := config.Sync[0]
+	if rancherSync.Type != "repository" || !rancherSync.DigestTags || !rancherSync.Referrers || rancherSync.Platform != "linux/amd64" {
+		t.Errorf("merged rancher entry = %+v, want the existing fields kept", rancherSync)
+	}
+	if expected := []string{"v2.9.0", "v2.9.1"}; !reflect.DeepEqual(rancherSync.Tags.Allow, expected) {
+		t.Errorf("merged rancher tags = %v, want %v", rancherSync.Tags.Allow, expected)
+	}
+	if shellSync := config.Sync[1]; shellSync.Source != "docker.io/rancher/shell" || !reflect.DeepEqual(shellSync.Tags.Allow, []string{"v0.2.1"}) {
+		t.Errorf("merged shell entry = %+v, want the generated entry", shellSync)
+	}
+}
+
+func TestMissingImagesFromRegistry(t *testing.T) {
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(server.Close)
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	img, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, image := range []string{host + "/rancher/rancher:v2.9.0", host + "/mirror/rancher/rancher-agent:v2.9.0"} {
+		ref, err := name.ParseReference(image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := remote.Write(ref, img); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		registry string
+		ignore   []string
+		expected []string
+	}{
+		{
+			name:     "local registry",
+			registry: host,
+			expected: []string{"rancher/rancher-agent:v2.9.0", "k3s-io/k3s:v1.25.4"},
+		},
+		{
+			name:     "mirror under a path",
+			registry: host + "/mirror",
+			expected: []string{"rancher/rancher:v2.9.0", "k3s-io/k3s:v1.25.4"},
+		},
+		{
+			name:     "ignored images",
+			registry: host,
+			ignore:   []string{"k3s-io/k3s"},
+			expected: []string{"rancher/rancher-agent:v2.9.0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			missing, err := MissingImagesFromRegistry("", "", tt.registry, 2, imagesWithVersion, tt.ignore)
+			if err != nil {
+				t.Fatalf("MissingImagesFromRegistry() error = %v", err)
+			}
+			sort.Strings(missing)
+			sort.Strings(tt.expected)
+			if !reflect.DeepEqual(missing, tt.expected) {
+				t.Errorf("MissingImagesFromRegistry() = %v, want %v", missing, tt.expected)
+			}
+		})
+	}
+}
+
+func TestImagesLocationsWithCredentials(t *testing.T) {
+	handler := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "pass" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	img, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := remote.WithAuth(&authn.Basic{Username: "user", Password: "pass"})
+	for _, image := range []string{host + "/prime/rancher/rancher:v2.9.0", host + "/mirror/rancher/rancher-agent:v2.9.0"} {
+		ref, err := name.ParseReference(image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := remote.Write(ref, img, auth); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the docker config keychain isn't used, so requests are anonymous unless the credentials are used
+	options := []reg.Option{reg.WithKeychain(authn.NewMultiKeychain())}
+
+	missing, err := MissingImagesFromRegistry("user", "pass", host+"/prime", 2, imagesWithVersion, nil, options...)
+	if err != nil {
+		t.Fatalf("MissingImagesFromRegistry() error = %v", err)
+	}
+	sort.Strings(missing)
+	if expected := []string{"k3s-io/k3s:v1.25.4", "rancher/rancher-agent:v2.9.0"}; !reflect.DeepEqual(missing, expected) {
+		t.Errorf("MissingImagesFromRegistry() = %v, want %v", missing, expected)
+	}
+
+	if _, err := MissingImagesFromRegistry("", "", host+"/prime", 2, imagesWithVersion, nil, options...); err == nil {
+		t.Error("MissingImagesFromRegistry() without credentials expected an error")
+	}
+
+	locations, err := ImagesLocations("user", "pass", 2, imagesWithVersion, nil, host+"/prime", []string{host + "/mirror"}, options...)
+	if err != nil {
+		t.Fatalf("ImagesLocations() error = %v", err)
+	}
+	expected := map[string][]string{
+		host + "/mirror": {"rancher/rancher-agent:v2.9.0"},
+		"missing":        {"k3s-io/k3s:v1.25.4"},
+	}
+	if !reflect.DeepEqual(locations, expected) {
+		t.Errorf("ImagesLocations() = %v, want %v", locations, expected)
+	}
+}
+
+func TestGenerateDockerImageDigests(t *testing.T) {
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(server.Close)
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	parse := func(image string) name.Reference {
+		ref, err := name.ParseReference(host + "/" + image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ref
+	}
+
+	idx, err := random.Index(64, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// random indexes don't set platforms
+	var addenda []mutate.IndexAddendum
+	for i, arch := range []string{"amd64", "arm64"} {
+		img, err := idx.Image(manifest.Manifests[i].Digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		descriptor := manifest.Manifests[i]
+		descriptor.Platform = &v1.Platform{OS: "linux", Architecture: arch}
+		addenda = append(addenda, mutate.IndexAddendum{Add: img, Descriptor: descriptor})
+	}
+	index := mutate.AppendManifests(empty.Index, addenda...)
+	if err := remote.WriteIndex(parse("rancher/rancher:v2.9.0"), index); err != nil {
+		t.Fatal(err)
+	}
+
+	shell, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(parse("rancher/shell:v0.2.1"), shell); err != nil {
+		t.Fatal(err)
+	}
+
+	images := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "rancher/rancher:v2.9.0\nrancher/shell:v0.2.1\nrancher/fleet:v0.10.1\n")
+	}))
+	t.Cleanup(images.Close)
+
+	dir := t.TempDir()
+	previous := filepath.Join(dir, "previous.txt")
+	if err := GenerateDockerImageDigests(previous, images.URL, host, "", "", 2, false, "", false); err != nil {
+		t.Fatal(err)
+	}
+
+	digests, err := readImageDigests(previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexDigest, _ := index.Digest()
+	shellDigest, _ := shell.Digest()
+	expected := imageDigest{
+		host + "/rancher/rancher:v2.9.0": indexDigest.String(),
+		host + "/rancher/shell:v0.2.1":   shellDigest.String(),
+		host + "/rancher/fleet:v0.10.1":  "",
+	}
+	if !reflect.DeepEqual(digests, expected) {
+		t.Errorf("GenerateDockerImageDigests() = %v, want %v", digests, expected)
+	}
+
+	withPlatforms := filepath.Join(dir, "platforms.txt")
+	if err := GenerateDockerImageDigests(withPlatforms, images.URL, host, "", "", 2, true, "", false); err != nil {
+		t.Fatal(err)
+	}
+	platformDigests, err := readImageDigests(withPlatforms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected[host+"/rancher/rancher:v2.9.0@linux/amd64"] = manifest.Manifests[0].Digest.String()
+	expected[host+"/rancher/rancher:v2.9.0@linux/arm64"] = manifest.Manifests[1].Digest.String()
+	if !reflect.DeepEqual(platformDigests, expected) {
+		t.Errorf("GenerateDockerImageDigests() with platforms = %v, want %v", platformDigests, expected)
+	}
+
+	current := filepath.Join(dir, "current.txt")
+	if err := GenerateDockerImageDigests(current, images.URL, host, "", "", 2, false, previous, false); err != nil {
+		t.Errorf("GenerateDockerImageDigests() verify error = %v, want none for unchanged digests", err)
+	}
+
+	retagged, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(parse("rancher/shell:v0.2.1"), retagged); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := GenerateDockerImageDigests(current, images.URL, host, "", "", 2, false, previous, false); err == nil {
+		t.Error("GenerateDockerImageDigests() expected an error for a retagged image")
+	}
+
+	currentDigests, err := readImageDigests(current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retaggedDigest, _ := retagged.Digest()
+	changes := changedImageDigests(digests, currentDigests)
+	expectedChanges := []DigestChange{{Image: host + "/rancher/shell:v0.2.1", Previous: shellDigest.String(), Current: retaggedDigest.String()}}
+	if !reflect.DeepEqual(changes, expectedChanges) {
+		t.Errorf("changedImageDigests() = %+v, want %+v", changes, expectedChanges)
+	}
+}
+
+func TestDockerImagesDigestsMalformedImage(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	t.Cleanup(server.Close)
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	client := newRegistryClient(host, "", "", nil)
+	images := []string{"rancher/rancher:v2.9.0", "rancher/shell", "rancher/fleet:v0.10.1"}
+
+	_, err := dockerImagesDigests(context.Background(), client, host, images, 2, false)
+	if err == nil || !strings.Contains(err.Error(), "rancher/shell") {
+		t.Fatalf("dockerImagesDigests() error = %v, want a malformed image error naming rancher/shell", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 0 {
+		t.Errorf("dockerImagesDigests() made %d registry requests before failing, want 0", n)
+	}
+}
+
+func TestRegistryEnv(t *testing.T) {
+	tests := []struct {
+		registry string
+		expected registryInfo
+	}{
+		{
+			registry: "docker.io",
+			expected: registryInfo{UserEnv: `{{env "DOCKERIO_REGISTRY_USERNAME"}}`, PasswordEnv: `{{env "DOCKERIO_REGISTRY_PASSWORD"}}`},
+		},
+		{
+			registry: "localhost:5000",
+			expected: registryInfo{UserEnv: `{{env "LOCALHOST_5000_REGISTRY_USERNAME"}}`, PasswordEnv: `{{env "LOCALHOST_5000_REGISTRY_PASSWORD"}}`},
+		},
+		{
+			registry: "harbor.example.com/mirror",
+			expected: registryInfo{UserEnv: `{{env "HARBOR_EXAMPLE_COM_MIRROR_REGISTRY_USERNAME"}}`, PasswordEnv: `{{env "HARBOR_EXAMPLE_COM_MIRROR_REGISTRY_PASSWORD"}}`},
+		},
+	}
+
+	for _, tt := range tests {
+		if info := registryEnv(tt.registry); info != tt.expected {
+			t.Errorf("registryEnv(%s) = %+v, want %+v", tt.registry, info, tt.expected)
+		}
+	}
+}
+
+func TestReferencesEdits(t *testing.T) {
+	const dockerfile = "ENV CATTLE_UI_VERSION=2.9.2\nENV CATTLE_DASHBOARD_UI_VERSION=v2.9.2\nENV CATTLE_CLI_VERSION=v2.9.0\n"
+
+	tests := []struct {
+		name     string
+		edits    []repository.FileEdit
+		expected string
+	}{
+		{
+			name:     "dashboard",
+			edits:    dashboardReferencesEdits("v2.9.3"),
+			expected: "ENV CATTLE_UI_VERSION=2.9.3\nENV CATTLE_DASHBOARD_UI_VERSION=v2.9.3\nENV CATTLE_CLI_VERSION=v2.9.0\n",
+		},
+		{
+			name:     "cli",
+			edits:    cliReferencesEdits("v2.9.3"),
+			expected: "ENV CATTLE_UI_VERSION=2.9.2\nENV CATTLE_DASHBOARD_UI_VERSION=v2.9.2\nENV CATTLE_CLI_VERSION=v2.9.3\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := []byte(dockerfile)
+			for _, edit := range tt.edits {
+				if edit.Path != rancherDockerfile {
+					continue
+				}
+				var err error
+				if b, err = edit.Edit(b); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if string(b) != tt.expected {
+				t.Errorf("edited Dockerfile = %q, want %q", b, tt.expected)
+			}
+		})
+	}
+}
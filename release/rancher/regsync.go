@@ -0,0 +1,238 @@
+package rancher
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// mergeRegsyncConfig adds the credentials and sync entries of a generated config to an existing
+// one, merging the tags of entries syncing the same repositories. The merge is done on the YAML
+// nodes so the existing defaults, fields regsync supports but the generated config doesn't set,
+// like tls, repoAuth, ratelimit or digestTags, and anchors and comments are kept.
+func mergeRegsyncConfig(existing, generated []byte) ([]byte, error) {
+	var existingDoc, generatedDoc yaml.Node
+	if err := yaml.Unmarshal(existing, &existingDoc); err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(generated, &generatedDoc); err != nil {
+		return nil, err
+	}
+	if len(existingDoc.Content) == 0 {
+		return generated, nil
+	}
+
+	root := resolveNode(existingDoc.Content[0])
+	if root.Kind != yaml.MappingNode {
+		return nil, errors.New("the regsync config isn't a mapping")
+	}
+	generatedRoot := generatedDoc.Content[0]
+
+	for _, key := range []string{"version", "defaults"} {
+		if lookupNode(root, key) == nil {
+			if value := lookupNode(generatedRoot, key); value != nil {
+				root.Content = append(root.Content, scalarNode(key), value)
+			}
+		}
+	}
+
+	if generatedCreds := lookupNode(generatedRoot, "creds"); generatedCreds != nil {
+		creds := ownNode(root, "creds", yaml.SequenceNode)
+		for _, cred := range generatedCreds.Content {
+			registry := scalarValue(lookupNode(cred, "registry"))
+			found := false
+			for _, existingCred := range creds.Content {
+				if scalarValue(lookupNode(existingCred, "registry")) == registry {
+					found = true
+					break
+				}
+			}
+			if !found {
+				creds.Content = append(creds.Content, cred)
+			}
+		}
+	}
+
+	if generatedSync := lookupNode(generatedRoot, "sync"); generatedSync != nil {
+		syncs := ownNode(root, "sync", yaml.SequenceNode)
+		for _, sync := range generatedSync.Content {
+			entry := findSyncEntry(syncs, sync)
+			if entry == nil {
+				syncs.Content = append(syncs.Content, sync)
+				continue
+			}
+
+			generatedTags := lookupNode(sync, "tags")
+			tags := ownNode(entry, "tags", yaml.MappingNode)
+			allow := ownNode(tags, "allow", yaml.SequenceNode)
+			appendMissingScalars(allow, lookupNode(generatedTags, "allow"))
+			sort.SliceStable(allow.Content, func(i, j int) bool {
+				return scalarValue(allow.Content[i]) < scalarValue(allow.Content[j])
+			})
+			if deny := lookupNode(generatedTags, "deny"); deny != nil && len(deny.Content) > 0 {
+				appendMissingScalars(ownNode(tags, "deny", yaml.SequenceNode), deny)
+			}
+		}
+	}
+
+	// yaml.v3 writes the merge keys it parsed with their explicit !!merge tag
+	clearMergeTags(&existingDoc)
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&existingDoc); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// findSyncEntry returns the existing sync entry with the source, target and type of the entry
+func findSyncEntry(syncs, sync *yaml.Node) *yaml.Node {
+	for _, entry := range syncs.Content {
+		entry = resolveNode(entry)
+		matches := true
+		for _, key := range []string{"source", "target", "type"} {
+			if scalarValue(lookupNode(entry, key)) != scalarValue(lookupNode(sync, key)) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return entry
+		}
+	}
+	return nil
+}
+
+// appendMissingScalars appends the values of the add sequence that aren't in the sequence yet
+func appendMissingScalars(sequence, add *yaml.Node) {
+	if add == nil {
+		return
+	}
+	for _, value := range add.Content {
+		found := false
+		for _, v := range sequence.Content {
+			if scalarValue(v) == scalarValue(value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			sequence.Content = append(sequence.Content, scalarNode(scalarValue(value)))
+		}
+	}
+}
+
+// lookupNode returns the value of the key of a mapping node, including the values
+// merged in with <<, or nil when the key isn't set
+func lookupNode(mapping *yaml.Node, key string) *yaml.Node {
+	mapping = resolveNode(mapping)
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	var merged *yaml.Node
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		k, v := mapping.Content[i], mapping.Content[i+1]
+		switch {
+		case k.Value == key:
+			return resolveNode(v)
+		case k.Value == "<<" && merged == nil:
+			v = resolveNode(v)
+			if v.Kind != yaml.SequenceNode {
+				merged = lookupNode(v, key)
+				continue
+			}
+			for _, m := range v.Content {
+				if merged = lookupNode(m, key); merged != nil {
+					break
+				}
+			}
+		}
+	}
+
+	return merged
+}
+
+// ownNode returns the value of the key of a mapping node that only the mapping uses, so it can
+// be changed without changing other parts of the config: aliased and merged in values are copied
+// to the mapping first, and an empty node of the kind is added when the key isn't set.
+func ownNode(mapping *yaml.Node, key string, kind yaml.Kind) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != key {
+			continue
+		}
+		if mapping.Content[i+1].Kind == yaml.AliasNode {
+			mapping.Content[i+1] = copyNode(resolveNode(mapping.Content[i+1]))
+		}
+		return mapping.Content[i+1]
+	}
+
+	value := lookupNode(mapping, key)
+	if value != nil {
+		value = copyNode(value)
+	} else {
+		value = &yaml.Node{Kind: kind}
+		switch kind {
+		case yaml.MappingNode:
+			value.Tag = "!!map"
+		case yaml.SequenceNode:
+			value.Tag = "!!seq"
+		}
+	}
+	mapping.Content = append(mapping.Content, scalarNode(key), value)
+
+	return value
+}
+
+// copyNode deep copies a node without its anchors, aliases in it are kept
+func copyNode(n *yaml.Node) *yaml.Node {
+	c := *n
+	c.Anchor = ""
+	if n.Kind == yaml.AliasNode {
+		return &c
+	}
+	c.Content = make([]*yaml.Node, len(n.Content))
+	for i, child := range n.Content {
+		c.Content[i] = copyNode(child)
+	}
+	return &c
+}
+
+func clearMergeTags(n *yaml.Node) {
+	if n.Kind == yaml.ScalarNode && n.Tag == "!!merge" {
+		n.Tag = ""
+	}
+	for _, child := range n.Content {
+		clearMergeTags(child)
+	}
+}
+
+func resolveNode(n *yaml.Node) *yaml.Node {
+	for n != nil && n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	return n
+}
+
+func scalarValue(n *yaml.Node) string {
+	if n = resolveNode(n); n == nil {
+		return ""
+	}
+	return n.Value
+}
+
+func scalarNode(value string) *yaml.Node {
+	return &yaml.Node{
+		Kind:  yaml.ScalarNode,
+		Tag:   "!!str",
+		Value: value,
+	}
+}
@@ -0,0 +1,318 @@
+// Package rcdeps finds the pre-release dependencies, like -rc versions and dev
+// branches, left in a product repository before a GA release.
+package rcdeps
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/google/go-github/v39/github"
+	"sigs.k8s.io/yaml"
+)
+
+// Rules configure the files scanned in a repository and how the lines found are reported
+type Rules struct {
+	// Files are the scanned paths, relative to the repository root
+	Files      []string     `json:"files"`
+	Categories []Category   `json:"categories"`
+	Ignore     []IgnoreRule `json:"ignore,omitempty"`
+}
+
+// Category groups the lines matching all of its patterns
+type Category struct {
+	Name  string `json:"name"`
+	Title string `json:"title"`
+	// Files restricts the category to the files matching these path.Match patterns, all files when empty
+	Files    []string `json:"files,omitempty"`
+	Patterns []string `json:"patterns"`
+	// Exclude skips the lines matching any of these patterns, to keep a line out of
+	// a category when another category already reports it
+	Exclude []string `json:"exclude,omitempty"`
+	// Blocking categories must be empty before a GA release
+	Blocking bool `json:"blocking"`
+	// DevBranch marks the categories of references to dev branches, like the KDM and charts branches
+	DevBranch bool `json:"devBranch,omitempty"`
+
+	patterns []*regexp.Regexp
+	excludes []*regexp.Regexp
+}
+
+// IgnoreRule skips the lines matching the pattern in the given files, all files when empty
+type IgnoreRule struct {
+	Files   []string `json:"files,omitempty"`
+	Pattern string   `json:"pattern"`
+
+	pattern *regexp.Regexp
+}
+
+// CategoryResult holds the lines found for a category
+type CategoryResult struct {
+	Name      string `json:"name"`
+	Title     string `json:"title"`
+	Blocking  bool   `json:"blocking"`
+	DevBranch bool   `json:"devBranch,omitempty"`
+	Lines     []Line `json:"lines"`
+}
+
+// Line is a line found in a scanned file
+type Line struct {
+	Line    int    `json:"line"`
+	File    string `json:"file"`
+	Content string `json:"content"`
+}
+
+// Report holds the lines found in a product repository for each category of the rules
+type Report struct {
+	Product string `json:"product,omitempty"`
+	// Source is the git ref or local directory scanned
+	Source     string           `json:"source"`
+	Categories []CategoryResult `json:"categories"`
+}
+
+// LoadRulesFile reads and compiles a YAML rule file
+func LoadRulesFile(file string) (*Rules, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return LoadRules(b)
+}
+
+// LoadRules parses and compiles YAML rules
+func LoadRules(b []byte) (*Rules, error) {
+	var rules Rules
+	if err := yaml.UnmarshalStrict(b, &rules); err != nil {
+		return nil, errors.New("invalid rc-deps rules: " + err.Error())
+	}
+	if err := rules.compile(); err != nil {
+		return nil, errors.New("invalid rc-deps rules: " + err.Error())
+	}
+
+	return &rules, nil
+}
+
+func (r *Rules) compile() error {
+	if len(r.Files) == 0 {
+		return errors.New("no files to scan")
+	}
+	for i, file := range r.Files {
+		r.Files[i] = strings.TrimPrefix(file, "/")
+	}
+
+	for i := range r.Categories {
+		category := &r.Categories[i]
+		if category.Name == "" {
+			return errors.New("category without a name")
+		}
+		if len(category.Patterns) == 0 {
+			return errors.New("category " + category.Name + " has no patterns")
+		}
+		if category.Title == "" {
+			category.Title = category.Name
+		}
+		if err := validateFilePatterns(category.Files); err != nil {
+			return err
+		}
+
+		category.patterns = make([]*regexp.Regexp, 0, len(category.Patterns))
+		for _, pattern := range category.Patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return errors.New("category " + category.Name + ": " + err.Error())
+			}
+			category.patterns = append(category.patterns, re)
+		}
+
+		category.excludes = make([]*regexp.Regexp, 0, len(category.Exclude))
+		for _, pattern := range category.Exclude {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return errors.New("category " + category.Name + ": " + err.Error())
+			}
+			category.excludes = append(category.excludes, re)
+		}
+	}
+
+	for i := range r.Ignore {
+		ignore := &r.Ignore[i]
+		if err := validateFilePatterns(ignore.Files); err != nil {
+			return err
+		}
+
+		re, err := regexp.Compile(ignore.Pattern)
+		if err != nil {
+			return errors.New("ignore: " + err.Error())
+		}
+		ignore.pattern = re
+	}
+
+	return nil
+}
+
+// validateFilePatterns checks the path.Match patterns restricting a rule to some files
+func validateFilePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.New("invalid file pattern " + pattern + ": " + err.Error())
+		}
+	}
+	return nil
+}
+
+// matchesFile reports whether a file matches any of the patterns, or there are none
+func matchesFile(patterns []string, file string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.TrimPrefix(pattern, "/"), file); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Category) matches(file, line string) bool {
+	if !matchesFile(c.Files, file) {
+		return false
+	}
+	for _, re := range c.patterns {
+		if !re.MatchString(line) {
+			return false
+		}
+	}
+	for _, re := range c.excludes {
+		if re.MatchString(line) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Rules) ignored(file, line string) bool {
+	for _, ignore := range r.Ignore {
+		if matchesFile(ignore.Files, file) && ignore.pattern.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// Scan checks the files of the rules, read with the given function, and
+// reports the lines matching each category
+func (r *Rules) Scan(source string, read func(file string) (string, error)) (*Report, error) {
+	deps := Report{
+		Source:     source,
+		Categories: make([]CategoryResult, len(r.Categories)),
+	}
+	for i, category := range r.Categories {
+		deps.Categories[i] = CategoryResult{
+			Name:      category.Name,
+			Title:     category.Title,
+			Blocking:  category.Blocking,
+			DevBranch: category.DevBranch,
+			Lines:     make([]Line, 0),
+		}
+	}
+
+	for _, file := range r.Files {
+		content, err := read(file)
+		if err != nil {
+			return nil, errors.New("failed to read " + file + ": " + err.Error())
+		}
+
+		scanner := bufio.NewScanner(strings.NewReader(content))
+		for lineNum := 1; scanner.Scan(); lineNum++ {
+			line := scanner.Text()
+			if r.ignored(file, line) {
+				continue
+			}
+
+			for i := range r.Categories {
+				if r.Categories[i].matches(file, line) {
+					deps.Categories[i].Lines = append(deps.Categories[i].Lines, Line{
+						File:    file,
+						Line:    lineNum,
+						Content: formatContentLine(line),
+					})
+				}
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &deps, nil
+}
+
+// ScanRemote scans the files of a GitHub repository at the given git ref
+func ScanRemote(ctx context.Context, ghClient *github.Client, owner, repo, gitRef string, rules *Rules) (*Report, error) {
+	return rules.Scan(gitRef, func(file string) (string, error) {
+		content, _, _, err := ghClient.Repositories.GetContents(ctx, owner, repo, file, &github.RepositoryContentGetOptions{Ref: gitRef})
+		if err != nil {
+			return "", err
+		}
+		if content == nil {
+			return "", errors.New(file + " is a directory")
+		}
+
+		return content.GetContent()
+	})
+}
+
+// ScanLocal scans the files of a local checkout
+func ScanLocal(dir string, rules *Rules) (*Report, error) {
+	return rules.Scan(dir, func(file string) (string, error) {
+		b, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(file)))
+		return string(b), err
+	})
+}
+
+// Blocking returns the number of lines found for blocking categories
+func (r *Report) Blocking() int {
+	var count int
+	for _, category := range r.Categories {
+		if category.Blocking {
+			count += len(category.Lines)
+		}
+	}
+	return count
+}
+
+func (r *Report) ToString() (string, error) {
+	tmpl := template.New("release-rc-dev-deps")
+	tmpl = template.Must(tmpl.Parse(rcDepsTemplate))
+	buff := bytes.NewBuffer(nil)
+	err := tmpl.ExecuteTemplate(buff, "componentsFile", r)
+
+	return buff.String(), err
+}
+
+func formatContentLine(line string) string {
+	re := regexp.MustCompile(`\s+`)
+	line = re.ReplaceAllString(line, " ")
+
+	return strings.TrimSpace(line)
+}
+
+const rcDepsTemplate = `{{- define "componentsFile" -}}
+{{- range $i, $category := .Categories}}
+{{- if $i}}
+
+{{end}}
+# {{ $category.Title }}{{ if $category.Blocking }} (blocking){{ end }}
+{{range $category.Lines}}
+* {{ .Content }} ({{ .File }}, line {{ .Line }})
+{{- end}}
+{{- end}}
+{{ end }}`
@@ -0,0 +1,289 @@
+package rcdeps
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var rancherFiles = map[string]string{
+	"Dockerfile.dapper": "FROM registry.suse.com/bci/golang:1.22\n",
+	"go.mod": `module github.com/rancher/rancher
+
+require (
+	github.com/rancher/rke v1.6.2-rc.3
+	github.com/rancher/norman v0.0.0-20240708202514-a0127673d1b9
+	github.com/rancher/wrangler v1.1.2-rc1 // indirect
+)
+`,
+	"package/Dockerfile": `ENV CATTLE_KDM_BRANCH=dev-v2.9
+ENV CATTLE_FLEET_MIN_VERSION=104.0.1+up0.10.1-rc1
+ENV CATTLE_CSP_ADAPTER_MIN_VERSION=104.0.0+up4.0.0
+ENV CATTLE_KDM_BRANCH=dev-v2.9 CATTLE_CHART_DEFAULT_BRANCH=dev-v2.9
+`,
+	"pkg/apis/go.mod":         "module github.com/rancher/rancher/pkg/apis\n",
+	"pkg/settings/setting.go": "\tChartDefaultBranch = NewSetting(\"chart-default-branch\", \"dev-v2.9\")\n",
+	"scripts/package-env":     "SYSTEM_CHART_DEFAULT_BRANCH=${SYSTEM_CHART_DEFAULT_BRANCH:-\"dev-v2.9\"}\n",
+}
+
+func readFiles(files map[string]string) func(file string) (string, error) {
+	return func(file string) (string, error) {
+		content, ok := files[file]
+		if !ok {
+			return "", fs.ErrNotExist
+		}
+		return content, nil
+	}
+}
+
+func TestRancherRules(t *testing.T) {
+	rules, err := Rancher.Rules()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deps, err := rules.Scan("release/v2.9", readFiles(rancherFiles))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]Line{
+		"filesWithRc": {
+			{File: "go.mod", Line: 4, Content: "github.com/rancher/rke v1.6.2-rc.3"},
+			{File: "package/Dockerfile", Line: 2, Content: "ENV CATTLE_FLEET_MIN_VERSION=104.0.1+up0.10.1-rc1"},
+		},
+		"minFilesWithRc": {
+			{File: "package/Dockerfile", Line: 2, Content: "ENV CATTLE_FLEET_MIN_VERSION=104.0.1+up0.10.1-rc1"},
+		},
+		"kdmWithDev": {
+			{File: "package/Dockerfile", Line: 1, Content: "ENV CATTLE_KDM_BRANCH=dev-v2.9"},
+		},
+		"chartsWithDev": {
+			{File: "package/Dockerfile", Line: 4, Content: "ENV CATTLE_KDM_BRANCH=dev-v2.9 CATTLE_CHART_DEFAULT_BRANCH=dev-v2.9"},
+			{File: "pkg/settings/setting.go", Line: 1, Content: `ChartDefaultBranch = NewSetting("chart-default-branch", "dev-v2.9")`},
+			{File: "scripts/package-env", Line: 1, Content: `SYSTEM_CHART_DEFAULT_BRANCH=${SYSTEM_CHART_DEFAULT_BRANCH:-"dev-v2.9"}`},
+		},
+	}
+
+	if len(deps.Categories) != len(expected) {
+		t.Fatalf("Scan() categories = %d, want %d", len(deps.Categories), len(expected))
+	}
+	for _, category := range deps.Categories {
+		if !reflect.DeepEqual(category.Lines, expected[category.Name]) {
+			t.Errorf("Scan() %s = %+v, want %+v", category.Name, category.Lines, expected[category.Name])
+		}
+	}
+	if blocking := deps.Blocking(); blocking != 7 {
+		t.Errorf("Blocking() = %d, want 7", blocking)
+	}
+
+	text, err := deps.ToString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text, "# KDM References with dev branch (blocking)\n\n* ENV CATTLE_KDM_BRANCH=dev-v2.9 (package/Dockerfile, line 1)") {
+		t.Errorf("ToString() = %q, missing the KDM section", text)
+	}
+}
+
+func TestProductRules(t *testing.T) {
+	tests := []struct {
+		product  Product
+		files    map[string]string
+		expected map[string][]Line
+	}{
+		{
+			product: K3s,
+			files: map[string]string{
+				"go.mod":                        "replace (\n\tk8s.io/kubernetes => github.com/k3s-io/kubernetes v1.31.0-rc.1-k3s1\n\tk8s.io/api => github.com/k3s-io/kubernetes/staging/src/k8s.io/api v1.31.0-rc.1-k3s1\n)\n",
+				"scripts/version.sh":            "VERSION_CONTAINERD=\"v1.7.20-k3s1\"\nVERSION_RUNC=\"v1.2.0-rc.2\"\n",
+				"scripts/airgap/image-list.txt": "docker.io/rancher/klipper-helm:v0.9.2-build20240828\n",
+			},
+			expected: map[string][]Line{
+				"goModWithRc": {
+					{File: "go.mod", Line: 2, Content: "k8s.io/kubernetes => github.com/k3s-io/kubernetes v1.31.0-rc.1-k3s1"},
+					{File: "go.mod", Line: 3, Content: "k8s.io/api => github.com/k3s-io/kubernetes/staging/src/k8s.io/api v1.31.0-rc.1-k3s1"},
+				},
+				"versionsWithRc": {
+					{File: "scripts/version.sh", Line: 2, Content: `VERSION_RUNC="v1.2.0-rc.2"`},
+				},
+				"imagesWithRc": {},
+			},
+		},
+		{
+			product: RKE2,
+			files: map[string]string{
+				"go.mod":                     "require github.com/k3s-io/k3s v1.31.0-rc1\n",
+				"Dockerfile":                 "FROM rancher/hardened-kubernetes:v1.31.0-rc1-rke2r1-build20240801 AS kubernetes\n",
+				"Dockerfile.windows":         "ARG SERVERCORE_VERSION\n",
+				"scripts/version.sh":         "KUBERNETES_VERSION=${KUBERNETES_VERSION:-v1.31.0}\n",
+				"charts/chart_versions.yaml": "charts:\n  - version: 3.12.001\n    filename: /charts/rke2-cilium.yaml\n  - version: 1.31.0-rc.100\n    filename: /charts/rke2-coredns.yaml\n",
+			},
+			expected: map[string][]Line{
+				"goModWithRc": {
+					{File: "go.mod", Line: 1, Content: "require github.com/k3s-io/k3s v1.31.0-rc1"},
+				},
+				"imagesWithRc": {
+					{File: "Dockerfile", Line: 1, Content: "FROM rancher/hardened-kubernetes:v1.31.0-rc1-rke2r1-build20240801 AS kubernetes"},
+				},
+				"versionsWithRc": {},
+				"chartsWithRc": {
+					{File: "charts/chart_versions.yaml", Line: 4, Content: "- version: 1.31.0-rc.100"},
+				},
+			},
+		},
+		{
+			product: Dashboard,
+			files: map[string]string{
+				"package.json":       "{\n  \"dependencies\": {\n    \"@rancher/icons\": \"2.0.29\",\n    \"vue\": \"~3.5.0-rc.1\"\n  }\n}\n",
+				"shell/package.json": "{\n  \"version\": \"3.0.0-rc.3\",\n  \"repository\": \"https://github.com/rancher/dashboard/tree/dev-v2.10\"\n}\n",
+			},
+			expected: map[string][]Line{
+				"packagesWithRc": {
+					{File: "package.json", Line: 4, Content: `"vue": "~3.5.0-rc.1"`},
+					{File: "shell/package.json", Line: 2, Content: `"version": "3.0.0-rc.3",`},
+				},
+				"referencesWithDev": {
+					{File: "shell/package.json", Line: 3, Content: `"repository": "https://github.com/rancher/dashboard/tree/dev-v2.10"`},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.product.Name, func(t *testing.T) {
+			rules, err := tt.product.Rules()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			report, err := rules.Scan("main", readFiles(tt.files))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(report.Categories) != len(tt.expected) {
+				t.Fatalf("Scan() categories = %d, want %d", len(report.Categories), len(tt.expected))
+			}
+			for _, category := range report.Categories {
+				expected, ok := tt.expected[category.Name]
+				if !ok {
+					t.Errorf("Scan() unexpected category %s", category.Name)
+					continue
+				}
+				if !reflect.DeepEqual(category.Lines, expected) {
+					t.Errorf("Scan() %s = %+v, want %+v", category.Name, category.Lines, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+		err   bool
+	}{
+		{
+			name:  "valid",
+			rules: "files: [/go.mod]\ncategories:\n  - name: rc\n    patterns: ['-rc']\n",
+		},
+		{
+			name:  "no files",
+			rules: "categories:\n  - name: rc\n    patterns: ['-rc']\n",
+			err:   true,
+		},
+		{
+			name:  "category without patterns",
+			rules: "files: [go.mod]\ncategories:\n  - name: rc\n",
+			err:   true,
+		},
+		{
+			name:  "invalid pattern",
+			rules: "files: [go.mod]\ncategories:\n  - name: rc\n    patterns: ['-rc[']\n",
+			err:   true,
+		},
+		{
+			name:  "invalid exclude pattern",
+			rules: "files: [go.mod]\ncategories:\n  - name: rc\n    patterns: ['-rc']\n    exclude: ['[']\n",
+			err:   true,
+		},
+		{
+			name:  "invalid file pattern",
+			rules: "files: [go.mod]\ncategories:\n  - name: rc\n    files: ['[']\n    patterns: ['-rc']\n",
+			err:   true,
+		},
+		{
+			name:  "unknown field",
+			rules: "files: [go.mod]\ncategory: []\n",
+			err:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := LoadRules([]byte(tt.rules))
+			if (err != nil) != tt.err {
+				t.Fatalf("LoadRules() error = %v, want error %v", err, tt.err)
+			}
+			if err == nil && rules.Files[0] != "go.mod" {
+				t.Errorf("LoadRules() files = %v, want [go.mod]", rules.Files)
+			}
+		})
+	}
+}
+
+func TestScanLocal(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(rancherFiles["go.mod"]), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := LoadRules([]byte(`files: [go.mod]
+ignore:
+  - files: [go.mod]
+    pattern: norman
+categories:
+  - name: rc
+    patterns: ['-rc']
+    blocking: true
+  - name: pseudoVersions
+    patterns: ['v0\.0\.0-']
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deps, err := ScanLocal(dir, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []CategoryResult{
+		{
+			Name:     "rc",
+			Title:    "rc",
+			Blocking: true,
+			Lines: []Line{
+				{File: "go.mod", Line: 4, Content: "github.com/rancher/rke v1.6.2-rc.3"},
+				{File: "go.mod", Line: 6, Content: "github.com/rancher/wrangler v1.1.2-rc1 // indirect"},
+			},
+		},
+		{Name: "pseudoVersions", Title: "pseudoVersions", Lines: []Line{}},
+	}
+	if !reflect.DeepEqual(deps.Categories, expected) {
+		t.Errorf("ScanLocal() = %+v, want %+v", deps.Categories, expected)
+	}
+	if deps.Source != dir {
+		t.Errorf("ScanLocal() source = %s, want %s", deps.Source, dir)
+	}
+
+	rules.Files = append(rules.Files, "package/Dockerfile")
+	if _, err := ScanLocal(dir, rules); err == nil {
+		t.Error("ScanLocal() expected an error for a missing file")
+	}
+}
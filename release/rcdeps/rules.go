@@ -0,0 +1,162 @@
+package rcdeps
+
+import "errors"
+
+// Product is a repository checked for pre-release dependencies before a GA release
+type Product struct {
+	Name  string
+	Owner string
+	Repo  string
+
+	rules string
+}
+
+var (
+	Rancher = Product{
+		Name:  "rancher",
+		Owner: "rancher",
+		Repo:  "rancher",
+		rules: rancherRules,
+	}
+	K3s = Product{
+		Name:  "k3s",
+		Owner: "k3s-io",
+		Repo:  "k3s",
+		rules: k3sRules,
+	}
+	RKE2 = Product{
+		Name:  "rke2",
+		Owner: "rancher",
+		Repo:  "rke2",
+		rules: rke2Rules,
+	}
+	Dashboard = Product{
+		Name:  "dashboard",
+		Owner: "rancher",
+		Repo:  "dashboard",
+		rules: dashboardRules,
+	}
+
+	// Products are the products with a rule set, by name
+	Products = map[string]Product{
+		Rancher.Name:   Rancher,
+		K3s.Name:       K3s,
+		RKE2.Name:      RKE2,
+		Dashboard.Name: Dashboard,
+	}
+)
+
+// ProductByName returns the product with the given name
+func ProductByName(name string) (Product, error) {
+	product, ok := Products[name]
+	if !ok {
+		return Product{}, errors.New("no rc-deps rules for product: " + name)
+	}
+	return product, nil
+}
+
+// Rules returns the default rule set of the product
+func (p Product) Rules() (*Rules, error) {
+	return LoadRules([]byte(p.rules))
+}
+
+const rancherRules = `files:
+  - Dockerfile.dapper
+  - go.mod
+  - package/Dockerfile
+  - pkg/apis/go.mod
+  - pkg/settings/setting.go
+  - scripts/package-env
+ignore:
+  - pattern: indirect
+categories:
+  - name: filesWithRc
+    title: Components with -rc
+    patterns: ['-rc\.?[0-9]+']
+    blocking: true
+  - name: minFilesWithRc
+    title: Min version components with -rc
+    files: [package/Dockerfile]
+    patterns: ['CATTLE_(\S+)_MIN_VERSION', '-rc']
+    blocking: true
+  - name: kdmWithDev
+    title: KDM References with dev branch
+    patterns: ['dev-v[0-9]+\.[0-9]+', '(?i)kdm']
+    exclude: ['(?i)chart']
+    blocking: true
+    devBranch: true
+  - name: chartsWithDev
+    title: Chart References with dev branch
+    patterns: ['dev-v[0-9]+\.[0-9]+', '(?i)chart']
+    blocking: true
+    devBranch: true
+`
+
+const k3sRules = `files:
+  - go.mod
+  - scripts/version.sh
+  - scripts/airgap/image-list.txt
+ignore:
+  - pattern: indirect
+categories:
+  - name: goModWithRc
+    title: Go modules with -rc
+    files: [go.mod]
+    patterns: ['-rc\.?[0-9]+']
+    blocking: true
+  - name: versionsWithRc
+    title: Component versions with -rc
+    files: [scripts/version.sh]
+    patterns: ['^\s*VERSION_\w+=', '-rc\.?[0-9]+']
+    blocking: true
+  - name: imagesWithRc
+    title: Images with -rc
+    files: [scripts/airgap/image-list.txt]
+    patterns: ['-rc\.?[0-9]+']
+    blocking: true
+`
+
+const rke2Rules = `files:
+  - go.mod
+  - Dockerfile
+  - Dockerfile.windows
+  - scripts/version.sh
+  - charts/chart_versions.yaml
+ignore:
+  - pattern: indirect
+categories:
+  - name: goModWithRc
+    title: Go modules with -rc
+    files: [go.mod]
+    patterns: ['-rc\.?[0-9]+']
+    blocking: true
+  - name: imagesWithRc
+    title: Hardened images with -rc
+    files: [Dockerfile*]
+    patterns: ['-rc\.?[0-9]+']
+    blocking: true
+  - name: versionsWithRc
+    title: Component versions with -rc
+    files: [scripts/version.sh]
+    patterns: ['-rc\.?[0-9]+']
+    blocking: true
+  - name: chartsWithRc
+    title: Charts with pre-release versions
+    files: [charts/chart_versions.yaml]
+    patterns: ['version:\s*\S*-(rc|alpha|beta)']
+    blocking: true
+`
+
+const dashboardRules = `files:
+  - package.json
+  - shell/package.json
+categories:
+  - name: packagesWithRc
+    title: Packages with pre-release versions
+    patterns: ['"[^"]+":\s*"[~^]?[0-9][^"]*-(rc|alpha)[^"]*"']
+    blocking: true
+  - name: referencesWithDev
+    title: References to dev branches
+    patterns: ['dev-v[0-9]+\.[0-9]+']
+    blocking: true
+`
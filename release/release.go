@@ -28,6 +28,7 @@ import (
 const (
 	k3sRepo                = "k3s"
 	rke2Repo               = "rke2"
+	rke2PackagingRepo      = "rke2-packaging"
 	uiRepo                 = "ui"
 	dashboardRepo          = "dashboard"
 	cliRepo                = "cli"
@@ -418,57 +419,6 @@ func KubernetesGoVersion(ctx context.Context, client *github.Client, version str
 	return strings.Trim(goVersion, "\n"), nil
 }
 
-// VerifyAssets checks the number of assets for the
-// given release and indicates if the expected number has
-// been met.
-func VerifyAssets(ctx context.Context, client *github.Client, owner, repo string, tags []string) (map[string]bool, error) {
-	if len(tags) == 0 {
-		return nil, errors.New("no tags provided")
-	}
-
-	releases := make(map[string]bool, len(tags))
-
-	const (
-		rke2Assets    = 50
-		k3sAssets     = 23
-		rke2Packaging = 23
-	)
-
-	for _, tag := range tags {
-		if tag == "" {
-			continue
-		}
-
-		release, _, err := client.Repositories.GetReleaseByTag(ctx, owner, repo, tag)
-		if err != nil {
-			switch err := err.(type) {
-			case *github.ErrorResponse:
-				if err.Response.StatusCode != http.StatusNotFound {
-					return nil, err
-				}
-				releases[tag] = false
-				continue
-			default:
-				return nil, err
-			}
-		}
-
-		if repo == rke2Repo && len(release.Assets) == rke2Assets {
-			releases[tag] = true
-		}
-
-		if repo == k3sRepo && len(release.Assets) == k3sAssets {
-			releases[tag] = true
-		}
-
-		if repo == "rke2-packing" && len(release.Assets) == rke2Packaging {
-			releases[tag] = true
-		}
-	}
-
-	return releases, nil
-}
-
 // ListAssets gets all assets associated with the given release.
 func ListAssets(ctx context.Context, client *github.Client, owner, repo, tag string) ([]*github.ReleaseAsset, error) {
 	if tag == "" {
@@ -0,0 +1,151 @@
+package rke2
+
+import (
+	"errors"
+	"io/fs"
+	"sort"
+
+	"github.com/rancher/ecm-distro-tools/release/product"
+)
+
+// Change is how an image changed between two releases
+type Change string
+
+const (
+	ChangeAdded   Change = "added"
+	ChangeRemoved Change = "removed"
+	ChangeBumped  Change = "bumped"
+)
+
+// ImageChange is a change of an image repository between two releases, for the
+// platforms it applies to
+type ImageChange struct {
+	Repository string                 `json:"repository"`
+	Change     Change                 `json:"change"`
+	OldTag     string                 `json:"oldTag,omitempty"`
+	NewTag     string                 `json:"newTag,omitempty"`
+	Platforms  []product.Architecture `json:"platforms"`
+}
+
+// DiffImages compares the image lists of two releases of a product. Images are
+// paired by repository on each platform, a repository with a single tag in both
+// releases is bumped when the tag differs, otherwise its tags are added or removed.
+// Identical changes on several platforms are reported once.
+func DiffImages(p product.Product, oldFS, newFS fs.FS) ([]ImageChange, error) {
+	oldImages, err := platformImages(p, oldFS)
+	if err != nil {
+		return nil, errors.New("old release: " + err.Error())
+	}
+	newImages, err := platformImages(p, newFS)
+	if err != nil {
+		return nil, errors.New("new release: " + err.Error())
+	}
+
+	changes := make(map[string]*ImageChange)
+	var keys []string
+	addChange := func(platform product.Architecture, change ImageChange) {
+		key := change.Repository + " " + string(change.Change) + " " + change.OldTag + " " + change.NewTag
+		existing, ok := changes[key]
+		if !ok {
+			existing = &change
+			changes[key] = existing
+			keys = append(keys, key)
+		}
+		existing.Platforms = append(existing.Platforms, platform)
+	}
+
+	for _, platform := range []product.Architecture{product.LinuxAmd64, product.LinuxArm64, product.WindowsAmd64} {
+		oldRepos, newRepos := oldImages[platform], newImages[platform]
+
+		repos := make(map[string]bool)
+		for repo := range oldRepos {
+			repos[repo] = true
+		}
+		for repo := range newRepos {
+			repos[repo] = true
+		}
+
+		for repo := range repos {
+			removed := subtractTags(oldRepos[repo], newRepos[repo])
+			added := subtractTags(newRepos[repo], oldRepos[repo])
+
+			if len(removed) == 1 && len(added) == 1 {
+				addChange(platform, ImageChange{Repository: repo, Change: ChangeBumped, OldTag: removed[0], NewTag: added[0]})
+				continue
+			}
+			for _, tag := range removed {
+				addChange(platform, ImageChange{Repository: repo, Change: ChangeRemoved, OldTag: tag})
+			}
+			for _, tag := range added {
+				addChange(platform, ImageChange{Repository: repo, Change: ChangeAdded, NewTag: tag})
+			}
+		}
+	}
+
+	result := make([]ImageChange, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, *changes[key])
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Repository != result[j].Repository {
+			return result[i].Repository < result[j].Repository
+		}
+		if result[i].Change != result[j].Change {
+			return result[i].Change < result[j].Change
+		}
+		if result[i].OldTag != result[j].OldTag {
+			return result[i].OldTag < result[j].OldTag
+		}
+		return result[i].NewTag < result[j].NewTag
+	})
+
+	return result, nil
+}
+
+// platformImages reads the image lists of a release, returning the tags of each repository per platform
+func platformImages(p product.Product, fsys fs.FS) (map[product.Architecture]map[string]map[string]bool, error) {
+	images := make(map[product.Architecture]map[string]map[string]bool)
+	found := false
+	for _, list := range p.ImageLists {
+		listed, err := product.ReadImageList(fsys, list.Filename)
+		if err != nil {
+			if list.Optional && errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		found = true
+
+		for _, image := range listed {
+			repo := image.Reference.Context().RepositoryStr()
+
+			for _, platform := range list.Platforms {
+				if images[platform] == nil {
+					images[platform] = make(map[string]map[string]bool)
+				}
+				if images[platform][repo] == nil {
+					images[platform][repo] = make(map[string]bool)
+				}
+				images[platform][repo][image.Reference.Identifier()] = true
+			}
+		}
+	}
+	if !found {
+		return nil, errors.New("no image lists found")
+	}
+
+	return images, nil
+}
+
+// subtractTags returns the sorted tags in a that aren't in b
+func subtractTags(a, b map[string]bool) []string {
+	var tags []string
+	for tag := range a {
+		if !b[tag] {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+
+	return tags
+}
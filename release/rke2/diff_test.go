@@ -0,0 +1,62 @@
+package rke2
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/rancher/ecm-distro-tools/release/product"
+)
+
+func TestDiffImages(t *testing.T) {
+	oldFS := fstest.MapFS{
+		"rke2-images-all.linux-amd64.txt": &fstest.MapFile{
+			Data: []byte("docker.io/rancher/rke2-runtime:v1.30.3-rke2r1\ndocker.io/rancher/hardened-etcd:v3.5.13-k3s1-build20240531\ndocker.io/rancher/mirrored-pause:3.6\ndocker.io/rancher/klipper-helm:v0.8.4-build20240523"),
+		},
+		"rke2-images-all.linux-arm64.txt": &fstest.MapFile{
+			Data: []byte("docker.io/rancher/rke2-runtime:v1.30.3-rke2r1\ndocker.io/rancher/hardened-etcd:v3.5.13-k3s1-build20240531\ndocker.io/rancher/mirrored-pause:3.6"),
+		},
+		"rke2-images.windows-amd64.txt": &fstest.MapFile{
+			Data: []byte("docker.io/rancher/rke2-runtime:v1.30.3-rke2r1-windows-amd64"),
+		},
+	}
+	newFS := fstest.MapFS{
+		"rke2-images-all.linux-amd64.txt": &fstest.MapFile{
+			Data: []byte("docker.io/rancher/rke2-runtime:v1.30.4-rke2r1\ndocker.io/rancher/hardened-etcd:v3.5.13-k3s1-build20240531\ndocker.io/rancher/mirrored-pause:3.6\ndocker.io/rancher/hardened-dns-node-cache:1.23.1-build20240813"),
+		},
+		"rke2-images-all.linux-arm64.txt": &fstest.MapFile{
+			Data: []byte("docker.io/rancher/rke2-runtime:v1.30.4-rke2r1\ndocker.io/rancher/hardened-etcd:v3.5.13-k3s1-build20240531\ndocker.io/rancher/mirrored-pause:3.6"),
+		},
+		"rke2-images.windows-amd64.txt": &fstest.MapFile{
+			Data: []byte("docker.io/rancher/rke2-runtime:v1.30.4-rke2r1-windows-amd64"),
+		},
+	}
+
+	changes, err := DiffImages(product.RKE2, oldFS, newFS)
+	if err != nil {
+		t.Fatalf("DiffImages() error = %v", err)
+	}
+
+	expected := []ImageChange{
+		{Repository: "rancher/hardened-dns-node-cache", Change: ChangeAdded, NewTag: "1.23.1-build20240813", Platforms: []product.Architecture{product.LinuxAmd64}},
+		{Repository: "rancher/klipper-helm", Change: ChangeRemoved, OldTag: "v0.8.4-build20240523", Platforms: []product.Architecture{product.LinuxAmd64}},
+		{Repository: "rancher/rke2-runtime", Change: ChangeBumped, OldTag: "v1.30.3-rke2r1", NewTag: "v1.30.4-rke2r1", Platforms: []product.Architecture{product.LinuxAmd64, product.LinuxArm64}},
+		{Repository: "rancher/rke2-runtime", Change: ChangeBumped, OldTag: "v1.30.3-rke2r1-windows-amd64", NewTag: "v1.30.4-rke2r1-windows-amd64", Platforms: []product.Architecture{product.WindowsAmd64}},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("DiffImages() = %+v, want %+v", changes, expected)
+	}
+
+	if _, err := DiffImages(product.RKE2, fstest.MapFS{}, newFS); err == nil {
+		t.Error("DiffImages() expected an error for a release without image lists")
+	}
+
+	invalidFS := fstest.MapFS{
+		"rke2-images-all.linux-amd64.txt": &fstest.MapFile{Data: []byte("docker.io/rancher/rke2-runtime:v1.30.4-rke2r1\ndocker.io/rancher/Invalid:v1\n")},
+	}
+	_, err = DiffImages(product.RKE2, invalidFS, newFS)
+	if err == nil || !strings.Contains(err.Error(), "rke2-images-all.linux-amd64.txt:2") {
+		t.Errorf("DiffImages() error = %v, want an error naming the file and line of the invalid image", err)
+	}
+}
@@ -3,13 +3,19 @@ package rke2
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"io/fs"
-	"strings"
+	"net"
+	"net/http"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
 	reg "github.com/rancher/ecm-distro-tools/registry"
+	"github.com/rancher/ecm-distro-tools/release/product"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -18,17 +24,12 @@ type RegistryClient interface {
 	Image(ctx context.Context, ref name.Reference) (reg.Image, error)
 }
 
-type Architecture string
-
-const (
-	LinuxAmd64   Architecture = "linux/amd64"
-	LinuxArm64   Architecture = "linux/arm64"
-	WindowsAmd64 Architecture = "windows/amd64"
-
-	ListLinuxAmd64   = "rke2-images-all.linux-amd64.txt"
-	ListLinuxArm64   = "rke2-images-all.linux-arm64.txt"
-	ListWindowsAmd64 = "rke2-images.windows-amd64.txt"
-)
+// WindowsOSVersions are the Windows Server builds every Windows image must be
+// published for, in every release
+var WindowsOSVersions = []string{
+	"10.0.17763", // ltsc2019
+	"10.0.20348", // ltsc2022
+}
 
 // ReleaseImage is an image listed in the images file for one or more platforms of a given RKE2 release
 type ReleaseImage struct {
@@ -38,32 +39,161 @@ type ReleaseImage struct {
 	ExpectsWindows    bool
 }
 
+// RequiredPlatforms returns the platforms the image must be published for,
+// including one Windows platform per supported OS build
+func (i ReleaseImage) RequiredPlatforms() []reg.Platform {
+	var platforms []reg.Platform
+	if i.ExpectsLinuxAmd64 {
+		platforms = append(platforms, reg.Platform{OS: "linux", Architecture: "amd64"})
+	}
+	if i.ExpectsLinuxArm64 {
+		platforms = append(platforms, reg.Platform{OS: "linux", Architecture: "arm64"})
+	}
+	if i.ExpectsWindows {
+		for _, osVersion := range WindowsOSVersions {
+			platforms = append(platforms, reg.Platform{OS: "windows", Architecture: "amd64", OSVersion: osVersion})
+		}
+	}
+
+	return platforms
+}
+
 // Image contains the manifest info of an image in the oss and prime registries
 type Image struct {
 	ReleaseImage
 	OSSImage   reg.Image
 	PrimeImage reg.Image
+	// PrimeChecked is set when the image was looked up in a Prime registry
+	PrimeChecked bool
+	// Err is set when the image couldn't be inspected in one of the registries
+	Err error
 }
 
+// Status is the state of the copies of an image in the OSS and Prime registries
+type Status string
+
+const (
+	// StatusOK means both registries hold the same image
+	StatusOK Status = "ok"
+	// StatusMissing means the image is in neither registry
+	StatusMissing Status = "missing"
+	// StatusOSSOnly means the image hasn't been copied to Prime
+	StatusOSSOnly Status = "oss-only"
+	// StatusPrimeNotChecked means the image is in the OSS registry and no Prime registry was inspected
+	StatusPrimeNotChecked Status = "prime-not-checked"
+	// StatusPrimeOnly means the image is only in Prime
+	StatusPrimeOnly Status = "prime-only"
+	// StatusMismatch means a platform manifest differs between the registries
+	StatusMismatch Status = "digest-mismatch"
+	// StatusStale means Prime holds an older copy, missing platforms since added to the OSS image
+	StatusStale Status = "stale"
+	// StatusError means the image couldn't be inspected, see Image.Err
+	StatusError Status = "error"
+)
+
+// Status compares the OSS and Prime copies of the image down to the platform manifest digests
+func (i Image) Status() Status {
+	switch {
+	case i.Err != nil:
+		return StatusError
+	case !i.OSSImage.Exists && !i.PrimeImage.Exists:
+		return StatusMissing
+	case !i.PrimeChecked:
+		return StatusPrimeNotChecked
+	case !i.OSSImage.Exists:
+		return StatusPrimeOnly
+	case !i.PrimeImage.Exists:
+		return StatusOSSOnly
+	case i.OSSImage.Digest == i.PrimeImage.Digest:
+		return StatusOK
+	}
+
+	stale := false
+	for platform, ossDigest := range i.OSSImage.Digests {
+		// attestation manifests stored in the index don't have a platform
+		if platform.OS == "unknown" {
+			continue
+		}
+
+		primeDigest, ok := i.PrimeImage.Digests[platform]
+		if !ok {
+			stale = true
+			continue
+		}
+		if primeDigest != ossDigest {
+			return StatusMismatch
+		}
+	}
+	if stale {
+		return StatusStale
+	}
+
+	// the indexes differ but every platform manifest is identical
+	return StatusOK
+}
+
+// MissingPlatforms returns the required platforms missing from the OSS image,
+// or from the Prime image when it exists. Images missing from Prime entirely
+// are reported by Status instead.
+func (i Image) MissingPlatforms() []reg.Platform {
+	var missing []reg.Platform
+	for _, platform := range i.RequiredPlatforms() {
+		if !i.OSSImage.HasPlatform(platform) || (i.PrimeImage.Exists && !i.PrimeImage.HasPlatform(platform)) {
+			missing = append(missing, platform)
+		}
+	}
+
+	return missing
+}
+
+const (
+	// DefaultConcurrencyLimit is the number of images inspected at once
+	DefaultConcurrencyLimit = 10
+	// DefaultRetries is the number of times transient registry errors are retried
+	DefaultRetries = 3
+	// DefaultRetryBackoff is the wait before the first retry, doubled on every attempt
+	DefaultRetryBackoff = time.Second
+)
+
 type ReleaseInspector struct {
-	assets fs.FS
-	oss    RegistryClient
-	prime  RegistryClient
-	debug  bool
+	product product.Product
+	assets  fs.FS
+	oss     RegistryClient
+	prime   RegistryClient
+	debug   bool
+
+	// ConcurrencyLimit is the number of images inspected at once
+	ConcurrencyLimit int
+	// Retries is the number of times transient registry errors are retried
+	Retries int
+	// RetryBackoff is the wait before the first retry
+	RetryBackoff time.Duration
+	// Progress receives the inspection progress when set
+	Progress io.Writer
 }
 
+// NewReleaseInspector creates an inspector for RKE2 releases
 func NewReleaseInspector(fs fs.FS, oss, prime RegistryClient, debug bool) *ReleaseInspector {
+	return NewProductReleaseInspector(product.RKE2, fs, oss, prime, debug)
+}
+
+// NewProductReleaseInspector creates an inspector for the releases of the given product
+func NewProductReleaseInspector(p product.Product, fs fs.FS, oss, prime RegistryClient, debug bool) *ReleaseInspector {
 	return &ReleaseInspector{
-		assets: fs,
-		oss:    oss,
-		prime:  prime,
-		debug:  debug,
+		product:          p,
+		assets:           fs,
+		oss:              oss,
+		prime:            prime,
+		debug:            debug,
+		ConcurrencyLimit: DefaultConcurrencyLimit,
+		Retries:          DefaultRetries,
+		RetryBackoff:     DefaultRetryBackoff,
 	}
 }
 
 func (r *ReleaseInspector) InspectRelease(ctx context.Context, version string) ([]Image, error) {
-	if !strings.Contains(version, "+rke2") {
-		return nil, errors.New("only RKE2 releases are currently supported")
+	if !r.product.Matches(version) {
+		return nil, errors.New("expected a " + r.product.Name + " release version, received " + version)
 	}
 
 	requiredImages, err := r.imageMap()
@@ -74,30 +204,46 @@ func (r *ReleaseInspector) InspectRelease(ctx context.Context, version string) (
 	return r.checkImages(ctx, requiredImages)
 }
 
+// ReleaseImages returns the images listed in the release image lists, sorted by name
+func (r *ReleaseInspector) ReleaseImages() ([]ReleaseImage, error) {
+	imageMap, err := r.imageMap()
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]ReleaseImage, 0, len(imageMap))
+	for _, image := range imageMap {
+		images = append(images, image)
+	}
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].Reference.Name() < images[j].Reference.Name()
+	})
+
+	return images, nil
+}
+
 // imageMap reads per-platform image list files and coalesces them
 // into one map to collect images for all platforms.
 func (r *ReleaseInspector) imageMap() (map[string]ReleaseImage, error) {
 	// download image lists for release
-	var (
-		amd64Images []string
-		arm64Images []string
-		winImages   []string
-	)
+	lists := make([][]product.ListedImage, len(r.product.ImageLists))
 
 	g := new(errgroup.Group)
 
-	g.Go(func() (err error) {
-		amd64Images, err = r.readImageList(ListLinuxAmd64)
-		return err
-	})
-	g.Go(func() (err error) {
-		arm64Images, err = r.readImageList(ListLinuxArm64)
-		return err
-	})
-	g.Go(func() (err error) {
-		winImages, err = r.readImageList(ListWindowsAmd64)
-		return
-	})
+	for i, list := range r.product.ImageLists {
+		i, list := i, list
+		g.Go(func() error {
+			images, err := product.ReadImageList(r.assets, list.Filename)
+			if err != nil {
+				if list.Optional && errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			lists[i] = images
+			return nil
+		})
+	}
 
 	if err := g.Wait(); err != nil {
 		return nil, err
@@ -105,33 +251,22 @@ func (r *ReleaseInspector) imageMap() (map[string]ReleaseImage, error) {
 
 	// merge all images into a map
 	imageMap := make(map[string]ReleaseImage)
-	for _, imagePair := range [][2]interface{}{
-		{amd64Images, LinuxAmd64},
-		{arm64Images, LinuxArm64},
-		{winImages, WindowsAmd64},
-	} {
-		images, arch := imagePair[0].([]string), imagePair[1].(Architecture)
-		for _, image := range images {
-			if image == "" {
-				continue
-			}
-
-			ref, err := name.ParseReference(image)
-			if err != nil {
-				continue
-			}
-
+	for i, list := range r.product.ImageLists {
+		for _, image := range lists[i] {
+			ref := image.Reference
 			key := ref.Context().RepositoryStr() + ":" + ref.Identifier()
 			info := imageMap[key]
 			info.Reference = ref
 
-			switch arch {
-			case LinuxAmd64:
-				info.ExpectsLinuxAmd64 = true
-			case LinuxArm64:
-				info.ExpectsLinuxArm64 = true
-			case WindowsAmd64:
-				info.ExpectsWindows = true
+			for _, arch := range list.Platforms {
+				switch arch {
+				case product.LinuxAmd64:
+					info.ExpectsLinuxAmd64 = true
+				case product.LinuxArm64:
+					info.ExpectsLinuxArm64 = true
+				case product.WindowsAmd64:
+					info.ExpectsWindows = true
+				}
 			}
 
 			imageMap[key] = info
@@ -141,62 +276,99 @@ func (r *ReleaseInspector) imageMap() (map[string]ReleaseImage, error) {
 	return imageMap, nil
 }
 
-// readImageList reads an image list file and returns its contents
-func (r *ReleaseInspector) readImageList(filename string) ([]string, error) {
-	file, err := r.assets.Open(filename)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	content, err := io.ReadAll(file)
-	if err != nil {
-		return nil, err
-	}
-
-	return strings.Split(strings.TrimSpace(string(content)), "\n"), nil
-}
-
 // checkImages checks if the required images exist in the OSS and Prime registries
 func (r *ReleaseInspector) checkImages(ctx context.Context, requiredImages map[string]ReleaseImage) ([]Image, error) {
-	resultChan := make(chan Image, len(requiredImages))
-	var wg sync.WaitGroup
+	results := make([]Image, 0, len(requiredImages))
+	var mu sync.Mutex
+
+	g := new(errgroup.Group)
+	limit := r.ConcurrencyLimit
+	if limit <= 0 {
+		limit = DefaultConcurrencyLimit
+	}
+	g.SetLimit(limit)
 
 	for _, required := range requiredImages {
-		wg.Add(1)
-		go func(img ReleaseImage) {
-			defer wg.Done()
+		img := required
+		g.Go(func() error {
+			result := Image{ReleaseImage: img}
 
-			ossImage, err := r.oss.Image(ctx, img.Reference)
+			var errs []error
+			ossImage, err := r.image(ctx, r.oss, img.Reference)
 			if err != nil {
-				ossImage = reg.Image{
-					Exists:    false,
-					Platforms: make(map[reg.Platform]bool),
-				}
+				errs = append(errs, errors.New("oss: "+err.Error()))
 			}
+			result.OSSImage = ossImage
 
-			var primeImage reg.Image
 			if r.prime != nil {
-				primeImage, _ = r.prime.Image(ctx, img.Reference)
+				primeImage, err := r.image(ctx, r.prime, img.Reference)
+				if err != nil {
+					errs = append(errs, errors.New("prime: "+err.Error()))
+				}
+				result.PrimeImage = primeImage
+				result.PrimeChecked = true
 			}
+			result.Err = errors.Join(errs...)
 
-			resultChan <- Image{
-				ReleaseImage: img,
-				OSSImage:     ossImage,
-				PrimeImage:   primeImage,
+			mu.Lock()
+			defer mu.Unlock()
+
+			results = append(results, result)
+			if r.Progress != nil {
+				fmt.Fprintf(r.Progress, "\rinspected %d/%d images", len(results), len(requiredImages))
+				if len(results) == len(requiredImages) {
+					fmt.Fprintln(r.Progress)
+				}
 			}
-		}(required)
-	}
 
-	go func() {
-		wg.Wait()
-		close(resultChan)
-	}()
+			return nil
+		})
+	}
 
-	var results []Image
-	for img := range resultChan {
-		results = append(results, img)
+	if err := g.Wait(); err != nil {
+		return nil, err
 	}
 
 	return results, nil
 }
+
+// image gets an image from the registry, retrying transient errors with an
+// exponential backoff
+func (r *ReleaseInspector) image(ctx context.Context, client RegistryClient, ref name.Reference) (reg.Image, error) {
+	backoff := r.RetryBackoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		var image reg.Image
+		image, err = client.Image(ctx, ref)
+		if err == nil {
+			return image, nil
+		}
+		if attempt >= r.Retries || !isTransient(err) {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return reg.Image{Platforms: make(map[reg.Platform]bool)}, ctx.Err()
+		case <-time.After(backoff << attempt):
+		}
+	}
+
+	return reg.Image{Platforms: make(map[reg.Platform]bool)}, err
+}
+
+// isTransient reports whether a registry error is worth retrying: rate limits,
+// server errors and network timeouts.
+func isTransient(err error) bool {
+	var transportErr *transport.Error
+	if errors.As(err, &transportErr) {
+		return transportErr.StatusCode == http.StatusTooManyRequests || transportErr.StatusCode >= http.StatusInternalServerError
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
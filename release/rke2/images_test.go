@@ -1,21 +1,32 @@
 package rke2
 
 import (
+	"context"
 	"io/fs"
+	"net/http"
+	"os"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"testing/fstest"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	reg "github.com/rancher/ecm-distro-tools/registry"
+	"github.com/rancher/ecm-distro-tools/release/product"
 )
 
 func newMockFS() fs.FS {
 	return fstest.MapFS{
-		ListLinuxAmd64: &fstest.MapFile{
+		"rke2-images-all.linux-amd64.txt": &fstest.MapFile{
 			Data: []byte("rancher/rke2-runtime:v1.23.4-rke2r1\nrancher/rke2-cloud-provider:v1.23.4-rke2r1"),
 		},
-		ListLinuxArm64: &fstest.MapFile{
+		"rke2-images-all.linux-arm64.txt": &fstest.MapFile{
 			Data: []byte("rancher/rke2-runtime:v1.23.4-rke2r1"),
 		},
-		ListWindowsAmd64: &fstest.MapFile{
+		"rke2-images.windows-amd64.txt": &fstest.MapFile{
 			Data: []byte("rancher/rke2-runtime-windows:v1.23.4-rke2r1"),
 		},
 	}
@@ -70,41 +81,357 @@ func TestImageMap(t *testing.T) {
 	}
 }
 
-func TestReadImageList(t *testing.T) {
+func TestImageMapFromDir(t *testing.T) {
+	inspector := NewReleaseInspector(os.DirFS("testdata/assets"), nil, nil, false)
+
+	imageMap, err := inspector.imageMap()
+	if err != nil {
+		t.Fatalf("imageMap() error = %v", err)
+	}
+
+	if len(imageMap) != 3 {
+		t.Fatalf("imageMap() returned %d images, want 3", len(imageMap))
+	}
+
+	runtime, ok := imageMap["rancher/rke2-runtime:v1.30.4-rke2r1"]
+	if !ok {
+		t.Fatal("imageMap() missing rancher/rke2-runtime:v1.30.4-rke2r1")
+	}
+	if !runtime.ExpectsLinuxAmd64 || !runtime.ExpectsLinuxArm64 || runtime.ExpectsWindows {
+		t.Errorf("unexpected platforms for rancher/rke2-runtime: %+v", runtime)
+	}
+}
+
+func TestImageMapInvalidLine(t *testing.T) {
+	fsys := fstest.MapFS{
+		"rke2-images-all.linux-amd64.txt": {Data: []byte("rancher/rke2-runtime:v1.23.4-rke2r1\n\nrancher/rke2-runtime:INVALID TAG\n")},
+		"rke2-images-all.linux-arm64.txt": {Data: []byte("rancher/rke2-runtime:v1.23.4-rke2r1\n")},
+		"rke2-images.windows-amd64.txt":   {Data: []byte("rancher/rke2-runtime-windows:v1.23.4-rke2r1\n")},
+	}
+	inspector := NewReleaseInspector(fsys, nil, nil, false)
+
+	_, err := inspector.imageMap()
+	if err == nil {
+		t.Fatal("imageMap() error = nil, want invalid image error")
+	}
+	if !strings.HasPrefix(err.Error(), "rke2-images-all.linux-amd64.txt:3: invalid image rancher/rke2-runtime:INVALID TAG") {
+		t.Errorf("imageMap() error = %v, want the list name and line number", err)
+	}
+}
+
+func TestImageMapProducts(t *testing.T) {
 	tests := []struct {
 		name     string
-		filename string
-		want     []string
+		product  product.Product
+		fsys     fs.FS
+		image    string
+		expected ReleaseImage
 		wantErr  bool
 	}{
 		{
-			name:     "read rke2-images-all.linux-amd64.txt",
-			filename: "rke2-images-all.linux-amd64.txt",
-			want:     []string{"rancher/rke2-runtime:v1.23.4-rke2r1", "rancher/rke2-cloud-provider:v1.23.4-rke2r1"},
+			name:    "k3s",
+			product: product.K3s,
+			fsys: fstest.MapFS{
+				"k3s-images.txt": {Data: []byte("docker.io/rancher/mirrored-pause:3.6\n")},
+			},
+			image:    "rancher/mirrored-pause:3.6",
+			expected: ReleaseImage{ExpectsLinuxAmd64: true, ExpectsLinuxArm64: true},
+		},
+		{
+			name:    "rancher with windows images",
+			product: product.Rancher,
+			fsys: fstest.MapFS{
+				"rancher-images.txt":         {Data: []byte("rancher/rancher-agent:v2.9.1\nrancher/mirrored-pause:3.6\n")},
+				"rancher-windows-images.txt": {Data: []byte("rancher/mirrored-pause:3.6\n")},
+			},
+			image:    "rancher/mirrored-pause:3.6",
+			expected: ReleaseImage{ExpectsLinuxAmd64: true, ExpectsLinuxArm64: true, ExpectsWindows: true},
 		},
 		{
-			name:     "read nonexistent file",
-			filename: "fake.txt",
-			wantErr:  true,
+			name:    "rancher without images list",
+			product: product.Rancher,
+			fsys:    fstest.MapFS{},
+			wantErr: true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			inspector := NewReleaseInspector(newMockFS(), nil, nil, false)
+			inspector := NewProductReleaseInspector(tt.product, tt.fsys, nil, nil, false)
 
-			got, err := inspector.readImageList(tt.filename)
+			imageMap, err := inspector.imageMap()
 			if (err != nil) != tt.wantErr {
-				t.Errorf("readImageList() error = %v, wantErr %v", err, tt.wantErr)
+				t.Fatalf("imageMap() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
 				return
 			}
 
+			image, ok := imageMap[tt.image]
+			if !ok {
+				t.Fatalf("imageMap() missing %s", tt.image)
+			}
+			if image.ExpectsLinuxAmd64 != tt.expected.ExpectsLinuxAmd64 ||
+				image.ExpectsLinuxArm64 != tt.expected.ExpectsLinuxArm64 ||
+				image.ExpectsWindows != tt.expected.ExpectsWindows {
+				t.Errorf("imageMap() %s = %+v, want %+v", tt.image, image, tt.expected)
+			}
+		})
+	}
+}
+
+func TestImageStatus(t *testing.T) {
+	amd64 := reg.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := reg.Platform{OS: "linux", Architecture: "arm64"}
+	attestation := reg.Platform{OS: "unknown", Architecture: "unknown"}
+
+	image := func(digest string, digests map[reg.Platform]string) reg.Image {
+		platforms := make(map[reg.Platform]bool, len(digests))
+		for platform := range digests {
+			platforms[platform] = true
+		}
+		return reg.Image{Exists: true, Digest: digest, Platforms: platforms, Digests: digests}
+	}
+
+	tests := []struct {
+		name       string
+		oss        reg.Image
+		prime      reg.Image
+		notChecked bool
+		expected   Status
+	}{
+		{
+			name:     "identical",
+			oss:      image("sha256:index", map[reg.Platform]string{amd64: "sha256:a", arm64: "sha256:b"}),
+			prime:    image("sha256:index", map[reg.Platform]string{amd64: "sha256:a", arm64: "sha256:b"}),
+			expected: StatusOK,
+		},
+		{
+			name:     "same platform manifests in a different index",
+			oss:      image("sha256:index", map[reg.Platform]string{amd64: "sha256:a", attestation: "sha256:c"}),
+			prime:    image("sha256:other", map[reg.Platform]string{amd64: "sha256:a"}),
+			expected: StatusOK,
+		},
+		{
+			name:     "missing everywhere",
+			expected: StatusMissing,
+		},
+		{
+			name:     "not copied to prime",
+			oss:      image("sha256:index", map[reg.Platform]string{amd64: "sha256:a"}),
+			expected: StatusOSSOnly,
+		},
+		{
+			name:       "prime not checked",
+			oss:        image("sha256:index", map[reg.Platform]string{amd64: "sha256:a"}),
+			notChecked: true,
+			expected:   StatusPrimeNotChecked,
+		},
+		{
+			name:       "missing from oss with prime not checked",
+			notChecked: true,
+			expected:   StatusMissing,
+		},
+		{
+			name:     "only in prime",
+			prime:    image("sha256:index", map[reg.Platform]string{amd64: "sha256:a"}),
+			expected: StatusPrimeOnly,
+		},
+		{
+			name:     "platform digest mismatch",
+			oss:      image("sha256:index", map[reg.Platform]string{amd64: "sha256:a", arm64: "sha256:b"}),
+			prime:    image("sha256:other", map[reg.Platform]string{amd64: "sha256:a", arm64: "sha256:x"}),
+			expected: StatusMismatch,
+		},
+		{
+			name:     "stale copy missing a platform",
+			oss:      image("sha256:index", map[reg.Platform]string{amd64: "sha256:a", arm64: "sha256:b"}),
+			prime:    image("sha256:old", map[reg.Platform]string{amd64: "sha256:a"}),
+			expected: StatusStale,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := Image{OSSImage: tt.oss, PrimeImage: tt.prime, PrimeChecked: !tt.notChecked}
+			if status := img.Status(); status != tt.expected {
+				t.Errorf("Status() = %s, want %s", status, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMissingPlatforms(t *testing.T) {
+	amd64 := reg.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := reg.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}
+	ltsc2019 := reg.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.6189"}
+	ltsc2022 := reg.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.20348.2655"}
+
+	image := func(platforms ...reg.Platform) reg.Image {
+		img := reg.Image{Exists: true, Platforms: make(map[reg.Platform]bool)}
+		for _, platform := range platforms {
+			img.Platforms[platform] = true
+		}
+		return img
+	}
+
+	tests := []struct {
+		name     string
+		release  ReleaseImage
+		oss      reg.Image
+		prime    reg.Image
+		expected []string
+	}{
+		{
+			name:    "complete linux image",
+			release: ReleaseImage{ExpectsLinuxAmd64: true, ExpectsLinuxArm64: true},
+			oss:     image(amd64, arm64),
+			prime:   image(amd64, arm64),
+		},
+		{
+			name:     "prime copy missing a platform",
+			release:  ReleaseImage{ExpectsLinuxAmd64: true, ExpectsLinuxArm64: true},
+			oss:      image(amd64, arm64),
+			prime:    image(amd64),
+			expected: []string{"linux/arm64"},
+		},
+		{
+			name:    "windows image for every build",
+			release: ReleaseImage{ExpectsWindows: true},
+			oss:     image(ltsc2019, ltsc2022),
+		},
+		{
+			name:     "windows image missing a build",
+			release:  ReleaseImage{ExpectsWindows: true},
+			oss:      image(ltsc2019),
+			expected: []string{"windows/amd64:10.0.20348"},
+		},
+		{
+			name:     "missing image",
+			release:  ReleaseImage{ExpectsLinuxAmd64: true, ExpectsWindows: true},
+			expected: []string{"linux/amd64", "windows/amd64:10.0.17763", "windows/amd64:10.0.20348"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := Image{ReleaseImage: tt.release, OSSImage: tt.oss, PrimeImage: tt.prime}
+
+			var missing []string
+			for _, platform := range img.MissingPlatforms() {
+				missing = append(missing, platform.String())
+			}
+			if !reflect.DeepEqual(missing, tt.expected) {
+				t.Errorf("MissingPlatforms() = %v, want %v", missing, tt.expected)
+			}
+		})
+	}
+}
+
+// flakyRegistry fails every image the given number of times before answering
+type flakyRegistry struct {
+	mu       sync.Mutex
+	failures int
+	err      error
+	calls    map[string]int
+	inflight int
+	peak     int
+}
+
+func (f *flakyRegistry) Image(_ context.Context, ref name.Reference) (reg.Image, error) {
+	f.mu.Lock()
+	f.calls[ref.Name()]++
+	calls := f.calls[ref.Name()]
+	f.inflight++
+	if f.inflight > f.peak {
+		f.peak = f.inflight
+	}
+	f.mu.Unlock()
+
+	time.Sleep(time.Millisecond)
+
+	f.mu.Lock()
+	f.inflight--
+	f.mu.Unlock()
+
+	if calls <= f.failures {
+		return reg.Image{}, f.err
+	}
+
+	return reg.Image{Exists: true, Platforms: map[reg.Platform]bool{{OS: "linux", Architecture: "amd64"}: true}}, nil
+}
+
+func TestCheckImages(t *testing.T) {
+	tests := []struct {
+		name           string
+		failures       int
+		err            error
+		expectedStatus Status
+		expectedCalls  int
+	}{
+		{
+			name:           "no errors",
+			expectedStatus: StatusPrimeNotChecked,
+			expectedCalls:  1,
+		},
+		{
+			name:           "rate limited then succeeds",
+			failures:       2,
+			err:            &transport.Error{StatusCode: http.StatusTooManyRequests},
+			expectedStatus: StatusPrimeNotChecked,
+			expectedCalls:  3,
+		},
+		{
+			name:           "server errors exhaust retries",
+			failures:       10,
+			err:            &transport.Error{StatusCode: http.StatusBadGateway},
+			expectedStatus: StatusError,
+			expectedCalls:  DefaultRetries + 1,
+		},
+		{
+			name:           "unauthorized isn't retried",
+			failures:       10,
+			err:            &transport.Error{StatusCode: http.StatusUnauthorized},
+			expectedStatus: StatusError,
+			expectedCalls:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := &flakyRegistry{failures: tt.failures, err: tt.err, calls: make(map[string]int)}
+			inspector := NewReleaseInspector(newMockFS(), registry, nil, false)
+			inspector.ConcurrencyLimit = 2
+			inspector.RetryBackoff = time.Millisecond
+
+			var progress strings.Builder
+			inspector.Progress = &progress
+
+			results, err := inspector.InspectRelease(context.Background(), "v1.23.4+rke2r1")
 			if err != nil {
-				return
+				t.Fatalf("InspectRelease() error = %v", err)
+			}
+			if len(results) != 3 {
+				t.Fatalf("InspectRelease() returned %d images, want 3", len(results))
 			}
 
-			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
-				t.Errorf("readImageList() = %v, want %v", got, tt.want)
+			for _, result := range results {
+				if status := result.Status(); status != tt.expectedStatus {
+					t.Errorf("%s status = %s, want %s", result.Reference.Name(), status, tt.expectedStatus)
+				}
+				if (result.Err != nil) != (tt.expectedStatus == StatusError) {
+					t.Errorf("%s error = %v", result.Reference.Name(), result.Err)
+				}
+				if calls := registry.calls[result.Reference.Name()]; calls != tt.expectedCalls {
+					t.Errorf("%s calls = %d, want %d", result.Reference.Name(), calls, tt.expectedCalls)
+				}
+			}
+
+			if registry.peak > inspector.ConcurrencyLimit {
+				t.Errorf("peak concurrency = %d, want at most %d", registry.peak, inspector.ConcurrencyLimit)
+			}
+			if !strings.Contains(progress.String(), "inspected 3/3 images") {
+				t.Errorf("progress = %q, want the final count", progress.String())
 			}
 		})
 	}
@@ -0,0 +1,342 @@
+package sbom
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/rancher/ecm-distro-tools/release"
+)
+
+const creator = "ecm-distro-tools"
+
+var spdxIDInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9.-]+`)
+
+func spdxID(s string) string {
+	return "SPDXRef-" + spdxIDInvalidChars.ReplaceAllString(s, "-")
+}
+
+// uuid derives a stable RFC 4122 formatted identifier from the document contents
+func (s *SBOM) uuid() string {
+	sum := sha256.Sum256([]byte(s.Product + "\x00" + s.Version + "\x00" + s.Created.Format(time.RFC3339Nano)))
+	sum[6] = (sum[6] & 0x0f) | 0x40
+	sum[8] = (sum[8] & 0x3f) | 0x80
+	h := hex.EncodeToString(sum[:16])
+
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+// imagePURL returns the package URL of an image, or of one of its platforms when platform is set
+func imagePURL(reference, digest, platform string) string {
+	ref, err := name.ParseReference(reference)
+	if err != nil {
+		return ""
+	}
+
+	repository := ref.Context().RepositoryStr()
+	if i := strings.LastIndex(repository, "/"); i != -1 {
+		repository = repository[i+1:]
+	}
+
+	qualifiers := url.Values{}
+	qualifiers.Set("repository_url", ref.Context().Name())
+	if tag, ok := ref.(name.Tag); ok {
+		qualifiers.Set("tag", tag.TagStr())
+	}
+	if platform != "" {
+		parts := strings.SplitN(platform, "/", 3)
+		qualifiers.Set("os", parts[0])
+		if len(parts) > 1 {
+			qualifiers.Set("arch", parts[1])
+		}
+		if len(parts) > 2 {
+			qualifiers.Set("variant", parts[2])
+		}
+	}
+
+	purl := "pkg:oci/" + repository
+	if digest != "" {
+		purl += "@" + url.PathEscape(digest)
+	}
+
+	return purl + "?" + qualifiers.Encode()
+}
+
+func componentPURL(component release.Component) string {
+	if component.Chart {
+		return "pkg:helm/" + component.Name + "@" + component.Version
+	}
+
+	return "pkg:generic/" + component.Name + "@" + component.Version
+}
+
+func sortedPlatforms(image Image) []string {
+	platforms := make([]string, 0, len(image.Platforms))
+	for platform := range image.Platforms {
+		platforms = append(platforms, platform)
+	}
+	sort.Strings(platforms)
+
+	return platforms
+}
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	SPDXID           string            `json:"SPDXID"`
+	Name             string            `json:"name"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	PrimaryPurpose   string            `json:"primaryPackagePurpose,omitempty"`
+	Checksums        []spdxChecksum    `json:"checksums,omitempty"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+func spdxChecksums(digest string) []spdxChecksum {
+	if !strings.HasPrefix(digest, "sha256:") {
+		return nil
+	}
+
+	return []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: strings.TrimPrefix(digest, "sha256:")}}
+}
+
+func spdxPURL(purl string) []spdxExternalRef {
+	return []spdxExternalRef{{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: purl}}
+}
+
+// SPDX writes the bill of materials as an SPDX 2.3 JSON document
+func (s *SBOM) SPDX(w io.Writer) error {
+	releaseID := spdxID(s.Product + "-" + s.Version)
+
+	doc := spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              s.Product + "-" + s.Version,
+		DocumentNamespace: "https://github.com/rancher/ecm-distro-tools/sbom/" + s.Product + "/" + url.PathEscape(s.Version) + "-" + s.uuid(),
+		CreationInfo: spdxCreationInfo{
+			Created:  s.Created.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: " + creator},
+		},
+		Packages: []spdxPackage{{
+			SPDXID:           releaseID,
+			Name:             s.Product,
+			VersionInfo:      s.Version,
+			DownloadLocation: "NOASSERTION",
+			PrimaryPurpose:   "APPLICATION",
+		}},
+		Relationships: []spdxRelationship{{
+			SPDXElementID:      "SPDXRef-DOCUMENT",
+			RelationshipType:   "DESCRIBES",
+			RelatedSPDXElement: releaseID,
+		}},
+	}
+
+	for _, component := range s.Components {
+		prefix := "component-"
+		if component.Chart {
+			prefix = "chart-"
+		}
+		id := spdxID(prefix + component.Name)
+
+		doc.Packages = append(doc.Packages, spdxPackage{
+			SPDXID:           id,
+			Name:             component.Name,
+			VersionInfo:      component.Version,
+			DownloadLocation: "NOASSERTION",
+			ExternalRefs:     spdxPURL(componentPURL(component)),
+		})
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID:      releaseID,
+			RelationshipType:   "CONTAINS",
+			RelatedSPDXElement: id,
+		})
+	}
+
+	for _, image := range s.Images {
+		id := spdxID("image-" + image.Reference)
+
+		doc.Packages = append(doc.Packages, spdxPackage{
+			SPDXID:           id,
+			Name:             image.Reference,
+			DownloadLocation: "NOASSERTION",
+			PrimaryPurpose:   "CONTAINER",
+			Checksums:        spdxChecksums(image.Digest),
+			ExternalRefs:     spdxPURL(imagePURL(image.Reference, image.Digest, "")),
+		})
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID:      releaseID,
+			RelationshipType:   "CONTAINS",
+			RelatedSPDXElement: id,
+		})
+
+		for _, platform := range sortedPlatforms(image) {
+			digest := image.Platforms[platform]
+			platformID := spdxID("image-" + image.Reference + "-" + platform)
+
+			doc.Packages = append(doc.Packages, spdxPackage{
+				SPDXID:           platformID,
+				Name:             image.Reference + " (" + platform + ")",
+				DownloadLocation: "NOASSERTION",
+				PrimaryPurpose:   "CONTAINER",
+				Checksums:        spdxChecksums(digest),
+				ExternalRefs:     spdxPURL(imagePURL(image.Reference, digest, platform)),
+			})
+			doc.Relationships = append(doc.Relationships, spdxRelationship{
+				SPDXElementID:      platformID,
+				RelationshipType:   "VARIANT_OF",
+				RelatedSPDXElement: id,
+			})
+		}
+	}
+
+	return writeJSON(w, doc)
+}
+
+type cycloneDXDocument struct {
+	BOMFormat    string               `json:"bomFormat"`
+	SpecVersion  string               `json:"specVersion"`
+	SerialNumber string               `json:"serialNumber"`
+	Version      int                  `json:"version"`
+	Metadata     cycloneDXMetadata    `json:"metadata"`
+	Components   []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string `json:"timestamp"`
+	Tools     struct {
+		Components []cycloneDXComponent `json:"components"`
+	} `json:"tools"`
+	Component cycloneDXComponent `json:"component"`
+}
+
+type cycloneDXComponent struct {
+	Type       string               `json:"type"`
+	BOMRef     string               `json:"bom-ref,omitempty"`
+	Name       string               `json:"name"`
+	Version    string               `json:"version,omitempty"`
+	PURL       string               `json:"purl,omitempty"`
+	Hashes     []cycloneDXHash      `json:"hashes,omitempty"`
+	Properties []cycloneDXProperty  `json:"properties,omitempty"`
+	Components []cycloneDXComponent `json:"components,omitempty"`
+}
+
+type cycloneDXHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func cycloneDXHashes(digest string) []cycloneDXHash {
+	if !strings.HasPrefix(digest, "sha256:") {
+		return nil
+	}
+
+	return []cycloneDXHash{{Alg: "SHA-256", Content: strings.TrimPrefix(digest, "sha256:")}}
+}
+
+// CycloneDX writes the bill of materials as a CycloneDX 1.5 JSON document
+func (s *SBOM) CycloneDX(w io.Writer) error {
+	doc := cycloneDXDocument{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + s.uuid(),
+		Version:      1,
+		Components:   make([]cycloneDXComponent, 0, len(s.Components)+len(s.Images)),
+	}
+	doc.Metadata.Timestamp = s.Created.UTC().Format(time.RFC3339)
+	doc.Metadata.Tools.Components = []cycloneDXComponent{{Type: "application", Name: creator}}
+	doc.Metadata.Component = cycloneDXComponent{
+		Type:    "application",
+		BOMRef:  s.Product + "@" + s.Version,
+		Name:    s.Product,
+		Version: s.Version,
+	}
+
+	for _, component := range s.Components {
+		purl := componentPURL(component)
+		doc.Components = append(doc.Components, cycloneDXComponent{
+			Type:    "application",
+			BOMRef:  purl,
+			Name:    component.Name,
+			Version: component.Version,
+			PURL:    purl,
+		})
+	}
+
+	for _, image := range s.Images {
+		purl := imagePURL(image.Reference, image.Digest, "")
+		c := cycloneDXComponent{
+			Type:   "container",
+			BOMRef: purl,
+			Name:   image.Reference,
+			PURL:   purl,
+			Hashes: cycloneDXHashes(image.Digest),
+		}
+		for _, platform := range sortedPlatforms(image) {
+			digest := image.Platforms[platform]
+			platformPURL := imagePURL(image.Reference, digest, platform)
+			c.Components = append(c.Components, cycloneDXComponent{
+				Type:       "container",
+				BOMRef:     platformPURL,
+				Name:       image.Reference,
+				PURL:       platformPURL,
+				Hashes:     cycloneDXHashes(digest),
+				Properties: []cycloneDXProperty{{Name: "platform", Value: platform}},
+			})
+		}
+		doc.Components = append(doc.Components, c)
+	}
+
+	return writeJSON(w, doc)
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(v)
+}
@@ -0,0 +1,107 @@
+// Package sbom generates software bills of materials for releases, in the
+// SPDX and CycloneDX JSON formats, from the release image lists, the image
+// digests per platform and the versions of the components bundled in a release.
+package sbom
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	reg "github.com/rancher/ecm-distro-tools/registry"
+	"github.com/rancher/ecm-distro-tools/release"
+	"github.com/rancher/ecm-distro-tools/release/product"
+	"golang.org/x/sync/errgroup"
+)
+
+// Image is a container image of a release
+type Image struct {
+	Reference string `json:"reference"`
+	// Digest is the digest of the image manifest or index
+	Digest string `json:"digest,omitempty"`
+	// Platforms are the digests of the image manifest of each platform
+	Platforms map[string]string `json:"platforms,omitempty"`
+}
+
+// SBOM is the bill of materials of a release
+type SBOM struct {
+	Product    string              `json:"product"`
+	Version    string              `json:"version"`
+	Created    time.Time           `json:"created"`
+	Components []release.Component `json:"components"`
+	Images     []Image             `json:"images"`
+}
+
+// ImageDigests resolves the digests of an image and of each of its platforms in the registry
+// of the client
+func ImageDigests(ctx context.Context, client *reg.Client, reference string) (*Image, error) {
+	ref, err := name.ParseReference(reference)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := client.Image(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Exists {
+		return nil, errors.New("image not found")
+	}
+
+	image := Image{
+		Reference: reference,
+		Digest:    info.Digest,
+		Platforms: make(map[string]string),
+	}
+	for platform, digest := range info.Digests {
+		// skip attestation manifests stored in the index
+		if platform.OS == "unknown" {
+			continue
+		}
+		image.Platforms[platform.String()] = digest
+	}
+
+	return &image, nil
+}
+
+// Generate creates the bill of materials of a release, resolving the digests of its images
+// with at most concurrencyLimit registry requests at a time. Components are the versions of
+// the components bundled in the release, see release.Components.
+func Generate(ctx context.Context, client *reg.Client, fsys fs.FS, p product.Product, version string, components []release.Component, concurrencyLimit int) (*SBOM, error) {
+	references, err := p.Images(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]Image, len(references))
+
+	errGroup, ctx := errgroup.WithContext(ctx)
+	errGroup.SetLimit(concurrencyLimit)
+
+	for i, reference := range references {
+		i, reference := i, reference
+		errGroup.Go(func() error {
+			image, err := ImageDigests(ctx, client, reference)
+			if err != nil {
+				return errors.New("failed to resolve digests of " + reference + ": " + err.Error())
+			}
+
+			images[i] = *image
+
+			return nil
+		})
+	}
+	if err := errGroup.Wait(); err != nil {
+		return nil, err
+	}
+
+	return &SBOM{
+		Product:    p.Name,
+		Version:    version,
+		Created:    time.Now().UTC(),
+		Components: components,
+		Images:     images,
+	}, nil
+}
@@ -0,0 +1,175 @@
+package sbom
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	reg "github.com/rancher/ecm-distro-tools/registry"
+	"github.com/rancher/ecm-distro-tools/release"
+)
+
+func TestImageDigests(t *testing.T) {
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(server.Close)
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	img, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := mutate.AppendManifests(empty.Index,
+		mutate.IndexAddendum{Add: img, Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "amd64"}}},
+		mutate.IndexAddendum{Add: img, Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "unknown", Architecture: "unknown"}}},
+	)
+	ref, err := name.ParseReference(host + "/rancher/mirrored-pause:3.6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.WriteIndex(ref, idx); err != nil {
+		t.Fatal(err)
+	}
+	idxDigest, _ := idx.Digest()
+	imgDigest, _ := img.Digest()
+
+	// the images are resolved in the registry of the client, like the other registry checks
+	client := reg.NewClient(host, false)
+
+	image, err := ImageDigests(context.Background(), client, "docker.io/rancher/mirrored-pause:3.6")
+	if err != nil {
+		t.Fatalf("ImageDigests() error = %v", err)
+	}
+	expected := &Image{
+		Reference: "docker.io/rancher/mirrored-pause:3.6",
+		Digest:    idxDigest.String(),
+		Platforms: map[string]string{"linux/amd64": imgDigest.String()},
+	}
+	if !reflect.DeepEqual(image, expected) {
+		t.Errorf("ImageDigests() = %+v, want %+v", image, expected)
+	}
+
+	if _, err := ImageDigests(context.Background(), client, "docker.io/rancher/missing:v1"); err == nil {
+		t.Error("ImageDigests() expected an error for a missing image")
+	}
+}
+
+func TestImagePURL(t *testing.T) {
+	tests := []struct {
+		name      string
+		reference string
+		digest    string
+		platform  string
+		expected  string
+	}{
+		{
+			name:      "index",
+			reference: "rancher/mirrored-pause:3.6",
+			digest:    "sha256:abc",
+			expected:  "pkg:oci/mirrored-pause@sha256:abc?repository_url=index.docker.io%2Francher%2Fmirrored-pause&tag=3.6",
+		},
+		{
+			name:      "platform",
+			reference: "registry.rancher.com/rancher/rke2-runtime:v1.30.4-rke2r1",
+			digest:    "sha256:def",
+			platform:  "linux/arm64/v8",
+			expected:  "pkg:oci/rke2-runtime@sha256:def?arch=arm64&os=linux&repository_url=registry.rancher.com%2Francher%2Frke2-runtime&tag=v1.30.4-rke2r1&variant=v8",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if purl := imagePURL(tt.reference, tt.digest, tt.platform); purl != tt.expected {
+				t.Errorf("imagePURL() = %s, want %s", purl, tt.expected)
+			}
+		})
+	}
+}
+
+func testSBOM() *SBOM {
+	return &SBOM{
+		Product: "rke2",
+		Version: "v1.30.4+rke2r1",
+		Created: time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC),
+		Components: []release.Component{
+			{Name: "containerd", Version: "v1.7.20-k3s1"},
+			{Name: "rke2-coredns", Version: "1.29.002", Chart: true},
+		},
+		Images: []Image{{
+			Reference: "docker.io/rancher/mirrored-pause:3.6",
+			Digest:    "sha256:1111",
+			Platforms: map[string]string{
+				"linux/amd64": "sha256:2222",
+				"linux/arm64": "sha256:3333",
+			},
+		}},
+	}
+}
+
+func TestSPDX(t *testing.T) {
+	var b bytes.Buffer
+	if err := testSBOM().SPDX(&b); err != nil {
+		t.Fatalf("SPDX() error = %v", err)
+	}
+
+	var doc spdxDocument
+	if err := json.Unmarshal(b.Bytes(), &doc); err != nil {
+		t.Fatalf("SPDX() produced invalid JSON: %v", err)
+	}
+
+	// release, 2 components, the image and its 2 platforms
+	if len(doc.Packages) != 6 {
+		t.Errorf("SPDX() packages = %d, want 6", len(doc.Packages))
+	}
+	if len(doc.Relationships) != 6 {
+		t.Errorf("SPDX() relationships = %d, want 6", len(doc.Relationships))
+	}
+
+	ids := make(map[string]bool)
+	for _, p := range doc.Packages {
+		if ids[p.SPDXID] {
+			t.Errorf("SPDX() duplicated SPDXID %s", p.SPDXID)
+		}
+		ids[p.SPDXID] = true
+	}
+	for _, r := range doc.Relationships {
+		if !ids[r.RelatedSPDXElement] {
+			t.Errorf("SPDX() relationship to unknown element %s", r.RelatedSPDXElement)
+		}
+	}
+}
+
+func TestCycloneDX(t *testing.T) {
+	var b bytes.Buffer
+	if err := testSBOM().CycloneDX(&b); err != nil {
+		t.Fatalf("CycloneDX() error = %v", err)
+	}
+
+	var doc cycloneDXDocument
+	if err := json.Unmarshal(b.Bytes(), &doc); err != nil {
+		t.Fatalf("CycloneDX() produced invalid JSON: %v", err)
+	}
+
+	if len(doc.Components) != 3 {
+		t.Fatalf("CycloneDX() components = %d, want 3", len(doc.Components))
+	}
+	if doc.Components[1].PURL != "pkg:helm/rke2-coredns@1.29.002" {
+		t.Errorf("CycloneDX() chart purl = %s", doc.Components[1].PURL)
+	}
+	if platforms := doc.Components[2].Components; len(platforms) != 2 || platforms[0].Hashes[0].Content != "2222" {
+		t.Errorf("CycloneDX() platforms = %+v", platforms)
+	}
+}
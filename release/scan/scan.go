@@ -0,0 +1,272 @@
+// Package scan summarizes the vulnerability reports of release images. Reports
+// are produced offline by Trivy or Grype in their JSON formats and matched to
+// the images listed in the release image lists.
+package scan
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// Severity is the severity of a vulnerability, ordered from least to most severe
+type Severity int
+
+const (
+	SeverityUnknown Severity = iota
+	SeverityNegligible
+	SeverityLow
+	SeverityMedium
+	SeverityHigh
+	SeverityCritical
+)
+
+// Severities are all the severities, from most to least severe
+var Severities = []Severity{SeverityCritical, SeverityHigh, SeverityMedium, SeverityLow, SeverityNegligible, SeverityUnknown}
+
+var severityNames = map[Severity]string{
+	SeverityUnknown:    "unknown",
+	SeverityNegligible: "negligible",
+	SeverityLow:        "low",
+	SeverityMedium:     "medium",
+	SeverityHigh:       "high",
+	SeverityCritical:   "critical",
+}
+
+func (s Severity) String() string {
+	return severityNames[s]
+}
+
+// ParseSeverity parses a severity name, case insensitive
+func ParseSeverity(s string) (Severity, error) {
+	for severity, name := range severityNames {
+		if strings.EqualFold(s, name) {
+			return severity, nil
+		}
+	}
+
+	return SeverityUnknown, errors.New("invalid severity: " + s)
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Severity) UnmarshalText(text []byte) error {
+	severity, err := ParseSeverity(string(text))
+	if err != nil {
+		return err
+	}
+	*s = severity
+
+	return nil
+}
+
+// Vulnerability is a vulnerability found in a package of an image
+type Vulnerability struct {
+	ID           string   `json:"id"`
+	Package      string   `json:"package"`
+	Version      string   `json:"version"`
+	FixedVersion string   `json:"fixedVersion,omitempty"`
+	Severity     Severity `json:"severity"`
+}
+
+// Report is the scanner report of an image
+type Report struct {
+	Image           string
+	Vulnerabilities []Vulnerability
+}
+
+// trivyReport is the subset of the Trivy JSON report used in summaries
+type trivyReport struct {
+	SchemaVersion int    `json:"SchemaVersion"`
+	ArtifactName  string `json:"ArtifactName"`
+	Results       []struct {
+		Vulnerabilities []struct {
+			VulnerabilityID  string `json:"VulnerabilityID"`
+			PkgName          string `json:"PkgName"`
+			InstalledVersion string `json:"InstalledVersion"`
+			FixedVersion     string `json:"FixedVersion"`
+			Severity         string `json:"Severity"`
+		} `json:"Vulnerabilities"`
+	} `json:"Results"`
+}
+
+// grypeReport is the subset of the Grype JSON report used in summaries
+type grypeReport struct {
+	Matches []struct {
+		Vulnerability struct {
+			ID       string `json:"id"`
+			Severity string `json:"severity"`
+			Fix      struct {
+				Versions []string `json:"versions"`
+			} `json:"fix"`
+		} `json:"vulnerability"`
+		Artifact struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"artifact"`
+	} `json:"matches"`
+	Source *struct {
+		Type   string          `json:"type"`
+		Target json.RawMessage `json:"target"`
+	} `json:"source"`
+}
+
+// ParseReport parses a Trivy or Grype JSON report
+func ParseReport(r io.Reader) (*Report, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var trivy trivyReport
+	if err := json.Unmarshal(b, &trivy); err != nil {
+		return nil, err
+	}
+	if trivy.ArtifactName != "" {
+		return parseTrivy(trivy), nil
+	}
+
+	var grype grypeReport
+	if err := json.Unmarshal(b, &grype); err != nil {
+		return nil, err
+	}
+	if grype.Source != nil {
+		return parseGrype(grype)
+	}
+
+	return nil, errors.New("unrecognized report format, expected a trivy or grype json report")
+}
+
+func parseTrivy(trivy trivyReport) *Report {
+	report := &Report{Image: trivy.ArtifactName}
+	for _, result := range trivy.Results {
+		for _, v := range result.Vulnerabilities {
+			severity, _ := ParseSeverity(v.Severity)
+			report.Vulnerabilities = append(report.Vulnerabilities, Vulnerability{
+				ID:           v.VulnerabilityID,
+				Package:      v.PkgName,
+				Version:      v.InstalledVersion,
+				FixedVersion: v.FixedVersion,
+				Severity:     severity,
+			})
+		}
+	}
+	report.Vulnerabilities = dedupe(report.Vulnerabilities)
+
+	return report
+}
+
+func parseGrype(grype grypeReport) (*Report, error) {
+	// image targets are objects, directory and file targets are plain strings
+	var target struct {
+		UserInput string `json:"userInput"`
+	}
+	if err := json.Unmarshal(grype.Source.Target, &target); err != nil {
+		if err := json.Unmarshal(grype.Source.Target, &target.UserInput); err != nil {
+			return nil, err
+		}
+	}
+	if target.UserInput == "" {
+		return nil, errors.New("grype report is missing the source target")
+	}
+
+	report := &Report{Image: target.UserInput}
+	for _, match := range grype.Matches {
+		severity, _ := ParseSeverity(match.Vulnerability.Severity)
+		report.Vulnerabilities = append(report.Vulnerabilities, Vulnerability{
+			ID:           match.Vulnerability.ID,
+			Package:      match.Artifact.Name,
+			Version:      match.Artifact.Version,
+			FixedVersion: strings.Join(match.Vulnerability.Fix.Versions, ", "),
+			Severity:     severity,
+		})
+	}
+	report.Vulnerabilities = dedupe(report.Vulnerabilities)
+
+	return report, nil
+}
+
+// dedupe removes vulnerabilities reported more than once for the same package,
+// sorting them from most to least severe
+func dedupe(vulnerabilities []Vulnerability) []Vulnerability {
+	seen := make(map[string]bool)
+	deduped := make([]Vulnerability, 0, len(vulnerabilities))
+	for _, v := range vulnerabilities {
+		key := v.ID + " " + v.Package + " " + v.Version
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		deduped = append(deduped, v)
+	}
+	sort.SliceStable(deduped, func(i, j int) bool {
+		if deduped[i].Severity != deduped[j].Severity {
+			return deduped[i].Severity > deduped[j].Severity
+		}
+		if deduped[i].ID != deduped[j].ID {
+			return deduped[i].ID < deduped[j].ID
+		}
+		return deduped[i].Package < deduped[j].Package
+	})
+
+	return deduped
+}
+
+// LoadReports parses every JSON report in the root of the filesystem
+func LoadReports(fsys fs.FS) ([]*Report, error) {
+	files, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make([]*Report, 0, len(files))
+	for _, file := range files {
+		f, err := fsys.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		report, err := ParseReport(f)
+		f.Close()
+		if err != nil {
+			return nil, errors.New(path.Base(file) + ": " + err.Error())
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+// imageKey returns the repository and tag of an image reference, so references
+// to the same image with or without the registry match
+func imageKey(image string) string {
+	// scanners may append the digest to the tag they were given
+	if at := strings.Index(image, "@"); at != -1 && strings.Contains(image[strings.LastIndex(image[:at], "/")+1:at], ":") {
+		image = image[:at]
+	}
+
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return image
+	}
+
+	return ref.Context().RepositoryStr() + ":" + ref.Identifier()
+}
+
+// repositoryKey returns the repository of an image reference, used to match
+// images across releases
+func repositoryKey(image string) string {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return image
+	}
+
+	return ref.Context().RepositoryStr()
+}
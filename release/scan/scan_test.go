@@ -0,0 +1,192 @@
+package scan
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseReport(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      string
+		input     string
+		image     string
+		ids       []string
+		severity  Severity
+		expectErr bool
+	}{
+		{
+			name:     "trivy",
+			file:     "testdata/trivy.json",
+			image:    "docker.io/rancher/rke2-runtime:v1.30.4-rke2r1",
+			ids:      []string{"CVE-2024-34156", "CVE-2024-6119", "CVE-2024-5535"},
+			severity: SeverityHigh,
+		},
+		{
+			name:     "grype",
+			file:     "testdata/grype.json",
+			image:    "rancher/hardened-etcd:v3.5.13-k3s1-build20240531",
+			ids:      []string{"CVE-2024-24790", "GHSA-xr7q-jx4m-x55m"},
+			severity: SeverityCritical,
+		},
+		{
+			name:      "unrecognized report",
+			input:     `{"bomFormat": "CycloneDX"}`,
+			expectErr: true,
+		},
+		{
+			name:      "invalid json",
+			input:     `{`,
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := tt.input
+			if tt.file != "" {
+				b, err := os.ReadFile(tt.file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				input = string(b)
+			}
+
+			report, err := ParseReport(strings.NewReader(input))
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("ParseReport() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if tt.expectErr {
+				return
+			}
+
+			if report.Image != tt.image {
+				t.Errorf("ParseReport() image = %s, want %s", report.Image, tt.image)
+			}
+			var ids []string
+			for _, v := range report.Vulnerabilities {
+				ids = append(ids, v.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.ids) {
+				t.Errorf("ParseReport() vulnerabilities = %v, want %v", ids, tt.ids)
+			}
+			if report.Vulnerabilities[0].Severity != tt.severity {
+				t.Errorf("ParseReport() first severity = %s, want %s", report.Vulnerabilities[0].Severity, tt.severity)
+			}
+		})
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	fsys := fstest.MapFS{
+		"rke2-runtime.json": &fstest.MapFile{Data: mustRead(t, "testdata/trivy.json")},
+		"etcd.json":         &fstest.MapFile{Data: mustRead(t, "testdata/grype.json")},
+		"notes.txt":         &fstest.MapFile{Data: []byte("not a report")},
+	}
+	reports, err := LoadReports(fsys)
+	if err != nil {
+		t.Fatalf("LoadReports() error = %v", err)
+	}
+
+	summary := Summarize("rke2", "v1.30.4+rke2r1", []string{
+		"rancher/rke2-runtime:v1.30.4-rke2r1",
+		"rancher/hardened-etcd:v3.5.13-k3s1-build20240531",
+		"rancher/mirrored-pause:3.6",
+	}, reports)
+
+	expectedCounts := map[Severity]int{
+		SeverityCritical:   1,
+		SeverityHigh:       2,
+		SeverityMedium:     1,
+		SeverityNegligible: 1,
+	}
+	if !reflect.DeepEqual(summary.Counts, expectedCounts) {
+		t.Errorf("Summarize() counts = %v, want %v", summary.Counts, expectedCounts)
+	}
+	if unscanned := summary.Unscanned(); !reflect.DeepEqual(unscanned, []string{"rancher/mirrored-pause:3.6"}) {
+		t.Errorf("Unscanned() = %v", unscanned)
+	}
+
+	tests := []struct {
+		threshold Severity
+		images    int
+	}{
+		{threshold: SeverityCritical, images: 0},
+		{threshold: SeverityHigh, images: 1},
+		{threshold: SeverityMedium, images: 2},
+		{threshold: SeverityUnknown, images: 2},
+	}
+	for _, tt := range tests {
+		if images := summary.Above(tt.threshold); len(images) != tt.images {
+			t.Errorf("Above(%s) = %d images, want %d", tt.threshold, len(images), tt.images)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	previous := &Summary{Images: []ImageSummary{
+		{
+			Image:   "rancher/rke2-runtime:v1.30.3-rke2r1",
+			Scanned: true,
+			Vulnerabilities: []Vulnerability{
+				{ID: "CVE-2024-5535", Package: "libopenssl3", Severity: SeverityMedium},
+				{ID: "CVE-2024-24790", Package: "stdlib", Severity: SeverityCritical},
+			},
+		},
+		{
+			Image:   "rancher/hardened-etcd:v3.5.13-k3s1-build20240531",
+			Scanned: true,
+		},
+	}}
+	current := &Summary{Images: []ImageSummary{
+		{
+			Image:   "rancher/rke2-runtime:v1.30.4-rke2r1",
+			Scanned: true,
+			Vulnerabilities: []Vulnerability{
+				{ID: "CVE-2024-5535", Package: "libopenssl3", Severity: SeverityMedium},
+				{ID: "CVE-2024-6119", Package: "libopenssl3", Severity: SeverityHigh},
+			},
+		},
+		{
+			Image:   "rancher/hardened-etcd:v3.5.15-k3s1-build20240910",
+			Scanned: true,
+		},
+		{
+			Image:   "rancher/mirrored-pause:3.6",
+			Scanned: true,
+			Vulnerabilities: []Vulnerability{
+				{ID: "CVE-2023-45288", Package: "stdlib", Severity: SeverityHigh},
+			},
+		},
+	}}
+
+	expected := []ImageDiff{
+		{
+			Image:    "rancher/rke2-runtime:v1.30.4-rke2r1",
+			Previous: "rancher/rke2-runtime:v1.30.3-rke2r1",
+			Added:    []Vulnerability{{ID: "CVE-2024-6119", Package: "libopenssl3", Severity: SeverityHigh}},
+			Fixed:    []Vulnerability{{ID: "CVE-2024-24790", Package: "stdlib", Severity: SeverityCritical}},
+		},
+		{
+			Image: "rancher/mirrored-pause:3.6",
+			Added: []Vulnerability{{ID: "CVE-2023-45288", Package: "stdlib", Severity: SeverityHigh}},
+		},
+	}
+	if diffs := Diff(previous, current); !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("Diff() = %+v, want %+v", diffs, expected)
+	}
+}
+
+func mustRead(t *testing.T, file string) []byte {
+	t.Helper()
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
@@ -0,0 +1,160 @@
+package scan
+
+import (
+	"sort"
+)
+
+// ImageSummary is the vulnerability summary of an image
+type ImageSummary struct {
+	Image string `json:"image"`
+	// Scanned is false when there's no report for the image
+	Scanned         bool             `json:"scanned"`
+	Counts          map[Severity]int `json:"counts"`
+	Vulnerabilities []Vulnerability  `json:"vulnerabilities,omitempty"`
+}
+
+// Summary is the vulnerability summary of the images of a release
+type Summary struct {
+	Product string           `json:"product"`
+	Version string           `json:"version"`
+	Images  []ImageSummary   `json:"images"`
+	Counts  map[Severity]int `json:"counts"`
+}
+
+// Summarize matches the reports to the release images, counting the
+// vulnerabilities of each image per severity. When images is nil, the
+// summary covers every reported image.
+func Summarize(product, version string, images []string, reports []*Report) *Summary {
+	reportsByImage := make(map[string]*Report, len(reports))
+	for _, report := range reports {
+		reportsByImage[imageKey(report.Image)] = report
+	}
+
+	if images == nil {
+		for _, report := range reports {
+			images = append(images, report.Image)
+		}
+	}
+
+	summary := &Summary{
+		Product: product,
+		Version: version,
+		Images:  make([]ImageSummary, 0, len(images)),
+		Counts:  make(map[Severity]int),
+	}
+
+	seen := make(map[string]bool)
+	for _, image := range images {
+		key := imageKey(image)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		imageSummary := ImageSummary{
+			Image:  image,
+			Counts: make(map[Severity]int),
+		}
+		if report, ok := reportsByImage[key]; ok {
+			imageSummary.Scanned = true
+			imageSummary.Vulnerabilities = report.Vulnerabilities
+			for _, v := range report.Vulnerabilities {
+				imageSummary.Counts[v.Severity]++
+				summary.Counts[v.Severity]++
+			}
+		}
+		summary.Images = append(summary.Images, imageSummary)
+	}
+	sort.Slice(summary.Images, func(i, j int) bool {
+		return summary.Images[i].Image < summary.Images[j].Image
+	})
+
+	return summary
+}
+
+// Unscanned returns the images without a report
+func (s *Summary) Unscanned() []string {
+	var images []string
+	for _, image := range s.Images {
+		if !image.Scanned {
+			images = append(images, image.Image)
+		}
+	}
+
+	return images
+}
+
+// Above returns the images with vulnerabilities more severe than the threshold
+func (s *Summary) Above(threshold Severity) []ImageSummary {
+	var images []ImageSummary
+	for _, image := range s.Images {
+		for _, v := range image.Vulnerabilities {
+			if v.Severity > threshold {
+				images = append(images, image)
+				break
+			}
+		}
+	}
+
+	return images
+}
+
+// ImageDiff are the vulnerabilities added and fixed in an image since the previous release
+type ImageDiff struct {
+	Image string `json:"image"`
+	// Previous is the image in the previous release, empty for new images
+	Previous string          `json:"previous,omitempty"`
+	Added    []Vulnerability `json:"added,omitempty"`
+	Fixed    []Vulnerability `json:"fixed,omitempty"`
+}
+
+// Diff compares the summary with the summary of the previous release. Images
+// are matched by repository since their tags usually change between releases,
+// and only images with added or fixed vulnerabilities are returned. Images
+// without a report in either release are skipped.
+func Diff(previous, current *Summary) []ImageDiff {
+	previousImages := make(map[string]ImageSummary, len(previous.Images))
+	for _, image := range previous.Images {
+		if image.Scanned {
+			previousImages[repositoryKey(imageKey(image.Image))] = image
+		}
+	}
+
+	var diffs []ImageDiff
+	for _, image := range current.Images {
+		if !image.Scanned {
+			continue
+		}
+
+		diff := ImageDiff{Image: image.Image}
+		prev, ok := previousImages[repositoryKey(imageKey(image.Image))]
+		if ok {
+			diff.Previous = prev.Image
+		}
+
+		diff.Added = subtract(image.Vulnerabilities, prev.Vulnerabilities)
+		diff.Fixed = subtract(prev.Vulnerabilities, image.Vulnerabilities)
+		if len(diff.Added) > 0 || len(diff.Fixed) > 0 {
+			diffs = append(diffs, diff)
+		}
+	}
+
+	return diffs
+}
+
+// subtract returns the vulnerabilities in a that aren't in b, matched by id and package
+func subtract(a, b []Vulnerability) []Vulnerability {
+	found := make(map[string]bool, len(b))
+	for _, v := range b {
+		found[v.ID+" "+v.Package] = true
+	}
+
+	var diff []Vulnerability
+	for _, v := range a {
+		if !found[v.ID+" "+v.Package] {
+			diff = append(diff, v)
+		}
+	}
+
+	return diff
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// ErrKeyNotFound is returned by the file editors when the key to set isn't in the file
+var ErrKeyNotFound = errors.New("key not found")
+
+// SetDockerfileEnv returns an editor that sets the value of the key in the ENV instructions
+// of a Dockerfile, both the ENV key=value and the legacy ENV key value forms are supported.
+func SetDockerfileEnv(key, value string) func([]byte) ([]byte, error) {
+	quotedKey := regexp.QuoteMeta(key)
+	pairRegex := regexp.MustCompile(`(\s)` + quotedKey + `=("[^"]*"|\S*)`)
+	legacyRegex := regexp.MustCompile(`^(\s*ENV\s+` + quotedKey + `\s+)\S.*$`)
+
+	return func(b []byte) ([]byte, error) {
+		lines := strings.Split(string(b), "\n")
+
+		var found bool
+		for i, line := range lines {
+			fields := strings.Fields(line)
+			if len(fields) < 2 || !strings.EqualFold(fields[0], "ENV") {
+				continue
+			}
+
+			if fields[1] == key {
+				lines[i] = legacyRegex.ReplaceAllString(line, "${1}"+escapeReplacement(value))
+				found = true
+				continue
+			}
+
+			if pairRegex.MatchString(line) {
+				lines[i] = pairRegex.ReplaceAllString(line, "${1}"+escapeReplacement(key+"="+value))
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("ENV %s: %w", key, ErrKeyNotFound)
+		}
+
+		return []byte(strings.Join(lines, "\n")), nil
+	}
+}
+
+// SetEnvFileVar returns an editor that sets the value of the variable in a shell env file
+// like scripts/package-env. Defaults in the form KEY=${KEY:-value} keep their form.
+func SetEnvFileVar(key, value string) func([]byte) ([]byte, error) {
+	quotedKey := regexp.QuoteMeta(key)
+	defaultRegex := regexp.MustCompile(`^(\s*(?:export\s+)?` + quotedKey + `=\$\{` + quotedKey + `:-)("?)[^"}]*("?)(\}.*)$`)
+	assignRegex := regexp.MustCompile(`^(\s*(?:export\s+)?` + quotedKey + `=)("?)[^"\s]*("?)(.*)$`)
+
+	return func(b []byte) ([]byte, error) {
+		lines := strings.Split(string(b), "\n")
+
+		var found bool
+		for i, line := range lines {
+			replacement := "${1}${2}" + escapeReplacement(value) + "${3}${4}"
+			switch {
+			case defaultRegex.MatchString(line):
+				lines[i] = defaultRegex.ReplaceAllString(line, replacement)
+			case assignRegex.MatchString(line):
+				lines[i] = assignRegex.ReplaceAllString(line, replacement)
+			default:
+				continue
+			}
+			found = true
+		}
+		if !found {
+			return nil, fmt.Errorf("%s: %w", key, ErrKeyNotFound)
+		}
+
+		return []byte(strings.Join(lines, "\n")), nil
+	}
+}
+
+// SetGoModRequire returns an editor that sets the version of the required modules of a go.mod,
+// modules that aren't required yet are added.
+func SetGoModRequire(modules map[string]string) func([]byte) ([]byte, error) {
+	return func(b []byte) ([]byte, error) {
+		f, err := modfile.Parse("go.mod", b, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		for path, version := range modules {
+			if err := f.AddRequire(path, version); err != nil {
+				return nil, err
+			}
+		}
+		f.Cleanup()
+
+		return modfile.Format(f.Syntax), nil
+	}
+}
+
+// escapeReplacement escapes the $ of a value used in a regexp replacement template
+func escapeReplacement(s string) string {
+	return strings.ReplaceAll(s, "$", "$$")
+}
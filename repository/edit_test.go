@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSetDockerfileEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		value   string
+		in      string
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "key=value",
+			key:   "CATTLE_UI_VERSION",
+			value: "2.9.3",
+			in:    "FROM scratch\nENV CATTLE_UI_VERSION=2.9.2\nENV CATTLE_DASHBOARD_UI_VERSION=v2.9.2\n",
+			want:  "FROM scratch\nENV CATTLE_UI_VERSION=2.9.3\nENV CATTLE_DASHBOARD_UI_VERSION=v2.9.2\n",
+		},
+		{
+			name:  "multiple pairs",
+			key:   "CATTLE_CLI_VERSION",
+			value: "v2.9.3",
+			in:    "ENV CATTLE_HELM_VERSION=v2.16.8 CATTLE_CLI_VERSION=v2.9.0 \\\n    CATTLE_K3S_VERSION=v1.30.2\n",
+			want:  "ENV CATTLE_HELM_VERSION=v2.16.8 CATTLE_CLI_VERSION=v2.9.3 \\\n    CATTLE_K3S_VERSION=v1.30.2\n",
+		},
+		{
+			name:  "quoted value",
+			key:   "CATTLE_CLI_VERSION",
+			value: "v2.9.3",
+			in:    "ENV CATTLE_CLI_VERSION=\"v2.9.0\"\n",
+			want:  "ENV CATTLE_CLI_VERSION=v2.9.3\n",
+		},
+		{
+			name:  "legacy form",
+			key:   "CATTLE_CLI_VERSION",
+			value: "v2.9.3",
+			in:    "ENV CATTLE_CLI_VERSION v2.9.0\n",
+			want:  "ENV CATTLE_CLI_VERSION v2.9.3\n",
+		},
+		{
+			name:  "key prefix of another key",
+			key:   "CATTLE_UI_VERSION",
+			value: "2.9.3",
+			in:    "ENV CATTLE_DASHBOARD_CATTLE_UI_VERSION=1\nENV CATTLE_UI_VERSION=2.9.2\n",
+			want:  "ENV CATTLE_DASHBOARD_CATTLE_UI_VERSION=1\nENV CATTLE_UI_VERSION=2.9.3\n",
+		},
+		{
+			name:    "missing key",
+			key:     "CATTLE_CLI_VERSION",
+			value:   "v2.9.3",
+			in:      "FROM scratch\nRUN echo CATTLE_CLI_VERSION=v2.9.0\n",
+			wantErr: ErrKeyNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SetDockerfileEnv(tt.key, tt.value)([]byte(tt.in))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("SetDockerfileEnv() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("SetDockerfileEnv() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetEnvFileVar(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		value   string
+		in      string
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "assignment",
+			key:   "CATTLE_CLI_VERSION",
+			value: "v2.9.3",
+			in:    "#!/bin/bash\nCATTLE_CLI_VERSION=v2.9.0\nCATTLE_UI_VERSION=2.9.2\n",
+			want:  "#!/bin/bash\nCATTLE_CLI_VERSION=v2.9.3\nCATTLE_UI_VERSION=2.9.2\n",
+		},
+		{
+			name:  "export and quotes",
+			key:   "CATTLE_CLI_VERSION",
+			value: "v2.9.3",
+			in:    "export CATTLE_CLI_VERSION=\"v2.9.0\"\n",
+			want:  "export CATTLE_CLI_VERSION=\"v2.9.3\"\n",
+		},
+		{
+			name:  "default",
+			key:   "CATTLE_DASHBOARD_UI_VERSION",
+			value: "v2.9.3",
+			in:    "CATTLE_DASHBOARD_UI_VERSION=${CATTLE_DASHBOARD_UI_VERSION:-\"v2.9.2\"}\n",
+			want:  "CATTLE_DASHBOARD_UI_VERSION=${CATTLE_DASHBOARD_UI_VERSION:-\"v2.9.3\"}\n",
+		},
+		{
+			name:    "missing key",
+			key:     "CATTLE_CLI_VERSION",
+			value:   "v2.9.3",
+			in:      "SYSTEM_CHART_DEFAULT_BRANCH=${SYSTEM_CHART_DEFAULT_BRANCH:-\"release-v2.9\"}\n",
+			wantErr: ErrKeyNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SetEnvFileVar(tt.key, tt.value)([]byte(tt.in))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("SetEnvFileVar() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("SetEnvFileVar() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetGoModRequire(t *testing.T) {
+	const goMod = `module github.com/rancher/cli
+
+go 1.22
+
+require (
+	github.com/rancher/norman v0.0.0-20240708202514-a0127673d1b9
+	github.com/rancher/rancher/pkg/apis v0.0.0-20240719121207-baeda6b89fe3
+	github.com/rancher/rancher/pkg/client v0.0.0-20240719121207-baeda6b89fe3
+)
+`
+	const want = `module github.com/rancher/cli
+
+go 1.22
+
+require (
+	github.com/rancher/norman v0.0.0-20240708202514-a0127673d1b9
+	github.com/rancher/rancher/pkg/apis v0.0.0-20240919204204-3da2ae0cabd1
+	github.com/rancher/rancher/pkg/client v0.0.0-20240919204204-3da2ae0cabd1
+)
+`
+
+	got, err := SetGoModRequire(map[string]string{
+		"github.com/rancher/rancher/pkg/apis":   "v0.0.0-20240919204204-3da2ae0cabd1",
+		"github.com/rancher/rancher/pkg/client": "v0.0.0-20240919204204-3da2ae0cabd1",
+	})([]byte(goMod))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("SetGoModRequire() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,283 @@
+package repository
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+const upstreamRemoteName = "upstream"
+
+// FileEdit edits a file of the worktree, Path is relative to the worktree root
+type FileEdit struct {
+	Path string
+	// Optional edits are skipped when the file doesn't exist or the editor
+	// returns ErrKeyNotFound
+	Optional bool
+	Edit     func([]byte) ([]byte, error)
+}
+
+// UpdateBranchOpts configure UpdateBranch
+type UpdateBranchOpts struct {
+	// Dir is in the worktree of the local clone, its origin remote is pushed to
+	Dir            string
+	UpstreamURL    string
+	UpstreamBranch string
+	Branch         string
+	CommitMessage  string
+	Edits          []FileEdit
+	// AfterEdit runs in the worktree once the edits are applied, e.g. go mod tidy
+	AfterEdit func(dir string) error
+	// Auth is used to push to origin when it's an http remote, ssh remotes use the ssh agent
+	Auth   transport.AuthMethod
+	DryRun bool
+}
+
+// UpdateBranch recreates the branch from the upstream branch, applies the edits and
+// commits the changed files signed off by the git user. The branch is force pushed to
+// origin unless it's a dry run. The returned diff is the patch of the commit.
+func UpdateBranch(opts *UpdateBranchOpts) (string, error) {
+	r, err := git.PlainOpenWithOptions(opts.Dir, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return "", errors.New("failed to open the git repository at " + opts.Dir + ": " + err.Error())
+	}
+
+	w, err := r.Worktree()
+	if err != nil {
+		return "", err
+	}
+
+	root := w.Filesystem.Root()
+
+	if err := requireCleanWorktree(w); err != nil {
+		return "", err
+	}
+
+	upstreamHash, err := fetchUpstreamBranch(r, opts.UpstreamURL, opts.UpstreamBranch)
+	if err != nil {
+		return "", err
+	}
+
+	branchRef := plumbing.NewBranchReferenceName(opts.Branch)
+	if err := r.Storer.SetReference(plumbing.NewHashReference(branchRef, upstreamHash)); err != nil {
+		return "", err
+	}
+	if err := w.Checkout(&git.CheckoutOptions{Branch: branchRef, Force: true}); err != nil {
+		return "", errors.New("failed checkout: " + err.Error())
+	}
+
+	for _, edit := range opts.Edits {
+		if err := editFile(root, edit); err != nil {
+			return "", errors.New("failed to edit " + edit.Path + ": " + err.Error())
+		}
+	}
+
+	if opts.AfterEdit != nil {
+		if err := opts.AfterEdit(root); err != nil {
+			return "", err
+		}
+	}
+
+	if err := stageChanges(w); err != nil {
+		return "", err
+	}
+
+	signature, err := userSignature(r)
+	if err != nil {
+		return "", err
+	}
+
+	message := opts.CommitMessage + "\n\nSigned-off-by: " + signature.Name + " <" + signature.Email + ">\n"
+	hash, err := w.Commit(message, &git.CommitOptions{Author: signature})
+	if err != nil {
+		return "", err
+	}
+
+	diff, err := commitDiff(r, hash)
+	if err != nil {
+		return "", err
+	}
+
+	if opts.DryRun {
+		return diff, nil
+	}
+
+	if err := pushBranch(r, opts.Branch, opts.Auth); err != nil {
+		return "", errors.New("failed to push " + opts.Branch + " to origin: " + err.Error())
+	}
+
+	return diff, nil
+}
+
+// requireCleanWorktree fails when tracked files have uncommitted changes, untracked files are ignored
+func requireCleanWorktree(w *git.Worktree) error {
+	status, err := w.Status()
+	if err != nil {
+		return err
+	}
+
+	var changed []string
+	for file, s := range status {
+		if s.Worktree == git.Untracked {
+			continue
+		}
+		if s.Worktree != git.Unmodified || s.Staging != git.Unmodified {
+			changed = append(changed, file)
+		}
+	}
+	if len(changed) > 0 {
+		return errors.New("the worktree has uncommitted changes, commit or stash them first: " + strings.Join(changed, ", "))
+	}
+
+	return nil
+}
+
+// fetchUpstreamBranch adds the upstream remote if it doesn't exist and fetches the branch from it
+func fetchUpstreamBranch(r *git.Repository, upstreamURL, branch string) (plumbing.Hash, error) {
+	if _, err := r.CreateRemote(&config.RemoteConfig{
+		Name: upstreamRemoteName,
+		URLs: []string{upstreamURL},
+	}); err != nil && err != git.ErrRemoteExists {
+		return plumbing.ZeroHash, err
+	}
+
+	refSpec := "+refs/heads/" + branch + ":refs/remotes/" + upstreamRemoteName + "/" + branch
+	if err := r.Fetch(&git.FetchOptions{
+		RemoteName: upstreamRemoteName,
+		RefSpecs:   []config.RefSpec{config.RefSpec(refSpec)},
+	}); err != nil && err != git.NoErrAlreadyUpToDate {
+		return plumbing.ZeroHash, errors.New("failed to fetch " + branch + " from " + upstreamRemoteName + ": " + err.Error())
+	}
+
+	ref, err := r.Reference(plumbing.NewRemoteReferenceName(upstreamRemoteName, branch), true)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return ref.Hash(), nil
+}
+
+func editFile(dir string, edit FileEdit) error {
+	path := filepath.Join(dir, filepath.FromSlash(edit.Path))
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if edit.Optional && os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	edited, err := edit.Edit(b)
+	if err != nil {
+		if edit.Optional && errors.Is(err, ErrKeyNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	return os.WriteFile(path, edited, info.Mode())
+}
+
+// stageChanges stages the modified and deleted tracked files
+func stageChanges(w *git.Worktree) error {
+	status, err := w.Status()
+	if err != nil {
+		return err
+	}
+
+	var staged int
+	for file, s := range status {
+		if s.Worktree != git.Modified && s.Worktree != git.Deleted {
+			continue
+		}
+		if _, err := w.Add(file); err != nil {
+			return err
+		}
+		staged++
+	}
+	if staged == 0 {
+		return errors.New("no changes to commit, the files are already up to date")
+	}
+
+	return nil
+}
+
+// userSignature returns the signature of the git user set in the repository or global config
+func userSignature(r *git.Repository) (*object.Signature, error) {
+	cfg, err := r.ConfigScoped(config.GlobalScope)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.User.Name == "" || cfg.User.Email == "" {
+		return nil, errors.New("git user.name and user.email must be set to sign off the commit")
+	}
+
+	return &object.Signature{
+		Name:  cfg.User.Name,
+		Email: cfg.User.Email,
+		When:  time.Now(),
+	}, nil
+}
+
+// commitDiff returns the patch between the commit and its parent
+func commitDiff(r *git.Repository, hash plumbing.Hash) (string, error) {
+	commit, err := r.CommitObject(hash)
+	if err != nil {
+		return "", err
+	}
+
+	parent, err := commit.Parent(0)
+	if err != nil {
+		return "", err
+	}
+
+	patch, err := parent.Patch(commit)
+	if err != nil {
+		return "", err
+	}
+
+	return patch.String(), nil
+}
+
+func pushBranch(r *git.Repository, branch string, auth transport.AuthMethod) error {
+	origin, err := r.Remote("origin")
+	if err != nil {
+		return err
+	}
+
+	opts := &git.PushOptions{
+		RemoteName: "origin",
+		RefSpecs:   []config.RefSpec{config.RefSpec("+refs/heads/" + branch + ":refs/heads/" + branch)},
+	}
+	if url := origin.Config().URLs[0]; strings.HasPrefix(url, "https://") || strings.HasPrefix(url, "http://") {
+		opts.Auth = auth
+	}
+
+	if err := r.Push(opts); err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+
+	if err := r.CreateBranch(&config.Branch{
+		Name:   branch,
+		Remote: "origin",
+		Merge:  plumbing.NewBranchReferenceName(branch),
+	}); err != nil && err != git.ErrBranchExists {
+		return err
+	}
+
+	return nil
+}
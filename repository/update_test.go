@@ -0,0 +1,235 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const (
+	fixtureBranch     = "release/v2.9"
+	fixtureDockerfile = "FROM registry.suse.com/bci/bci-micro:15.6\nENV CATTLE_UI_VERSION=2.9.2\nENV CATTLE_DASHBOARD_UI_VERSION=v2.9.2\nENV CATTLE_CLI_VERSION=v2.9.0\n"
+)
+
+// fixtureRepos creates an upstream repository with a release branch, a bare origin
+// and an empty local repository whose origin remote is the bare repository
+func fixtureRepos(t *testing.T) (upstream, origin, clone string) {
+	t.Helper()
+
+	upstream = t.TempDir()
+	r, err := git.PlainInit(upstream, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(upstream, "package"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(upstream, "package", "Dockerfile"), []byte(fixtureDockerfile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Add("package/Dockerfile"); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := w.Commit("initial commit", &git.CommitOptions{
+		Author: &object.Signature{Name: "upstream", Email: "upstream@example.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName(fixtureBranch), hash)); err != nil {
+		t.Fatal(err)
+	}
+
+	origin = t.TempDir()
+	if _, err := git.PlainInit(origin, true); err != nil {
+		t.Fatal(err)
+	}
+
+	clone = t.TempDir()
+	cr, err := git.PlainInit(clone, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cr.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{origin}}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := cr.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.User.Name = "Release Captain"
+	cfg.User.Email = "captain@example.com"
+	if err := cr.SetConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	return upstream, origin, clone
+}
+
+func TestUpdateBranch(t *testing.T) {
+	tests := []struct {
+		name   string
+		dryRun bool
+	}{
+		{name: "dry run", dryRun: true},
+		{name: "push", dryRun: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream, origin, clone := fixtureRepos(t)
+
+			diff, err := UpdateBranch(&UpdateBranchOpts{
+				Dir:            clone,
+				UpstreamURL:    upstream,
+				UpstreamBranch: fixtureBranch,
+				Branch:         "update-dashboard-refs-v2.9.3",
+				CommitMessage:  "Update Dashboard refs to v2.9.3",
+				Edits: []FileEdit{
+					{Path: "package/Dockerfile", Edit: SetDockerfileEnv("CATTLE_UI_VERSION", "2.9.3")},
+					{Path: "package/Dockerfile", Edit: SetDockerfileEnv("CATTLE_DASHBOARD_UI_VERSION", "v2.9.3")},
+					{Path: "scripts/package-env", Optional: true, Edit: SetEnvFileVar("CATTLE_UI_VERSION", "2.9.3")},
+				},
+				DryRun: tt.dryRun,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, line := range []string{
+				"-ENV CATTLE_UI_VERSION=2.9.2",
+				"+ENV CATTLE_UI_VERSION=2.9.3",
+				"-ENV CATTLE_DASHBOARD_UI_VERSION=v2.9.2",
+				"+ENV CATTLE_DASHBOARD_UI_VERSION=v2.9.3",
+			} {
+				if !strings.Contains(diff, line+"\n") {
+					t.Errorf("diff doesn't contain %q:\n%s", line, diff)
+				}
+			}
+			if strings.Contains(diff, "-ENV CATTLE_CLI_VERSION") || strings.Contains(diff, "+ENV CATTLE_CLI_VERSION") {
+				t.Errorf("diff changes an unedited line:\n%s", diff)
+			}
+
+			cr, err := git.PlainOpen(clone)
+			if err != nil {
+				t.Fatal(err)
+			}
+			head, err := cr.Head()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if head.Name() != plumbing.NewBranchReferenceName("update-dashboard-refs-v2.9.3") {
+				t.Errorf("HEAD = %s, want the update branch", head.Name())
+			}
+			commit, err := cr.CommitObject(head.Hash())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "Update Dashboard refs to v2.9.3\n\nSigned-off-by: Release Captain <captain@example.com>\n"; commit.Message != want {
+				t.Errorf("commit message = %q, want %q", commit.Message, want)
+			}
+
+			or, err := git.PlainOpen(origin)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pushed, err := or.Reference(plumbing.NewBranchReferenceName("update-dashboard-refs-v2.9.3"), true)
+			if tt.dryRun {
+				if err != plumbing.ErrReferenceNotFound {
+					t.Errorf("dry run pushed the branch: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pushed.Hash() != head.Hash() {
+				t.Errorf("pushed %s, want %s", pushed.Hash(), head.Hash())
+			}
+		})
+	}
+}
+
+func TestUpdateBranchErrors(t *testing.T) {
+	t.Run("uncommitted changes", func(t *testing.T) {
+		upstream, _, clone := fixtureRepos(t)
+
+		cr, err := git.PlainOpen(clone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cr.CreateRemote(&config.RemoteConfig{Name: "upstream", URLs: []string{upstream}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := cr.Fetch(&git.FetchOptions{RemoteName: "upstream"}); err != nil {
+			t.Fatal(err)
+		}
+		w, err := cr.Worktree()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Checkout(&git.CheckoutOptions{
+			Branch: plumbing.NewBranchReferenceName("work"),
+			Hash:   mustResolve(t, cr, "refs/remotes/upstream/"+fixtureBranch),
+			Create: true,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(clone, "package", "Dockerfile"), []byte("FROM scratch\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = UpdateBranch(&UpdateBranchOpts{
+			Dir:            clone,
+			UpstreamURL:    upstream,
+			UpstreamBranch: fixtureBranch,
+			Branch:         "update-cli-build-refs-v2.9.3",
+			CommitMessage:  "Update CLI refs to v2.9.3",
+			DryRun:         true,
+		})
+		if err == nil || !strings.Contains(err.Error(), "uncommitted changes") {
+			t.Errorf("UpdateBranch() error = %v, want uncommitted changes", err)
+		}
+	})
+
+	t.Run("already up to date", func(t *testing.T) {
+		upstream, _, clone := fixtureRepos(t)
+
+		_, err := UpdateBranch(&UpdateBranchOpts{
+			Dir:            clone,
+			UpstreamURL:    upstream,
+			UpstreamBranch: fixtureBranch,
+			Branch:         "update-cli-build-refs-v2.9.0",
+			CommitMessage:  "Update CLI refs to v2.9.0",
+			Edits: []FileEdit{
+				{Path: "package/Dockerfile", Edit: SetDockerfileEnv("CATTLE_CLI_VERSION", "v2.9.0")},
+			},
+			DryRun: true,
+		})
+		if err == nil || !strings.Contains(err.Error(), "no changes to commit") {
+			t.Errorf("UpdateBranch() error = %v, want no changes to commit", err)
+		}
+	})
+}
+
+func mustResolve(t *testing.T, r *git.Repository, name string) plumbing.Hash {
+	t.Helper()
+
+	ref, err := r.Reference(plumbing.ReferenceName(name), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ref.Hash()
+}
@@ -0,0 +1,166 @@
+package signature
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// bundleSuffixes are the suffixes of the signature bundle files published next to release assets
+var bundleSuffixes = []string{".sigstore.json", ".sigstore", ".bundle"}
+
+func isBundle(name string) bool {
+	for _, suffix := range bundleSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// VerifyAssets verifies the signature bundles of the assets in the filesystem matching any of
+// the given patterns. Assets are streamed concurrently, with at most concurrencyLimit at a time.
+func (v *Verifier) VerifyAssets(ctx context.Context, fsys fs.FS, patterns []string, concurrencyLimit int) ([]Result, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() || isBundle(entry.Name()) {
+			continue
+		}
+		for _, pattern := range patterns {
+			ok, err := path.Match(pattern, entry.Name())
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				names = append(names, entry.Name())
+				break
+			}
+		}
+	}
+
+	var mu sync.Mutex
+	results := make([]Result, 0, len(names))
+
+	errGroup, ctx := errgroup.WithContext(ctx)
+	errGroup.SetLimit(concurrencyLimit)
+
+	for _, name := range names {
+		name := name
+		errGroup.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			result, err := v.verifyAsset(fsys, name)
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			results = append(results, *result)
+			mu.Unlock()
+
+			return nil
+		})
+	}
+	if err := errGroup.Wait(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Subject < results[j].Subject
+	})
+
+	return results, nil
+}
+
+func (v *Verifier) verifyAsset(fsys fs.FS, name string) (*Result, error) {
+	result := Result{
+		Subject:      name,
+		Attestations: make([]string, 0),
+	}
+
+	var bundles []*bundle
+	for _, suffix := range bundleSuffixes {
+		b, err := fs.ReadFile(fsys, name+suffix)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+
+		bdl, err := parseBundle(b)
+		if err != nil {
+			result.Errors = append(result.Errors, name+suffix+": "+err.Error())
+			continue
+		}
+		bundles = append(bundles, bdl)
+	}
+	if len(bundles) == 0 {
+		result.Errors = append(result.Errors, "no signature bundle found")
+		return &result, nil
+	}
+
+	digest, err := assetDigest(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	result.Digest = hexDigest(digest)
+
+	for _, bdl := range bundles {
+		if bdl.envelope != nil {
+			_, predicateType, err := v.verifyEnvelope(bdl.material, bdl.envelope, digest)
+			if err != nil {
+				result.Errors = append(result.Errors, err.Error())
+				continue
+			}
+			result.Attestations = mergeAttestations(result.Attestations, []string{predicateType})
+			continue
+		}
+
+		if bdl.digest != nil && hex.EncodeToString(bdl.digest) != hex.EncodeToString(digest) {
+			result.Errors = append(result.Errors, "bundle message digest doesn't match "+result.Digest)
+			continue
+		}
+		signer, err := v.verifyDigest(bdl.material, digest, bdl.signature)
+		if err != nil {
+			result.Errors = append(result.Errors, err.Error())
+			continue
+		}
+		result.Signed = true
+		result.Signer = signer
+	}
+
+	return &result, nil
+}
+
+func assetDigest(fsys fs.FS, name string) ([]byte, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,158 @@
+package signature
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+	"testing/fstest"
+)
+
+func newTestKey(t *testing.T) (*ecdsa.PrivateKey, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func sign(t *testing.T, key *ecdsa.PrivateKey, b []byte) []byte {
+	t.Helper()
+
+	sig, err := ecdsa.SignASN1(rand.Reader, key, sha256Sum(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sig
+}
+
+func marshal(t *testing.T, v interface{}) []byte {
+	t.Helper()
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func TestVerifyAssets(t *testing.T) {
+	key, publicKey := newTestKey(t)
+	otherKey, _ := newTestKey(t)
+
+	asset := []byte("rke2 binary")
+
+	cosignBundle := func(key *ecdsa.PrivateKey) []byte {
+		return marshal(t, map[string]string{
+			"base64Signature": base64.StdEncoding.EncodeToString(sign(t, key, asset)),
+		})
+	}
+
+	statement := marshal(t, map[string]interface{}{
+		"_type": "https://in-toto.io/Statement/v1",
+		"subject": []map[string]interface{}{
+			{"name": "rke2", "digest": map[string]string{"sha256": hexDigest(sha256Sum(asset))[len("sha256:"):]}},
+		},
+		"predicateType": "https://slsa.dev/provenance/v1",
+	})
+	sigstoreBundle := marshal(t, map[string]interface{}{
+		"mediaType": "application/vnd.dev.sigstore.bundle.v0.3+json",
+		"dsseEnvelope": map[string]interface{}{
+			"payloadType": inTotoPayloadType,
+			"payload":     statement,
+			"signatures":  []map[string]interface{}{{"sig": sign(t, key, pae(inTotoPayloadType, statement))}},
+		},
+	})
+
+	verifier, err := NewVerifier([][]byte{publicKey}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("NewVerifier() error = %v", err)
+	}
+
+	tests := []struct {
+		name             string
+		fsys             fstest.MapFS
+		wantSigned       bool
+		wantAttestations int
+		wantErrors       int
+	}{
+		{
+			name: "signed with trusted key",
+			fsys: fstest.MapFS{
+				"rke2":        {Data: asset},
+				"rke2.bundle": {Data: cosignBundle(key)},
+			},
+			wantSigned: true,
+		},
+		{
+			name: "signed and attested",
+			fsys: fstest.MapFS{
+				"rke2":               {Data: asset},
+				"rke2.bundle":        {Data: cosignBundle(key)},
+				"rke2.sigstore.json": {Data: sigstoreBundle},
+			},
+			wantSigned:       true,
+			wantAttestations: 1,
+		},
+		{
+			name: "signed with untrusted key",
+			fsys: fstest.MapFS{
+				"rke2":        {Data: asset},
+				"rke2.bundle": {Data: cosignBundle(otherKey)},
+			},
+			wantErrors: 1,
+		},
+		{
+			name: "tampered asset",
+			fsys: fstest.MapFS{
+				"rke2":        {Data: []byte("tampered")},
+				"rke2.bundle": {Data: cosignBundle(key)},
+			},
+			wantErrors: 1,
+		},
+		{
+			name: "no bundle",
+			fsys: fstest.MapFS{
+				"rke2": {Data: asset},
+			},
+			wantErrors: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := verifier.VerifyAssets(context.Background(), tt.fsys, []string{"rke2*"}, 2)
+			if err != nil {
+				t.Fatalf("VerifyAssets() error = %v", err)
+			}
+			if len(results) != 1 {
+				t.Fatalf("VerifyAssets() returned %d results, want 1", len(results))
+			}
+
+			result := results[0]
+			if result.Signed != tt.wantSigned {
+				t.Errorf("Signed = %v, want %v", result.Signed, tt.wantSigned)
+			}
+			if len(result.Attestations) != tt.wantAttestations {
+				t.Errorf("Attestations = %v, want %d", result.Attestations, tt.wantAttestations)
+			}
+			if len(result.Errors) != tt.wantErrors {
+				t.Errorf("Errors = %v, want %d", result.Errors, tt.wantErrors)
+			}
+		})
+	}
+}
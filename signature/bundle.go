@@ -0,0 +1,275 @@
+package signature
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	bundleMediaTypePrefix = "application/vnd.dev.sigstore.bundle"
+	inTotoPayloadType     = "application/vnd.in-toto+json"
+)
+
+// jsonInt decodes integers encoded either as JSON numbers or strings, as protobuf encodes int64
+type jsonInt int64
+
+func (i *jsonInt) UnmarshalJSON(b []byte) error {
+	n, err := strconv.ParseInt(strings.Trim(string(b), `"`), 10, 64)
+	if err != nil {
+		return err
+	}
+	*i = jsonInt(n)
+
+	return nil
+}
+
+type rawBytes struct {
+	RawBytes []byte `json:"rawBytes"`
+}
+
+// sigstoreBundle is a sigstore bundle, as produced by cosign with --new-bundle-format
+// and by GitHub artifact attestations
+type sigstoreBundle struct {
+	MediaType            string `json:"mediaType"`
+	VerificationMaterial struct {
+		Certificate          *rawBytes `json:"certificate"`
+		X509CertificateChain *struct {
+			Certificates []rawBytes `json:"certificates"`
+		} `json:"x509CertificateChain"`
+		TlogEntries []struct {
+			LogIndex jsonInt `json:"logIndex"`
+			LogID    struct {
+				KeyID []byte `json:"keyId"`
+			} `json:"logId"`
+			IntegratedTime   jsonInt `json:"integratedTime"`
+			InclusionPromise *struct {
+				SignedEntryTimestamp []byte `json:"signedEntryTimestamp"`
+			} `json:"inclusionPromise"`
+			CanonicalizedBody []byte `json:"canonicalizedBody"`
+		} `json:"tlogEntries"`
+	} `json:"verificationMaterial"`
+	MessageSignature *struct {
+		MessageDigest struct {
+			Algorithm string `json:"algorithm"`
+			Digest    []byte `json:"digest"`
+		} `json:"messageDigest"`
+		Signature []byte `json:"signature"`
+	} `json:"messageSignature"`
+	DSSEEnvelope *envelope `json:"dsseEnvelope"`
+}
+
+// cosignBundle is the bundle written by cosign sign-blob --bundle
+type cosignBundle struct {
+	Base64Signature string       `json:"base64Signature"`
+	Cert            string       `json:"cert"`
+	RekorBundle     *rekorBundle `json:"rekorBundle"`
+}
+
+// rekorBundle is the transparency log entry of cosign bundles and signature layer annotations
+type rekorBundle struct {
+	SignedEntryTimestamp []byte `json:"SignedEntryTimestamp"`
+	Payload              struct {
+		Body           []byte  `json:"body"`
+		IntegratedTime jsonInt `json:"integratedTime"`
+		LogIndex       jsonInt `json:"logIndex"`
+		LogID          string  `json:"logID"`
+	} `json:"Payload"`
+}
+
+func (rb *rekorBundle) tlogEntry() *tlogEntry {
+	return &tlogEntry{
+		body:                 rb.Payload.Body,
+		integratedTime:       int64(rb.Payload.IntegratedTime),
+		logIndex:             int64(rb.Payload.LogIndex),
+		logID:                rb.Payload.LogID,
+		signedEntryTimestamp: rb.SignedEntryTimestamp,
+	}
+}
+
+// envelope is a DSSE envelope
+type envelope struct {
+	PayloadType string `json:"payloadType"`
+	Payload     []byte `json:"payload"`
+	Signatures  []struct {
+		KeyID string `json:"keyid"`
+		Sig   []byte `json:"sig"`
+	} `json:"signatures"`
+}
+
+// statement is an in-toto attestation statement
+type statement struct {
+	Type    string `json:"_type"`
+	Subject []struct {
+		Name   string            `json:"name"`
+		Digest map[string]string `json:"digest"`
+	} `json:"subject"`
+	PredicateType string `json:"predicateType"`
+}
+
+// bundle is a signature or an attestation along with its verification material,
+// regardless of the format it was distributed in
+type bundle struct {
+	material material
+	// digest is the SHA-256 digest the signature is over, nil when unknown
+	digest    []byte
+	signature []byte
+	envelope  *envelope
+}
+
+// parseBundle parses both sigstore and cosign bundles
+func parseBundle(b []byte) (*bundle, error) {
+	var sb sigstoreBundle
+	if err := json.Unmarshal(b, &sb); err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(sb.MediaType, bundleMediaTypePrefix) {
+		return sb.bundle()
+	}
+
+	var cb cosignBundle
+	if err := json.Unmarshal(b, &cb); err != nil {
+		return nil, err
+	}
+	if cb.Base64Signature == "" {
+		return nil, errors.New("unknown bundle format")
+	}
+
+	return cb.bundle()
+}
+
+func (sb *sigstoreBundle) bundle() (*bundle, error) {
+	var bdl bundle
+
+	vm := sb.VerificationMaterial
+	var certificates [][]byte
+	switch {
+	case vm.Certificate != nil:
+		certificates = [][]byte{vm.Certificate.RawBytes}
+	case vm.X509CertificateChain != nil:
+		for _, certificate := range vm.X509CertificateChain.Certificates {
+			certificates = append(certificates, certificate.RawBytes)
+		}
+	}
+	for i, certificate := range certificates {
+		cert, err := parseCertificate(certificate)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			bdl.material.certificate = cert
+			continue
+		}
+		bdl.material.intermediates = append(bdl.material.intermediates, cert)
+	}
+	if len(vm.TlogEntries) > 0 {
+		entry := vm.TlogEntries[0]
+		bdl.material.tlogEntry = &tlogEntry{
+			body:           entry.CanonicalizedBody,
+			integratedTime: int64(entry.IntegratedTime),
+			logIndex:       int64(entry.LogIndex),
+			logID:          hex.EncodeToString(entry.LogID.KeyID),
+		}
+		if entry.InclusionPromise != nil {
+			bdl.material.tlogEntry.signedEntryTimestamp = entry.InclusionPromise.SignedEntryTimestamp
+		}
+	}
+
+	switch {
+	case sb.MessageSignature != nil:
+		if sb.MessageSignature.MessageDigest.Algorithm != "SHA2_256" {
+			return nil, errors.New("unsupported message digest algorithm: " + sb.MessageSignature.MessageDigest.Algorithm)
+		}
+		bdl.digest = sb.MessageSignature.MessageDigest.Digest
+		bdl.signature = sb.MessageSignature.Signature
+	case sb.DSSEEnvelope != nil:
+		bdl.envelope = sb.DSSEEnvelope
+	default:
+		return nil, errors.New("bundle has neither a message signature nor a DSSE envelope")
+	}
+
+	return &bdl, nil
+}
+
+func (cb *cosignBundle) bundle() (*bundle, error) {
+	var bdl bundle
+
+	sig, err := base64.StdEncoding.DecodeString(cb.Base64Signature)
+	if err != nil {
+		return nil, err
+	}
+	bdl.signature = sig
+
+	if cb.Cert != "" {
+		certificate, err := base64.StdEncoding.DecodeString(cb.Cert)
+		if err != nil {
+			return nil, err
+		}
+		cert, err := parseCertificate(certificate)
+		if err != nil {
+			return nil, err
+		}
+		bdl.material.certificate = cert
+	}
+	if cb.RekorBundle != nil {
+		bdl.material.tlogEntry = cb.RekorBundle.tlogEntry()
+	}
+
+	return &bdl, nil
+}
+
+// pae returns the DSSE pre-authentication encoding of a payload
+func pae(payloadType string, payload []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("DSSEv1 ")
+	b.WriteString(strconv.Itoa(len(payloadType)) + " " + payloadType + " ")
+	b.WriteString(strconv.Itoa(len(payload)) + " ")
+	b.Write(payload)
+
+	return b.Bytes()
+}
+
+// verifyEnvelope verifies the signatures of a DSSE envelope containing an in-toto
+// statement about the given subject digest, returning the signer and predicate type.
+func (v *Verifier) verifyEnvelope(m material, env *envelope, subject []byte) (string, string, error) {
+	if env.PayloadType != inTotoPayloadType {
+		return "", "", errors.New("unsupported envelope payload type: " + env.PayloadType)
+	}
+
+	digest := sha256Sum(pae(env.PayloadType, env.Payload))
+
+	var (
+		signer string
+		err    error
+	)
+	for _, sig := range env.Signatures {
+		if signer, err = v.verifyDigest(m, digest, sig.Sig); err == nil {
+			break
+		}
+	}
+	if signer == "" {
+		if err == nil {
+			err = errors.New("envelope has no signatures")
+		}
+		return "", "", err
+	}
+
+	var st statement
+	if err := json.Unmarshal(env.Payload, &st); err != nil {
+		return "", "", err
+	}
+
+	subjectHex := hex.EncodeToString(subject)
+	for _, s := range st.Subject {
+		if s.Digest["sha256"] == subjectHex {
+			return signer, st.PredicateType, nil
+		}
+	}
+
+	return "", "", errors.New("attestation subject doesn't match " + hexDigest(subject))
+}
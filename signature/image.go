@@ -0,0 +1,390 @@
+package signature
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+const (
+	simpleSigningMediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+	dsseMediaType          = "application/vnd.dsse.envelope.v1+json"
+	signatureAnnotation    = "dev.cosignproject.cosign/signature"
+	certificateAnnotation  = "dev.sigstore.cosign/certificate"
+	chainAnnotation        = "dev.sigstore.cosign/chain"
+	bundleAnnotation       = "dev.sigstore.cosign/bundle"
+)
+
+// Result is the verification result of an image, one of its platforms or a release asset
+type Result struct {
+	Subject      string   `json:"subject"`
+	Platform     string   `json:"platform,omitempty"`
+	Digest       string   `json:"digest,omitempty"`
+	Signed       bool     `json:"signed"`
+	Signer       string   `json:"signer,omitempty"`
+	Attestations []string `json:"attestations"`
+	Errors       []string `json:"errors,omitempty"`
+}
+
+// simpleSigning is the payload signed by cosign for container images
+type simpleSigning struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+	} `json:"critical"`
+}
+
+// ImageVerifier verifies cosign signatures and attestations of container images, stored
+// either with the .sig and .att tag conventions or as referrers of the image
+type ImageVerifier struct {
+	verifier *Verifier
+	options  []remote.Option
+}
+
+// NewImageVerifier creates an image verifier, the remote options are used
+// to configure authentication and transports for the registry.
+func NewImageVerifier(verifier *Verifier, options ...remote.Option) *ImageVerifier {
+	return &ImageVerifier{
+		verifier: verifier,
+		options:  options,
+	}
+}
+
+// VerifyImage verifies the signatures and attestations of an image. Multi-arch images
+// return a result for the index and one for each platform, platforms are considered
+// signed if either the index or the platform manifest is signed.
+func (i *ImageVerifier) VerifyImage(ctx context.Context, ref name.Reference) ([]Result, error) {
+	options := append([]remote.Option{remote.WithContext(ctx)}, i.options...)
+
+	desc, err := remote.Get(ref, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	repo := ref.Context()
+
+	result := Result{
+		Subject: ref.String(),
+		Digest:  desc.Digest.String(),
+	}
+	if err := i.verifySubject(repo, desc.Digest, &result, options); err != nil {
+		return nil, err
+	}
+
+	if !desc.MediaType.IsIndex() {
+		img, err := desc.Image()
+		if err != nil {
+			return nil, err
+		}
+		cfg, err := img.ConfigFile()
+		if err != nil {
+			return nil, err
+		}
+		if platform := cfg.Platform(); platform != nil {
+			result.Platform = platform.String()
+		}
+
+		return []Result{result}, nil
+	}
+
+	idx, err := desc.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	results := []Result{result}
+	for _, m := range manifest.Manifests {
+		// skip attestation manifests stored in the index, e.g. by buildkit
+		if m.Platform == nil || m.Platform.OS == "unknown" {
+			continue
+		}
+
+		platformResult := Result{
+			Subject:  ref.String(),
+			Platform: m.Platform.String(),
+			Digest:   m.Digest.String(),
+		}
+		if err := i.verifySubject(repo, m.Digest, &platformResult, options); err != nil {
+			return nil, err
+		}
+
+		if !platformResult.Signed && result.Signed {
+			platformResult.Signed = true
+			platformResult.Signer = result.Signer
+		}
+		platformResult.Attestations = mergeAttestations(platformResult.Attestations, result.Attestations)
+
+		results = append(results, platformResult)
+	}
+
+	return results, nil
+}
+
+// verifySubject looks for signatures and attestations of a manifest digest and records them in the result
+func (i *ImageVerifier) verifySubject(repo name.Repository, digest v1.Hash, result *Result, options []remote.Option) error {
+	subject, err := hex.DecodeString(digest.Hex)
+	if err != nil {
+		return err
+	}
+
+	tagPrefix := digest.Algorithm + "-" + digest.Hex
+
+	sigLayers, err := i.layers(repo.Tag(tagPrefix+".sig"), options)
+	if err != nil {
+		return err
+	}
+	for _, layer := range sigLayers {
+		if layer.mediaType != simpleSigningMediaType {
+			continue
+		}
+		signer, err := i.verifySimpleSigning(layer, digest)
+		if err != nil {
+			result.Errors = append(result.Errors, err.Error())
+			continue
+		}
+		result.Signed = true
+		result.Signer = signer
+	}
+
+	attLayers, err := i.layers(repo.Tag(tagPrefix+".att"), options)
+	if err != nil {
+		return err
+	}
+	for _, layer := range attLayers {
+		if layer.mediaType != dsseMediaType {
+			continue
+		}
+		var env envelope
+		if err := json.Unmarshal(layer.content, &env); err != nil {
+			result.Errors = append(result.Errors, err.Error())
+			continue
+		}
+		_, predicateType, err := i.verifier.verifyEnvelope(layer.material, &env, subject)
+		if err != nil {
+			result.Errors = append(result.Errors, err.Error())
+			continue
+		}
+		result.Attestations = mergeAttestations(result.Attestations, []string{predicateType})
+	}
+
+	bundles, err := i.referrerBundles(repo, digest, options)
+	if err != nil {
+		return err
+	}
+	for _, bdl := range bundles {
+		if bdl.envelope != nil {
+			_, predicateType, err := i.verifier.verifyEnvelope(bdl.material, bdl.envelope, subject)
+			if err != nil {
+				result.Errors = append(result.Errors, err.Error())
+				continue
+			}
+			result.Attestations = mergeAttestations(result.Attestations, []string{predicateType})
+			continue
+		}
+
+		if hex.EncodeToString(bdl.digest) != digest.Hex {
+			result.Errors = append(result.Errors, "bundle message digest doesn't match "+digest.String())
+			continue
+		}
+		signer, err := i.verifier.verifyDigest(bdl.material, bdl.digest, bdl.signature)
+		if err != nil {
+			result.Errors = append(result.Errors, err.Error())
+			continue
+		}
+		result.Signed = true
+		result.Signer = signer
+	}
+
+	if result.Attestations == nil {
+		result.Attestations = make([]string, 0)
+	}
+
+	return nil
+}
+
+// signatureLayer is a layer of a cosign signature or attestation image
+type signatureLayer struct {
+	mediaType  string
+	content    []byte
+	annotation map[string]string
+	material   material
+}
+
+// layers returns the layers of a cosign signature or attestation image, nil if the tag doesn't exist
+func (i *ImageVerifier) layers(tag name.Tag, options []remote.Option) ([]signatureLayer, error) {
+	img, err := remote.Image(tag, options...)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, err
+	}
+
+	layers := make([]signatureLayer, 0, len(manifest.Layers))
+	for _, desc := range manifest.Layers {
+		content, err := layerContent(img, desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+
+		layer := signatureLayer{
+			mediaType:  string(desc.MediaType),
+			content:    content,
+			annotation: desc.Annotations,
+		}
+
+		if certificate, ok := desc.Annotations[certificateAnnotation]; ok {
+			cert, err := parseCertificate([]byte(certificate))
+			if err != nil {
+				return nil, err
+			}
+			layer.material.certificate = cert
+		}
+		if chain, ok := desc.Annotations[chainAnnotation]; ok {
+			intermediates, err := parseCertificateChain([]byte(chain))
+			if err != nil {
+				return nil, err
+			}
+			layer.material.intermediates = intermediates
+		}
+		if b, ok := desc.Annotations[bundleAnnotation]; ok {
+			var rb rekorBundle
+			if err := json.Unmarshal([]byte(b), &rb); err != nil {
+				return nil, err
+			}
+			layer.material.tlogEntry = rb.tlogEntry()
+		}
+
+		layers = append(layers, layer)
+	}
+
+	return layers, nil
+}
+
+func (i *ImageVerifier) verifySimpleSigning(layer signatureLayer, digest v1.Hash) (string, error) {
+	sig, err := base64.StdEncoding.DecodeString(layer.annotation[signatureAnnotation])
+	if err != nil {
+		return "", err
+	}
+
+	signer, err := i.verifier.verifyDigest(layer.material, sha256Sum(layer.content), sig)
+	if err != nil {
+		return "", err
+	}
+
+	var payload simpleSigning
+	if err := json.Unmarshal(layer.content, &payload); err != nil {
+		return "", err
+	}
+	if payload.Critical.Image.DockerManifestDigest != digest.String() {
+		return "", errors.New("signed payload digest " + payload.Critical.Image.DockerManifestDigest + " doesn't match " + digest.String())
+	}
+
+	return signer, nil
+}
+
+// referrerBundles returns the sigstore bundles attached to a manifest as referrers
+func (i *ImageVerifier) referrerBundles(repo name.Repository, digest v1.Hash, options []remote.Option) ([]*bundle, error) {
+	idx, err := remote.Referrers(repo.Digest(digest.String()), options...)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	var bundles []*bundle
+	for _, m := range manifest.Manifests {
+		if !strings.HasPrefix(m.ArtifactType, bundleMediaTypePrefix) {
+			continue
+		}
+
+		img, err := remote.Image(repo.Digest(m.Digest.String()), options...)
+		if err != nil {
+			return nil, err
+		}
+		layers, err := img.Layers()
+		if err != nil {
+			return nil, err
+		}
+		if len(layers) == 0 {
+			continue
+		}
+		layerDigest, err := layers[0].Digest()
+		if err != nil {
+			return nil, err
+		}
+		content, err := layerContent(img, layerDigest)
+		if err != nil {
+			return nil, err
+		}
+
+		bdl, err := parseBundle(content)
+		if err != nil {
+			return nil, err
+		}
+		bundles = append(bundles, bdl)
+	}
+
+	return bundles, nil
+}
+
+func layerContent(img v1.Image, digest v1.Hash) ([]byte, error) {
+	layer, err := img.LayerByDigest(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	rc, err := layer.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return io.ReadAll(rc)
+}
+
+func isNotFound(err error) bool {
+	var transportErr *transport.Error
+	return errors.As(err, &transportErr) && transportErr.StatusCode == http.StatusNotFound
+}
+
+func mergeAttestations(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	merged := make([]string, 0, len(a)+len(b))
+	for _, s := range append(append([]string{}, a...), b...) {
+		if !seen[s] {
+			seen[s] = true
+			merged = append(merged, s)
+		}
+	}
+	sort.Strings(merged)
+
+	return merged
+}
@@ -0,0 +1,334 @@
+package signature
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+func newTestRegistry(t *testing.T) string {
+	t.Helper()
+
+	server := httptest.NewServer(registry.New(registry.WithReferrersSupport(true), registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(server.Close)
+
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+// platformImage returns a random image whose config is for the platform
+func platformImage(t *testing.T, os, arch string) v1.Image {
+	t.Helper()
+
+	img, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.OS = os
+	cfg.Architecture = arch
+	img, err = mutate.ConfigFile(img, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return img
+}
+
+func simpleSigningPayload(t *testing.T, digest v1.Hash) []byte {
+	t.Helper()
+
+	var payload simpleSigning
+	payload.Critical.Image.DockerManifestDigest = digest.String()
+
+	return marshal(t, payload)
+}
+
+// pushSignature pushes a cosign signature image for the subject digest, signed with the key
+// or with the certificate when it's set
+func pushSignature(t *testing.T, repo name.Repository, subject, signed v1.Hash, key *ecdsa.PrivateKey, chain []*x509.Certificate, rekor *testLog) {
+	t.Helper()
+
+	payload := simpleSigningPayload(t, signed)
+	sig := sign(t, key, payload)
+
+	annotations := map[string]string{signatureAnnotation: base64.StdEncoding.EncodeToString(sig)}
+	if len(chain) > 0 {
+		annotations[certificateAnnotation] = string(certificatePEM(chain[0]))
+		var intermediates []byte
+		for _, cert := range chain[1:] {
+			intermediates = append(intermediates, certificatePEM(cert)...)
+		}
+		annotations[chainAnnotation] = string(intermediates)
+		entry := rekor.entry(t, chain[0], sig, time.Now().Add(-2*time.Hour))
+		annotations[bundleAnnotation] = string(marshal(t, entry.rekorBundle()))
+	}
+
+	img, err := mutate.Append(empty.Image, mutate.Addendum{
+		Layer:       static.NewLayer(payload, simpleSigningMediaType),
+		Annotations: annotations,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(repo.Tag(subject.Algorithm+"-"+subject.Hex+".sig"), img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// pushAttestation pushes a cosign attestation image for the subject digest
+func pushAttestation(t *testing.T, repo name.Repository, subject v1.Hash, key *ecdsa.PrivateKey) {
+	t.Helper()
+
+	statement := marshal(t, map[string]interface{}{
+		"_type":         "https://in-toto.io/Statement/v1",
+		"subject":       []map[string]interface{}{{"name": repo.String(), "digest": map[string]string{"sha256": subject.Hex}}},
+		"predicateType": "https://spdx.dev/Document",
+	})
+	env := marshal(t, map[string]interface{}{
+		"payloadType": inTotoPayloadType,
+		"payload":     statement,
+		"signatures":  []map[string]interface{}{{"sig": sign(t, key, pae(inTotoPayloadType, statement))}},
+	})
+
+	img, err := mutate.Append(empty.Image, mutate.Addendum{Layer: static.NewLayer(env, dsseMediaType)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(repo.Tag(subject.Algorithm+"-"+subject.Hex+".att"), img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// pushReferrerBundle pushes a sigstore bundle signing the subject as a referrer of it
+func pushReferrerBundle(t *testing.T, repo name.Repository, subject v1.Descriptor, key *ecdsa.PrivateKey) {
+	t.Helper()
+
+	digest, err := hex.DecodeString(subject.Digest.Hex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle := marshal(t, map[string]interface{}{
+		"mediaType": "application/vnd.dev.sigstore.bundle.v0.3+json",
+		"messageSignature": map[string]interface{}{
+			"messageDigest": map[string]interface{}{"algorithm": "SHA2_256", "digest": digest},
+			"signature":     sig,
+		},
+	})
+
+	img, err := mutate.Append(empty.Image, mutate.Addendum{Layer: static.NewLayer(bundle, "application/vnd.dev.sigstore.bundle.v0.3+json")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img = mutate.ConfigMediaType(img, "application/vnd.dev.sigstore.bundle.v0.3+json")
+	img = mutate.Subject(img, subject).(v1.Image)
+
+	imgDigest, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(repo.Digest(imgDigest.String()), img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyImage(t *testing.T) {
+	ctx := context.Background()
+
+	key, publicKey := newTestKey(t)
+	otherKey, _ := newTestKey(t)
+	ca := newTestCA(t)
+	rekor := newTestLog(t)
+
+	host := newTestRegistry(t)
+
+	// single arch image signed with a key and attested
+	single, err := name.NewRepository(host + "/rancher/rke2-runtime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	singleImg := platformImage(t, "linux", "amd64")
+	if err := remote.Write(single.Tag("v1.30.4-rke2r1"), singleImg); err != nil {
+		t.Fatal(err)
+	}
+	singleDigest, err := singleImg.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushSignature(t, single, singleDigest, singleDigest, key, nil, nil)
+	pushAttestation(t, single, singleDigest, key)
+
+	// multi arch images, one signed keyless at the index, one with only the arm64 platform signed as a referrer
+	amd64Img := platformImage(t, "linux", "amd64")
+	arm64Img := platformImage(t, "linux", "arm64")
+	arm64Desc := v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "arm64"}}
+	idx := mutate.AppendManifests(empty.Index,
+		mutate.IndexAddendum{Add: amd64Img, Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "amd64"}}},
+		mutate.IndexAddendum{Add: arm64Img, Descriptor: arm64Desc},
+	)
+	idxDigest, err := idx.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	arm64Digest, err := arm64Img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	arm64Manifest, err := arm64Img.RawManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	multi, err := name.NewRepository(host + "/rancher/rke2-multi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.WriteIndex(multi.Tag("v1.30.4-rke2r1"), idx); err != nil {
+		t.Fatal(err)
+	}
+	cert, certKey := ca.issue(t, testSubject, time.Now().Add(-2*time.Hour-time.Minute))
+	pushSignature(t, multi, idxDigest, idxDigest, certKey, []*x509.Certificate{cert, ca.intermediate}, rekor)
+
+	referrers, err := name.NewRepository(host + "/rancher/rke2-referrers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.WriteIndex(referrers.Tag("v1.30.4-rke2r1"), idx); err != nil {
+		t.Fatal(err)
+	}
+	pushReferrerBundle(t, referrers, v1.Descriptor{
+		MediaType: types.DockerManifestSchema2,
+		Digest:    arm64Digest,
+		Size:      int64(len(arm64Manifest)),
+	}, key)
+
+	// image whose signature is over another digest, and one signed with an untrusted key
+	tampered, err := name.NewRepository(host + "/rancher/tampered")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(tampered.Tag("v1"), singleImg); err != nil {
+		t.Fatal(err)
+	}
+	pushSignature(t, tampered, singleDigest, arm64Digest, key, nil, nil)
+
+	untrusted, err := name.NewRepository(host + "/rancher/untrusted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(untrusted.Tag("v1"), singleImg); err != nil {
+		t.Fatal(err)
+	}
+	pushSignature(t, untrusted, singleDigest, singleDigest, otherKey, nil, nil)
+
+	verifier, err := NewVerifier([][]byte{publicKey}, ca.rootCertificates, []Identity{{Issuer: testIssuer, SubjectRegexp: "^https://github.com/rancher/"}}, [][]byte{rekor.publicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	imageVerifier := NewImageVerifier(verifier)
+
+	type platformResult struct {
+		platform     string
+		signed       bool
+		attestations int
+		errors       int
+	}
+
+	tests := []struct {
+		name string
+		ref  string
+		want []platformResult
+	}{
+		{
+			name: "signed and attested",
+			ref:  single.Tag("v1.30.4-rke2r1").String(),
+			want: []platformResult{{platform: "linux/amd64", signed: true, attestations: 1}},
+		},
+		{
+			name: "keyless signed index",
+			ref:  multi.Tag("v1.30.4-rke2r1").String(),
+			want: []platformResult{
+				{signed: true},
+				{platform: "linux/amd64", signed: true},
+				{platform: "linux/arm64", signed: true},
+			},
+		},
+		{
+			name: "platform signed with a referrer",
+			ref:  referrers.Tag("v1.30.4-rke2r1").String(),
+			want: []platformResult{
+				{signed: false},
+				{platform: "linux/amd64", signed: false},
+				{platform: "linux/arm64", signed: true},
+			},
+		},
+		{
+			name: "signature over another digest",
+			ref:  tampered.Tag("v1").String(),
+			want: []platformResult{{platform: "linux/amd64", errors: 1}},
+		},
+		{
+			name: "untrusted key",
+			ref:  untrusted.Tag("v1").String(),
+			want: []platformResult{{platform: "linux/amd64", errors: 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref, err := name.ParseReference(tt.ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			results, err := imageVerifier.VerifyImage(ctx, ref)
+			if err != nil {
+				t.Fatalf("VerifyImage() error = %v", err)
+			}
+			if len(results) != len(tt.want) {
+				t.Fatalf("VerifyImage() returned %d results, want %d: %+v", len(results), len(tt.want), results)
+			}
+
+			for i, want := range tt.want {
+				result := results[i]
+				if want.platform != "" && result.Platform != want.platform {
+					t.Errorf("results[%d].Platform = %q, want %q", i, result.Platform, want.platform)
+				}
+				if result.Signed != want.signed {
+					t.Errorf("results[%d].Signed = %v, want %v (errors: %v)", i, result.Signed, want.signed, result.Errors)
+				}
+				if len(result.Attestations) != want.attestations {
+					t.Errorf("results[%d].Attestations = %v, want %d", i, result.Attestations, want.attestations)
+				}
+				if len(result.Errors) != want.errors {
+					t.Errorf("results[%d].Errors = %v, want %d", i, result.Errors, want.errors)
+				}
+			}
+		})
+	}
+}
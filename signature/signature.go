@@ -0,0 +1,260 @@
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"regexp"
+	"strconv"
+)
+
+// Fulcio certificate extensions containing the OIDC issuer of the signer identity
+var (
+	oidIssuerV1 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+	oidIssuerV2 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+)
+
+// Identity is a keyless signer identity, as recorded in the signing certificate.
+type Identity struct {
+	Issuer        string
+	SubjectRegexp string
+}
+
+type identity struct {
+	issuer  string
+	subject *regexp.Regexp
+}
+
+// Verifier verifies signatures made with trusted public keys, or made by trusted
+// identities with short-lived certificates issued by a trusted certificate authority.
+// Keyless signatures are checked at the time recorded in their transparency log entry,
+// whose signed entry timestamp is verified offline with the trusted Rekor keys.
+type Verifier struct {
+	keys       []crypto.PublicKey
+	roots      *x509.CertPool
+	identities []identity
+	// rekorKeys are the trusted Rekor public keys by log ID
+	rekorKeys map[string]crypto.PublicKey
+}
+
+// NewVerifier creates a verifier from PEM encoded public keys, a PEM bundle with
+// the trusted root and intermediate certificates, the trusted identities and the
+// PEM encoded public keys of the trusted Rekor transparency logs.
+func NewVerifier(publicKeys [][]byte, rootCertificates []byte, identities []Identity, rekorPublicKeys [][]byte) (*Verifier, error) {
+	v := Verifier{
+		roots:     x509.NewCertPool(),
+		rekorKeys: make(map[string]crypto.PublicKey, len(rekorPublicKeys)),
+	}
+
+	for _, publicKey := range publicKeys {
+		key, _, err := parsePublicKey(publicKey)
+		if err != nil {
+			return nil, err
+		}
+		v.keys = append(v.keys, key)
+	}
+
+	for _, publicKey := range rekorPublicKeys {
+		key, der, err := parsePublicKey(publicKey)
+		if err != nil {
+			return nil, errors.New("failed to parse Rekor public key: " + err.Error())
+		}
+		v.rekorKeys[rekorKeyID(der)] = key
+	}
+
+	if len(rootCertificates) > 0 && !v.roots.AppendCertsFromPEM(rootCertificates) {
+		return nil, errors.New("failed to parse root certificates")
+	}
+
+	for _, id := range identities {
+		if id.Issuer == "" || id.SubjectRegexp == "" {
+			return nil, errors.New("identities require an issuer and a subject regexp")
+		}
+		subject, err := regexp.Compile(id.SubjectRegexp)
+		if err != nil {
+			return nil, err
+		}
+		v.identities = append(v.identities, identity{issuer: id.Issuer, subject: subject})
+	}
+
+	if len(v.keys) == 0 && len(v.identities) == 0 {
+		return nil, errors.New("at least one public key or identity must be trusted")
+	}
+
+	return &v, nil
+}
+
+// parsePublicKey parses a PEM encoded ECDSA or RSA public key, returning it along with its DER encoding
+func parsePublicKey(publicKey []byte) (crypto.PublicKey, []byte, error) {
+	block, _ := pem.Decode(publicKey)
+	if block == nil {
+		return nil, nil, errors.New("failed to decode public key PEM")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch key.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey:
+	default:
+		return nil, nil, errors.New("unsupported public key type, only ECDSA and RSA keys are supported")
+	}
+
+	return key, block.Bytes, nil
+}
+
+// material is what a signature was made with, as found next to the signature.
+type material struct {
+	// certificate is the signing certificate, nil for signatures made with keys
+	certificate *x509.Certificate
+	// intermediates are the certificates chaining the signing certificate to a root
+	intermediates []*x509.Certificate
+	// tlogEntry is the transparency log entry of the signature, nil when it wasn't logged
+	tlogEntry *tlogEntry
+}
+
+// verifyDigest checks a signature over the given SHA-256 digest, returning
+// a description of the key or identity that made it.
+func (v *Verifier) verifyDigest(m material, digest, sig []byte) (string, error) {
+	if m.certificate != nil {
+		return v.verifyCertificate(m, digest, sig)
+	}
+
+	for i, key := range v.keys {
+		if verifyDigest(key, digest, sig) == nil {
+			return "key " + strconv.Itoa(i), nil
+		}
+	}
+
+	return "", errors.New("signature doesn't match any trusted public key")
+}
+
+func (v *Verifier) verifyCertificate(m material, digest, sig []byte) (string, error) {
+	if len(v.identities) == 0 {
+		return "", errors.New("keyless signature found but no trusted identities configured")
+	}
+
+	signedAt, err := v.verifyTlogEntry(m)
+	if err != nil {
+		return "", err
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, intermediate := range m.intermediates {
+		intermediates.AddCert(intermediate)
+	}
+
+	cert := m.certificate
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:         v.roots,
+		Intermediates: intermediates,
+		CurrentTime:   signedAt,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}); err != nil {
+		return "", err
+	}
+
+	if err := verifyDigest(cert.PublicKey, digest, sig); err != nil {
+		return "", err
+	}
+
+	issuer := certificateIssuer(cert)
+	for _, subject := range certificateSubjects(cert) {
+		for _, id := range v.identities {
+			if id.issuer == issuer && id.subject.MatchString(subject) {
+				return subject + " (" + issuer + ")", nil
+			}
+		}
+	}
+
+	return "", errors.New("certificate identity isn't trusted")
+}
+
+func verifyDigest(key crypto.PublicKey, digest, sig []byte) error {
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, digest, sig) {
+			return errors.New("invalid ECDSA signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, digest, sig); err != nil {
+			return rsa.VerifyPSS(k, crypto.SHA256, digest, sig, nil)
+		}
+		return nil
+	default:
+		return errors.New("unsupported public key type")
+	}
+}
+
+// certificateIssuer returns the OIDC issuer recorded in a Fulcio certificate
+func certificateIssuer(cert *x509.Certificate) string {
+	for _, ext := range cert.Extensions {
+		switch {
+		case ext.Id.Equal(oidIssuerV2):
+			var issuer string
+			if _, err := asn1.Unmarshal(ext.Value, &issuer); err == nil {
+				return issuer
+			}
+		case ext.Id.Equal(oidIssuerV1):
+			return string(ext.Value)
+		}
+	}
+
+	return ""
+}
+
+// certificateSubjects returns the identities a certificate was issued to
+func certificateSubjects(cert *x509.Certificate) []string {
+	subjects := append([]string{}, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		subjects = append(subjects, uri.String())
+	}
+
+	return subjects
+}
+
+func parseCertificate(b []byte) (*x509.Certificate, error) {
+	if block, _ := pem.Decode(b); block != nil {
+		b = block.Bytes
+	}
+
+	return x509.ParseCertificate(b)
+}
+
+// parseCertificateChain parses a PEM bundle of certificates
+func parseCertificateChain(b []byte) ([]*x509.Certificate, error) {
+	var chain []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("no certificates found in the chain")
+	}
+
+	return chain, nil
+}
+
+func sha256Sum(b []byte) []byte {
+	sum := sha256.Sum256(b)
+	return sum[:]
+}
+
+func hexDigest(b []byte) string {
+	return "sha256:" + hex.EncodeToString(b)
+}
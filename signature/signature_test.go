@@ -0,0 +1,331 @@
+package signature
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+const (
+	testIssuer  = "https://token.actions.githubusercontent.com"
+	testSubject = "https://github.com/rancher/rke2/.github/workflows/release.yml@refs/tags/v1.30.4+rke2r1"
+)
+
+// testCA is a throwaway certificate authority issuing short-lived signing certificates
+// through an intermediate, like Fulcio
+type testCA struct {
+	root             *x509.Certificate
+	intermediate     *x509.Certificate
+	intermediateKey  *ecdsa.PrivateKey
+	rootCertificates []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	rootKey, _ := newTestKey(t)
+	root := createCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test root"},
+		NotBefore:             time.Now().Add(-24 * time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, &rootKey.PublicKey, rootKey)
+
+	intermediateKey, _ := newTestKey(t)
+	intermediate := createCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "test intermediate"},
+		NotBefore:             time.Now().Add(-24 * time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}, root, &intermediateKey.PublicKey, rootKey)
+
+	return &testCA{
+		root:             root,
+		intermediate:     intermediate,
+		intermediateKey:  intermediateKey,
+		rootCertificates: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}),
+	}
+}
+
+// issue returns a signing certificate for the subject, valid for ten minutes from notBefore
+func (ca *testCA) issue(t *testing.T, subject string, notBefore time.Time) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	issuer, err := asn1.MarshalWithParams(testIssuer, "utf8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri, err := url.Parse(subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, _ := newTestKey(t)
+	cert := createCertificate(t, &x509.Certificate{
+		SerialNumber:    big.NewInt(time.Now().UnixNano()),
+		NotBefore:       notBefore,
+		NotAfter:        notBefore.Add(10 * time.Minute),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		URIs:            []*url.URL{uri},
+		ExtraExtensions: []pkix.Extension{{Id: oidIssuerV2, Value: issuer}},
+	}, ca.intermediate, &key.PublicKey, ca.intermediateKey)
+
+	return cert, key
+}
+
+func createCertificate(t *testing.T, template, parent *x509.Certificate, publicKey *ecdsa.PublicKey, signer *ecdsa.PrivateKey) *x509.Certificate {
+	t.Helper()
+
+	if parent == nil {
+		parent = template
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, publicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert
+}
+
+func certificatePEM(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+// testLog is a throwaway Rekor transparency log
+type testLog struct {
+	key       *ecdsa.PrivateKey
+	publicKey []byte
+	logID     string
+}
+
+func newTestLog(t *testing.T) *testLog {
+	t.Helper()
+
+	key, publicKey := newTestKey(t)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testLog{key: key, publicKey: publicKey, logID: rekorKeyID(der)}
+}
+
+// entry logs a hashedrekord entry for a signature made with the certificate at integratedTime
+func (l *testLog) entry(t *testing.T, cert *x509.Certificate, sig []byte, integratedTime time.Time) *tlogEntry {
+	t.Helper()
+
+	body := marshal(t, map[string]interface{}{
+		"apiVersion": "0.0.1",
+		"kind":       "hashedrekord",
+		"spec": map[string]interface{}{
+			"signature": map[string]interface{}{
+				"content":   base64.StdEncoding.EncodeToString(sig),
+				"publicKey": map[string]string{"content": base64.StdEncoding.EncodeToString(certificatePEM(cert))},
+			},
+		},
+	})
+
+	entry := tlogEntry{
+		body:           body,
+		integratedTime: integratedTime.Unix(),
+		logIndex:       42,
+		logID:          l.logID,
+	}
+	payload := marshal(t, setPayload{
+		Body:           base64.StdEncoding.EncodeToString(entry.body),
+		IntegratedTime: entry.integratedTime,
+		LogID:          entry.logID,
+		LogIndex:       entry.logIndex,
+	})
+	entry.signedEntryTimestamp = sign(t, l.key, payload)
+
+	return &entry
+}
+
+// rekorBundle returns the entry in the format of cosign bundles and annotations
+func (e *tlogEntry) rekorBundle() map[string]interface{} {
+	return map[string]interface{}{
+		"SignedEntryTimestamp": e.signedEntryTimestamp,
+		"Payload": map[string]interface{}{
+			"body":           e.body,
+			"integratedTime": e.integratedTime,
+			"logIndex":       e.logIndex,
+			"logID":          e.logID,
+		},
+	}
+}
+
+// sigstoreKeylessBundle returns a sigstore bundle with a message signature, the certificate chain and the tlog entry
+func sigstoreKeylessBundle(t *testing.T, chain []*x509.Certificate, entry *tlogEntry, digest, sig []byte) []byte {
+	t.Helper()
+
+	certificates := make([]map[string][]byte, 0, len(chain))
+	for _, cert := range chain {
+		certificates = append(certificates, map[string][]byte{"rawBytes": cert.Raw})
+	}
+
+	verificationMaterial := map[string]interface{}{
+		"x509CertificateChain": map[string]interface{}{"certificates": certificates},
+	}
+	if entry != nil {
+		logID, err := hex.DecodeString(entry.logID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		verificationMaterial["tlogEntries"] = []map[string]interface{}{{
+			"logIndex":          strconv.FormatInt(entry.logIndex, 10),
+			"logId":             map[string][]byte{"keyId": logID},
+			"integratedTime":    strconv.FormatInt(entry.integratedTime, 10),
+			"inclusionPromise":  map[string][]byte{"signedEntryTimestamp": entry.signedEntryTimestamp},
+			"canonicalizedBody": entry.body,
+		}}
+	}
+
+	return marshal(t, map[string]interface{}{
+		"mediaType":            "application/vnd.dev.sigstore.bundle+json;version=0.2",
+		"verificationMaterial": verificationMaterial,
+		"messageSignature": map[string]interface{}{
+			"messageDigest": map[string]interface{}{"algorithm": "SHA2_256", "digest": digest},
+			"signature":     sig,
+		},
+	})
+}
+
+func TestVerifyKeyless(t *testing.T) {
+	ca := newTestCA(t)
+	rekor := newTestLog(t)
+	otherLog := newTestLog(t)
+
+	asset := []byte("rke2 binary")
+	digest := sha256Sum(asset)
+
+	// the certificate expired long ago, it was valid when the signature was logged
+	signedAt := time.Now().Add(-2 * time.Hour)
+	cert, key := ca.issue(t, testSubject, signedAt.Add(-time.Minute))
+	sig := sign(t, key, asset)
+	chain := []*x509.Certificate{cert, ca.intermediate}
+
+	otherCert, otherKey := ca.issue(t, testSubject, signedAt.Add(-time.Minute))
+	otherSig := sign(t, otherKey, asset)
+
+	untrustedCert, untrustedKey := ca.issue(t, "https://github.com/attacker/rke2/.github/workflows/release.yml@refs/heads/main", signedAt.Add(-time.Minute))
+	untrustedSig := sign(t, untrustedKey, asset)
+
+	validEntry := rekor.entry(t, cert, sig, signedAt)
+
+	// an entry whose integrated time was changed after it was logged, to a time the certificate isn't valid at
+	tamperedEntry := *validEntry
+	tamperedEntry.integratedTime = time.Now().Unix()
+
+	trusted := []Identity{{Issuer: testIssuer, SubjectRegexp: "^https://github.com/rancher/"}}
+
+	tests := []struct {
+		name            string
+		rekorPublicKeys [][]byte
+		bundle          []byte
+		wantSigned      bool
+		wantError       string
+	}{
+		{
+			name:            "valid",
+			rekorPublicKeys: [][]byte{rekor.publicKey},
+			bundle:          sigstoreKeylessBundle(t, chain, validEntry, digest, sig),
+			wantSigned:      true,
+		},
+		{
+			name:            "no trusted rekor key",
+			rekorPublicKeys: nil,
+			bundle:          sigstoreKeylessBundle(t, chain, validEntry, digest, sig),
+			wantError:       "no trusted Rekor public key",
+		},
+		{
+			name:            "no tlog entry",
+			rekorPublicKeys: [][]byte{rekor.publicKey},
+			bundle:          sigstoreKeylessBundle(t, chain, nil, digest, sig),
+			wantError:       "without a transparency log entry",
+		},
+		{
+			name:            "tampered integrated time",
+			rekorPublicKeys: [][]byte{rekor.publicKey},
+			bundle:          sigstoreKeylessBundle(t, chain, &tamperedEntry, digest, sig),
+			wantError:       "invalid signed entry timestamp",
+		},
+		{
+			name:            "untrusted log",
+			rekorPublicKeys: [][]byte{rekor.publicKey},
+			bundle:          sigstoreKeylessBundle(t, chain, otherLog.entry(t, cert, sig, signedAt), digest, sig),
+			wantError:       "untrusted log",
+		},
+		{
+			name:            "entry of another certificate",
+			rekorPublicKeys: [][]byte{rekor.publicKey},
+			bundle:          sigstoreKeylessBundle(t, []*x509.Certificate{otherCert, ca.intermediate}, validEntry, digest, otherSig),
+			wantError:       "doesn't record the signing certificate",
+		},
+		{
+			name:            "missing intermediate",
+			rekorPublicKeys: [][]byte{rekor.publicKey},
+			bundle:          sigstoreKeylessBundle(t, []*x509.Certificate{cert}, validEntry, digest, sig),
+			wantError:       "certificate signed by unknown authority",
+		},
+		{
+			name:            "untrusted identity",
+			rekorPublicKeys: [][]byte{rekor.publicKey},
+			bundle:          sigstoreKeylessBundle(t, []*x509.Certificate{untrustedCert, ca.intermediate}, rekor.entry(t, untrustedCert, untrustedSig, signedAt), digest, untrustedSig),
+			wantError:       "identity isn't trusted",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier, err := NewVerifier(nil, ca.rootCertificates, trusted, tt.rekorPublicKeys)
+			if err != nil {
+				t.Fatalf("NewVerifier() error = %v", err)
+			}
+
+			results, err := verifier.VerifyAssets(context.Background(), fstest.MapFS{
+				"rke2":               {Data: asset},
+				"rke2.sigstore.json": {Data: tt.bundle},
+			}, []string{"rke2"}, 1)
+			if err != nil {
+				t.Fatalf("VerifyAssets() error = %v", err)
+			}
+
+			result := results[0]
+			if result.Signed != tt.wantSigned {
+				t.Errorf("Signed = %v, want %v (errors: %v)", result.Signed, tt.wantSigned, result.Errors)
+			}
+			if tt.wantSigned && result.Signer != testSubject+" ("+testIssuer+")" {
+				t.Errorf("Signer = %q", result.Signer)
+			}
+			if tt.wantError != "" && (len(result.Errors) != 1 || !strings.Contains(result.Errors[0], tt.wantError)) {
+				t.Errorf("Errors = %v, want %q", result.Errors, tt.wantError)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package signature
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"time"
+)
+
+// tlogEntry is a Rekor transparency log entry along with its signed entry timestamp,
+// as found in the verification material. Nothing in it is trusted until the signed
+// entry timestamp is verified with verifyTlogEntry.
+type tlogEntry struct {
+	body           []byte
+	integratedTime int64
+	logIndex       int64
+	logID          string
+	// signedEntryTimestamp is Rekor's signature over the entry and its integrated time
+	signedEntryTimestamp []byte
+}
+
+// setPayload is the payload of a Rekor signed entry timestamp. Fields are sorted and
+// the values never need escaping, so its JSON encoding is canonical.
+type setPayload struct {
+	Body           string `json:"body"`
+	IntegratedTime int64  `json:"integratedTime"`
+	LogID          string `json:"logID"`
+	LogIndex       int64  `json:"logIndex"`
+}
+
+// rekorKeyID returns the log ID Rekor uses for a public key, the hex encoded
+// SHA-256 of its DER encoding
+func rekorKeyID(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// verifyTlogEntry verifies the signed entry timestamp of the transparency log entry
+// with the trusted Rekor keys and that the entry records the signing certificate,
+// returning the time the entry was integrated in the log.
+func (v *Verifier) verifyTlogEntry(m material) (time.Time, error) {
+	if len(v.rekorKeys) == 0 {
+		return time.Time{}, errors.New("keyless signature found but no trusted Rekor public key configured")
+	}
+	entry := m.tlogEntry
+	if entry == nil {
+		return time.Time{}, errors.New("keyless signature without a transparency log entry")
+	}
+	if len(entry.signedEntryTimestamp) == 0 {
+		return time.Time{}, errors.New("transparency log entry without a signed entry timestamp")
+	}
+
+	key, ok := v.rekorKeys[entry.logID]
+	if !ok {
+		return time.Time{}, errors.New("transparency log entry from an untrusted log: " + entry.logID)
+	}
+
+	payload, err := json.Marshal(setPayload{
+		Body:           base64.StdEncoding.EncodeToString(entry.body),
+		IntegratedTime: entry.integratedTime,
+		LogID:          entry.logID,
+		LogIndex:       entry.logIndex,
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := verifyDigest(key, sha256Sum(payload), entry.signedEntryTimestamp); err != nil {
+		return time.Time{}, errors.New("invalid signed entry timestamp: " + err.Error())
+	}
+
+	if !bodyContainsCertificate(entry.body, m.certificate) {
+		return time.Time{}, errors.New("transparency log entry doesn't record the signing certificate")
+	}
+
+	return time.Unix(entry.integratedTime, 0), nil
+}
+
+// bodyContainsCertificate reports whether the certificate is one of the base64 encoded
+// values of a Rekor entry body. Fulcio certificates are issued for a single ephemeral
+// key, so this ties the entry, and its integrated time, to the signature.
+func bodyContainsCertificate(body []byte, cert *x509.Certificate) bool {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return false
+	}
+
+	var found bool
+	walkStrings(v, func(s string) {
+		if found {
+			return
+		}
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return
+		}
+		if block, _ := pem.Decode(b); block != nil {
+			b = block.Bytes
+		}
+		found = bytes.Equal(b, cert.Raw)
+	})
+
+	return found
+}
+
+func walkStrings(v interface{}, fn func(string)) {
+	switch t := v.(type) {
+	case string:
+		fn(t)
+	case []interface{}:
+		for _, e := range t {
+			walkStrings(e, fn)
+		}
+	case map[string]interface{}:
+		for _, e := range t {
+			walkStrings(e, fn)
+		}
+	}
+}